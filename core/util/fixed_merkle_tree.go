@@ -2,6 +2,10 @@ package util
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	goErrors "errors"
+	"hash"
 	"io"
 
 	"github.com/0chain/errors"
@@ -14,8 +18,49 @@ type FixedMerkleTree struct {
 	ChunkSize int `json:"chunk_size,omitempty"`
 	// Leaves a leaf is a CompactMerkleTree for 1/1024 shard data
 	Leaves []*CompactMerkleTree `json:"leaves,omitempty"`
+	// newHash hash of the data blocks and of the nodes, the default SHA-256 blocks and SHA3-256 nodes if nil
+	newHash func() hash.Hash
+	// leafDigests the roots of the leaves once the tree is compacted, one digest of digestSize bytes after the other
+	leafDigests []byte
+	digestSize  int
 }
 
+const (
+	// FixedMerkleLeaves number of leaves of a FixedMerkleTree, every chunk is split between them
+	FixedMerkleLeaves = 1024
+	// FixedMTDepth number of levels of the tree built on the leaf roots, the leaf level and the root level included
+	FixedMTDepth = 11
+)
+
+// LeavesForSize returns how many leaves of a tree with the default 64KB chunks hash some of n bytes of data.
+// The data is split in blocks of 64 bytes going to the leaves one after the other, so all of them are used from 64KB on.
+func LeavesForSize(n int64) int {
+	if n <= 0 {
+		return 0
+	}
+	leaves := (n + defaultLeafBlockSize - 1) / defaultLeafBlockSize
+	if leaves > FixedMerkleLeaves {
+		return FixedMerkleLeaves
+	}
+	return int(leaves)
+}
+
+// DepthForLeaves returns the number of levels of a merkle tree on n leaves, the leaf level and the root level included:
+// a level halves the nodes of the one under it, an odd last node going up alone, until a single root is left.
+func DepthForLeaves(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	depth := 1
+	for ; n > 1; n = (n + 1) / 2 {
+		depth++
+	}
+	return depth
+}
+
+// ErrMerkleTreeCompacted the tree is compacted, it only keeps the roots of its leaves and no data can be written to it
+var ErrMerkleTreeCompacted = goErrors.New("merkle: the tree is compacted, no more data can be written")
+
 // NewFixedMerkleTree create a FixedMerkleTree with specify hash method
 func NewFixedMerkleTree(chunkSize int) *FixedMerkleTree {
 
@@ -28,21 +73,118 @@ func NewFixedMerkleTree(chunkSize int) *FixedMerkleTree {
 
 }
 
+// NewFixedMerkleTreeWithHash create a FixedMerkleTree hashing the data blocks and the nodes with newHash instead of the default hashes.
+// The hash is not saved with the tree: a tree restored with Load or from JSON must be created with the same hash.
+func NewFixedMerkleTreeWithHash(chunkSize int, newHash func() hash.Hash) *FixedMerkleTree {
+	t := &FixedMerkleTree{
+		ChunkSize: chunkSize,
+		newHash:   newHash,
+	}
+	t.initLeaves()
+
+	return t
+}
+
 func (fmt *FixedMerkleTree) initLeaves() {
-	fmt.Leaves = make([]*CompactMerkleTree, 1024)
-	for n := 0; n < 1024; n++ {
-		fmt.Leaves[n] = NewCompactMerkleTree(nil)
+	fmt.leafDigests = nil
+	fmt.Leaves = make([]*CompactMerkleTree, FixedMerkleLeaves)
+	for n := 0; n < FixedMerkleLeaves; n++ {
+		fmt.Leaves[n] = NewCompactMerkleTree(fmt.pairHash())
 	}
 }
 
-func (fmt *FixedMerkleTree) Write(buf []byte, chunkIndex int) error {
+// ensureLeaves creates the leaves of a tree built without NewFixedMerkleTree, a compacted tree has none
+func (fmt *FixedMerkleTree) ensureLeaves() {
+	if len(fmt.Leaves) != FixedMerkleLeaves && !fmt.IsCompacted() {
+		fmt.initLeaves()
+	}
+}
+
+// Compact replaces the leaves by their roots once all the data is written, a compacted tree holds a single buffer
+// of 1024 digests instead of 1024 leaves with their node hashes, e.g. to keep many trees of finished uploads around.
+// The roots and merkle paths are unchanged, but Write, WriteFrom and Save then fail with ErrMerkleTreeCompacted.
+// Reload starts the tree over, uncompacted.
+func (fmt *FixedMerkleTree) Compact() error {
+	if fmt.IsCompacted() {
+		return nil
+	}
+	fmt.ensureLeaves()
+	var digests []byte
+	for i, leaf := range fmt.Leaves {
+		digest, err := hex.DecodeString(leaf.GetMerkleRoot())
+		if err != nil {
+			return errors.Wrap(err, "invalid leaf root.")
+		}
+		if i == 0 {
+			fmt.digestSize = len(digest)
+			digests = make([]byte, 0, len(digest)*len(fmt.Leaves))
+		} else if len(digest) != fmt.digestSize {
+			return errors.Newf("invalid_merkle_tree", "leaf %v root is %v bytes instead of %v", i, len(digest), fmt.digestSize)
+		}
+		digests = append(digests, digest...)
+	}
+	fmt.leafDigests = digests
+	fmt.Leaves = nil
+	return nil
+}
+
+// IsCompacted tells if the tree was compacted by Compact
+func (fmt *FixedMerkleTree) IsCompacted() bool {
+	return fmt.leafDigests != nil
+}
+
+// leafRoot the merkle root of the leaf i, from its digest once compacted
+func (fmt *FixedMerkleTree) leafRoot(i int) string {
+	if fmt.IsCompacted() {
+		return hex.EncodeToString(fmt.leafDigests[i*fmt.digestSize : (i+1)*fmt.digestSize])
+	}
+	return fmt.Leaves[i].GetMerkleRoot()
+}
+
+// leafCount the number of leaves, compacted or not
+func (fmt *FixedMerkleTree) leafCount() int {
+	if fmt.IsCompacted() {
+		return len(fmt.leafDigests) / fmt.digestSize
+	}
+	return len(fmt.Leaves)
+}
+
+// pairHash the hash of two child nodes, nil for the default MHash
+func (fmt *FixedMerkleTree) pairHash() func(left, right string) string {
+	if fmt.newHash == nil {
+		return nil
+	}
+	return func(left, right string) string {
+		return fmt.hashHex([]byte(left + right))
+	}
+}
+
+func (fmt *FixedMerkleTree) hashHex(buf []byte) string {
+	h := fmt.newHash()
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// leafBlockSize size of the part of a chunk each leaf hashes
+func (fmt *FixedMerkleTree) leafBlockSize() int {
 	//split chunk into 1024 parts for challenge hash
-	merkleChunkSize := fmt.ChunkSize / 1024
+	merkleChunkSize := fmt.ChunkSize / FixedMerkleLeaves
 
 	// chunksize is less than 1024
 	if merkleChunkSize == 0 {
 		merkleChunkSize = 1
 	}
+	return merkleChunkSize
+}
+
+// Write hashes buf as chunk chunkIndex, it is split across the leaves from the first one,
+// so buf must hold the whole chunk and only the last chunk may be shorter than ChunkSize.
+// Use FixedMerkleTreeWriter to feed writes of any size, it buffers them into whole chunks.
+func (fmt *FixedMerkleTree) Write(buf []byte, chunkIndex int) error {
+	if fmt.IsCompacted() {
+		return ErrMerkleTreeCompacted
+	}
+	merkleChunkSize := fmt.leafBlockSize()
 
 	total := len(buf)
 	offset := 0
@@ -52,17 +194,22 @@ func (fmt *FixedMerkleTree) Write(buf []byte, chunkIndex int) error {
 			end = len(buf)
 		}
 
-		if len(fmt.Leaves) != 1024 {
+		if len(fmt.Leaves) != FixedMerkleLeaves {
 			fmt.initLeaves()
 		}
 
-		err := fmt.Leaves[offset].AddDataBlocks(buf[i:end], chunkIndex)
+		var err error
+		if fmt.newHash == nil {
+			err = fmt.Leaves[offset].AddDataBlocks(buf[i:end], chunkIndex)
+		} else {
+			err = fmt.Leaves[offset].AddLeaf(fmt.hashHex(buf[i:end]), chunkIndex)
+		}
 		if errors.Is(err, ErrLeafNoSequenced) {
 			return err
 		}
 
 		offset++
-		if offset >= 1024 {
+		if offset >= FixedMerkleLeaves {
 			offset = 0
 		}
 	}
@@ -70,54 +217,382 @@ func (fmt *FixedMerkleTree) Write(buf []byte, chunkIndex int) error {
 	return nil
 }
 
-// GetMerkleRoot get merkle tree
+// LeafRange a leaf with data written to it, see CompletedLeaves
+type LeafRange struct {
+	Index int `json:"index"`
+	// Hash merkle root of the leaf over the chunks written so far
+	Hash string `json:"hash"`
+	// Chunks number of chunks the leaf has hashed, from chunk 0 on
+	Chunks int `json:"chunks"`
+	// Start, End bytes [Start, End) the leaf covers within each chunk
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// CompletedLeaves returns the leaves data was written to, in leaf order, so an upload can checkpoint its progress.
+// A chunk is split in blocks of ChunkSize/1024 bytes, 64 bytes with the 64KB default, and leaf i hashes the block i of every chunk:
+// in chunk c it covers the bytes [c*ChunkSize + i*64, c*ChunkSize + (i+1)*64) of the file. Chunks are written whole, so every leaf
+// has the same Chunks but the ones after the end of a short last chunk, and the upload resumes at byte Chunks*ChunkSize of the first leaf.
+func (fmt *FixedMerkleTree) CompletedLeaves() ([]LeafRange, error) {
+	if fmt.IsCompacted() {
+		return nil, ErrMerkleTreeCompacted
+	}
+	blockSize := int64(fmt.leafBlockSize())
+	var leaves []LeafRange
+	for i, leaf := range fmt.Leaves {
+		if leaf == nil || !leaf.Initialized {
+			continue
+		}
+		leaves = append(leaves, LeafRange{
+			Index:  i,
+			Hash:   leaf.GetMerkleRoot(),
+			Chunks: leaf.LastIndex + 1,
+			Start:  int64(i) * blockSize,
+			End:    int64(i+1) * blockSize,
+		})
+	}
+	return leaves, nil
+}
+
+// FinalBlockLeafSizes returns how many bytes of the last chunk of a file of totalSize bytes each of the 1024 leaves hashes.
+// The last chunk is split in parts of ChunkSize/1024 bytes from the first leaf on: the last part is hashed short,
+// without any zero padding, and the leaves after it get no byte of that chunk.
+func (fmt *FixedMerkleTree) FinalBlockLeafSizes(totalSize int64) []int {
+	sizes := make([]int, FixedMerkleLeaves)
+	if totalSize <= 0 || fmt.ChunkSize <= 0 {
+		return sizes
+	}
+	final := int(totalSize % int64(fmt.ChunkSize))
+	if final == 0 {
+		final = fmt.ChunkSize
+	}
+	merkleChunkSize := fmt.leafBlockSize()
+	for i, offset := 0, 0; i < final; i += merkleChunkSize {
+		end := i + merkleChunkSize
+		if end > final {
+			end = final
+		}
+		sizes[offset] += end - i
+		offset = (offset + 1) % FixedMerkleLeaves
+	}
+	return sizes
+}
+
+// defaultLeafBlockSize bytes of every chunk a leaf hashes with the default 64KB chunk size
+const defaultLeafBlockSize = 64 * 1024 / FixedMerkleLeaves
+
+// VerifyBlock checks downloaded data against the merkle path of the leaf covering it, in a tree with the default hashes and 64KB chunks.
+// blockData is all the leaf hashes: its 64 bytes of every chunk, in chunk order, which is a single block for a file of one chunk.
+// The leaf root is computed again from the blocks and must be path.LeafHash, path must then lead to its root.
+func VerifyBlock(blockData []byte, path FixedMerklePath) bool {
+	if len(blockData) == 0 {
+		return false
+	}
+	leaf := NewCompactMerkleTree(path.hash)
+	for i, index := 0, 0; i < len(blockData); i, index = i+defaultLeafBlockSize, index+1 {
+		end := i + defaultLeafBlockSize
+		if end > len(blockData) {
+			end = len(blockData)
+		}
+		if err := leaf.AddDataBlocks(blockData[i:end], index); err != nil {
+			return false
+		}
+	}
+	return leaf.GetMerkleRoot() == path.LeafHash && path.VerifyMerklePath()
+}
+
+// GetMerkleTree get the merkle tree built on the roots of the 1024 leaves. Its GetTree holds every level,
+// the leaf roots first and the root last, and can be loaded back with SetTree.
 func (fmt *FixedMerkleTree) GetMerkleTree() MerkleTreeI {
-	merkleLeaves := make([]Hashable, 1024)
+	merkleLeaves := make([]Hashable, fmt.leafCount())
 
-	for idx, leaf := range fmt.Leaves {
+	for idx := 0; idx < fmt.leafCount(); idx++ {
 
-		merkleLeaves[idx] = NewStringHashable(leaf.GetMerkleRoot())
+		merkleLeaves[idx] = NewStringHashable(fmt.leafRoot(idx))
 	}
-	var mt MerkleTreeI = &MerkleTree{}
+	var mt MerkleTreeI = &MerkleTree{hash: fmt.pairHash()}
 
 	mt.ComputeTree(merkleLeaves)
 
 	return mt
 }
 
+// FixedMerklePath proof that a leaf is part of a FixedMerkleTree, see GetMerklePath
+type FixedMerklePath struct {
+	// LeafHash merkle root of the leaf
+	LeafHash string `json:"leaf_hash"`
+	// RootHash merkle root of the tree
+	RootHash string `json:"root_hash"`
+	// Nodes sibling hashes from the leaf level up to the level under the root
+	Nodes   []string `json:"nodes"`
+	LeafInd int      `json:"leaf_ind"`
+	// hash node hash of the tree, MHash if nil
+	hash func(left, right string) string
+}
+
+// VerifyMerklePath checks that hashing LeafHash up with Nodes, one per level under the root, leads to RootHash
+func (fp FixedMerklePath) VerifyMerklePath() bool {
+	if len(fp.Nodes) != FixedMTDepth-1 {
+		return false
+	}
+	mhash := fp.hash
+	if mhash == nil {
+		mhash = MHash
+	}
+	return computeMerklePathRoot(fp.LeafHash, &MTPath{Nodes: fp.Nodes, LeafIndex: fp.LeafInd}, mhash) == fp.RootHash
+}
+
+// GetMerklePath get the proof that the leaf leafInd is part of the tree: the FixedMTDepth-1 sibling hashes on the way
+// from the leaf to the root of the tree built by GetMerkleTree.
+func (fmt *FixedMerkleTree) GetMerklePath(leafInd int) (FixedMerklePath, error) {
+	if leafInd < 0 || leafInd >= FixedMerkleLeaves {
+		return FixedMerklePath{}, errors.Newf("invalid_leaf_index", "leaf index %v is out of [0, %v)", leafInd, FixedMerkleLeaves)
+	}
+	fmt.ensureLeaves()
+	mt := fmt.GetMerkleTree()
+	return FixedMerklePath{
+		LeafHash: fmt.leafRoot(leafInd),
+		RootHash: mt.GetRoot(),
+		Nodes:    mt.GetPathByIndex(leafInd).Nodes,
+		LeafInd:  leafInd,
+		hash:     fmt.pairHash(),
+	}, nil
+}
+
 // GetMerkleRoot get merkle root
 func (fmt *FixedMerkleTree) GetMerkleRoot() string {
 	return fmt.GetMerkleTree().GetRoot()
 }
 
+// GetMerkleRootConcurrent get merkle root computed by up to workers goroutines.
+// Both halves of the tree are independent until the top hash, so they are reduced concurrently, recursively while the budget allows.
+// The root is identical to GetMerkleRoot.
+func (fmt *FixedMerkleTree) GetMerkleRootConcurrent(workers int) string {
+	fmt.ensureLeaves()
+	mhash := fmt.pairHash()
+	if mhash == nil {
+		mhash = MHash
+	}
+	return reduceMerkleRoot(fmt.leafCount(), fmt.leafRoot, workers, mhash)
+}
+
+// reduceMerkleRoot computes the root of count leaves hashing pairs with mhash, the same way as MerkleTree:
+// the last node of a level with an odd count is hashed with itself, a single leaf included.
+// The halves are only reduced concurrently when count is a power of two, elsewhere they wouldn't split on a level boundary.
+func reduceMerkleRoot(count int, leafHash func(i int) string, workers int, mhash func(left, right string) string) string {
+	if count <= 0 {
+		return ""
+	}
+	if count == 1 {
+		return mhash(leafHash(0), leafHash(0))
+	}
+	if count&(count-1) != 0 {
+		workers = 1
+	}
+	var reduce func(start, end, budget int) string
+	reduce = func(start, end, budget int) string {
+		if budget <= 1 || end-start == 1 {
+			level := make([]string, 0, end-start+1)
+			for i := start; i < end; i++ {
+				level = append(level, leafHash(i))
+			}
+			for depth := DepthForLeaves(len(level)); depth > 1; depth-- {
+				if len(level)%2 == 1 {
+					level = append(level, level[len(level)-1])
+				}
+				for i := 0; i < len(level)/2; i++ {
+					level[i] = mhash(level[2*i], level[2*i+1])
+				}
+				level = level[:len(level)/2]
+			}
+			return level[0]
+		}
+
+		mid := start + (end-start)/2
+		left := make(chan string, 1)
+		go func() {
+			left <- reduce(start, mid, budget/2)
+		}()
+		right := reduce(mid, end, budget-budget/2)
+		return mhash(<-left, right)
+	}
+	return reduce(0, count, workers)
+}
+
+// LeafChanges number of leaves differing between two versions of the same data
+type LeafChanges struct {
+	Changed int
+	Total   int
+	// Percent share of changed leaves, from 0 to 100
+	Percent float64
+}
+
+// CompareLeaves counts the leaves whose root differs between fmt and other, e.g. to see if a new version of a file
+// could be stored by patching the changed parts. Both trees must have the same chunk size and number of leaves.
+func (fmt *FixedMerkleTree) CompareLeaves(other *FixedMerkleTree) (LeafChanges, error) {
+	if fmt.ChunkSize != other.ChunkSize {
+		return LeafChanges{}, errors.Newf("invalid_merkle_tree", "chunk sizes %v and %v differ", fmt.ChunkSize, other.ChunkSize)
+	}
+	if fmt.leafCount() != other.leafCount() {
+		return LeafChanges{}, errors.Newf("invalid_merkle_tree", "leaf counts %v and %v differ", fmt.leafCount(), other.leafCount())
+	}
+	changes := LeafChanges{Total: fmt.leafCount()}
+	for i := 0; i < fmt.leafCount(); i++ {
+		if fmt.leafRoot(i) != other.leafRoot(i) {
+			changes.Changed++
+		}
+	}
+	if changes.Total > 0 {
+		changes.Percent = float64(changes.Changed) * 100 / float64(changes.Total)
+	}
+	return changes, nil
+}
+
+// RootCheck is called with the hex merkle root once it is computed, a non-nil error rejects the root
+type RootCheck func(root string) error
+
+// GetCheckedMerkleRoot computes the merkle root and passes it to check before returning it,
+// so a caller can compare it with the root reported by the first responding blobber and abort the commit on mismatch.
+func (fmt *FixedMerkleTree) GetCheckedMerkleRoot(check RootCheck) (string, error) {
+	root := fmt.GetMerkleRoot()
+	if check == nil {
+		return root, nil
+	}
+	if err := check(root); err != nil {
+		return "", errors.Wrap(errors.New("merkle_root_rejected", "merkle root "+root+" is rejected"), err)
+	}
+	return root, nil
+}
+
+// GetSubTreeRoot get the merkle root of the leaves covering the bytes [start, end) of a chunk.
+// Leaf i holds bytes [i*ChunkSize/1024, (i+1)*ChunkSize/1024) of every chunk, so an unaligned range is widened to the leaves it touches.
+// The leaves are hashed with the same MHash scheme as the full tree: when they are 2^k leaves starting at a multiple of 2^k,
+// the sub root is the internal node of GetMerkleTree covering them, and a single leaf is its own root.
+func (fmt *FixedMerkleTree) GetSubTreeRoot(start, end int) (string, error) {
+	merkleChunkSize := fmt.ChunkSize / FixedMerkleLeaves
+	if merkleChunkSize == 0 {
+		merkleChunkSize = 1
+	}
+	if start < 0 || end <= start || end > merkleChunkSize*FixedMerkleLeaves {
+		return "", errors.Newf("invalid_range", "range [%v, %v) is out of the chunk bounds", start, end)
+	}
+	fmt.ensureLeaves()
+
+	firstLeaf := start / merkleChunkSize
+	lastLeaf := (end + merkleChunkSize - 1) / merkleChunkSize
+	if lastLeaf-firstLeaf == 1 {
+		return fmt.leafRoot(firstLeaf), nil
+	}
+
+	merkleLeaves := make([]Hashable, 0, lastLeaf-firstLeaf)
+	for i := firstLeaf; i < lastLeaf; i++ {
+		merkleLeaves = append(merkleLeaves, NewStringHashable(fmt.leafRoot(i)))
+	}
+	var mt MerkleTreeI = &MerkleTree{hash: fmt.pairHash()}
+	mt.ComputeTree(merkleLeaves)
+	return mt.GetRoot(), nil
+}
+
+// fixedMerkleTreeState the state of a FixedMerkleTree written by Save
+type fixedMerkleTreeState struct {
+	ChunkSize  int                  `json:"chunk_size"`
+	Leaves     []*CompactMerkleTree `json:"leaves"`
+	MerkleRoot string               `json:"merkle_root"`
+}
+
+// Save writes the chunk size, the state of every leaf and the merkle root computed on them, so the tree can be
+// restored by Load, e.g. to resume an upload, and go on with the next chunks without reading the data hashed so far again.
+func (fmt *FixedMerkleTree) Save(w io.Writer) error {
+	if fmt.IsCompacted() {
+		return ErrMerkleTreeCompacted
+	}
+	fmt.ensureLeaves()
+	state := fixedMerkleTreeState{ChunkSize: fmt.ChunkSize, Leaves: fmt.Leaves, MerkleRoot: fmt.GetMerkleRoot()}
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		return errors.Wrap(err, "failed to convert JSON.")
+	}
+	return nil
+}
+
+// Load restores the tree saved by Save into a tree with the same hash. The saved root is checked against the one
+// of the loaded leaves, a corrupted state is rejected and leaves the tree unchanged.
+func (fmt *FixedMerkleTree) Load(r io.Reader) error {
+	var state fixedMerkleTreeState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return errors.Wrap(err, "invalid merkle tree state.")
+	}
+	if len(state.Leaves) != FixedMerkleLeaves {
+		return errors.Newf("invalid_merkle_tree", "saved tree has %v leaves instead of %v", len(state.Leaves), FixedMerkleLeaves)
+	}
+	loaded := &FixedMerkleTree{ChunkSize: state.ChunkSize, Leaves: state.Leaves, newHash: fmt.newHash}
+	for _, leaf := range state.Leaves {
+		if leaf == nil {
+			return errors.New("invalid_merkle_tree", "saved tree has an empty leaf")
+		}
+		leaf.Hash = loaded.pairHash()
+	}
+	if root := loaded.GetMerkleRoot(); root != state.MerkleRoot {
+		return errors.Newf("invalid_merkle_tree", "saved root %v doesn't match the leaves root %v", state.MerkleRoot, root)
+	}
+	*fmt = *loaded
+	return nil
+}
+
 // Reload reset and reload leaves from io.Reader
 func (fmt *FixedMerkleTree) Reload(reader io.Reader) error {
 
 	fmt.initLeaves()
 
+	_, err := fmt.WriteFrom(reader)
+	return err
+}
+
+// VerifyFileMerkleRoot hashes all the data of r in a tree with the default hashes and 64KB chunks, and tells
+// if its root is expectedRoot, e.g. to check a reassembled download in one call. Only a read error is returned as an error.
+func VerifyFileMerkleRoot(r io.Reader, expectedRoot string) (bool, error) {
+	fmt := NewFixedMerkleTree(defaultLeafBlockSize * FixedMerkleLeaves)
+	if err := fmt.Reload(r); err != nil {
+		return false, err
+	}
+	return fmt.GetMerkleRoot() == expectedRoot, nil
+}
+
+// WriteFrom writes the data read from reader to the tree in chunks of ChunkSize, following the chunks already written
+// which must all be whole, and returns the number of bytes written. Only the last chunk read may be short, as with Write.
+// On a read error the bytes read since the last whole chunk are dropped and not counted.
+func (fmt *FixedMerkleTree) WriteFrom(reader io.Reader) (int64, error) {
+	if fmt.IsCompacted() {
+		return 0, ErrMerkleTreeCompacted
+	}
+	fmt.ensureLeaves()
+	// the first leaf gets data from every chunk
+	first := 0
+	if fmt.Leaves[0].Initialized {
+		first = fmt.Leaves[0].LastIndex + 1
+	}
+
+	var total int64
 	bytesBuf := bytes.NewBuffer(make([]byte, 0, fmt.ChunkSize))
-	for i := 0; ; i++ {
+	for i := first; ; i++ {
 		written, err := io.CopyN(bytesBuf, reader, int64(fmt.ChunkSize))
 
-		if written > 0 {
-			err = fmt.Write(bytesBuf.Bytes(), i)
-			bytesBuf.Reset()
+		// a read error leaves a partial chunk which must not be hashed as the last one
+		if err != nil && !errors.Is(err, io.EOF) {
+			return total, err
+		}
 
-			if err != nil {
-				return err
+		if written > 0 {
+			if err := fmt.Write(bytesBuf.Bytes(), i); err != nil {
+				return total, err
 			}
-
+			total += written
+			bytesBuf.Reset()
 		}
 
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-
-			return err
+			break
 		}
-
 	}
 
-	return nil
+	return total, nil
 }
@@ -1,9 +1,19 @@
 package util
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
 	"math/rand"
+	"runtime"
+	"strconv"
 	"testing"
+	"testing/iotest"
 
+	"github.com/0chain/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -54,3 +64,677 @@ func GenerateRandomBytes(n int) []byte {
 
 	return b
 }
+
+func TestFixedMerkleTreeGetSubTreeRoot(t *testing.T) {
+	const chunkSize = 64 * 1024
+	const merkleChunkSize = chunkSize / 1024
+
+	mt := NewFixedMerkleTree(chunkSize)
+	require.Nil(t, mt.Write(GenerateRandomBytes(chunkSize), 0))
+
+	leafRoot := func(i int) string {
+		return mt.Leaves[i].GetMerkleRoot()
+	}
+
+	t.Run("single leaf", func(t *testing.T) {
+		root, err := mt.GetSubTreeRoot(5*merkleChunkSize, 6*merkleChunkSize)
+		require.Nil(t, err)
+		require.Equal(t, leafRoot(5), root)
+	})
+
+	t.Run("aligned pair", func(t *testing.T) {
+		root, err := mt.GetSubTreeRoot(2*merkleChunkSize, 4*merkleChunkSize)
+		require.Nil(t, err)
+		require.Equal(t, MHash(leafRoot(2), leafRoot(3)), root)
+	})
+
+	t.Run("aligned halves combine to the full root", func(t *testing.T) {
+		left, err := mt.GetSubTreeRoot(0, chunkSize/2)
+		require.Nil(t, err)
+		right, err := mt.GetSubTreeRoot(chunkSize/2, chunkSize)
+		require.Nil(t, err)
+		require.Equal(t, mt.GetMerkleRoot(), MHash(left, right))
+
+		full, err := mt.GetSubTreeRoot(0, chunkSize)
+		require.Nil(t, err)
+		require.Equal(t, mt.GetMerkleRoot(), full)
+	})
+
+	t.Run("unaligned range is widened to the touched leaves", func(t *testing.T) {
+		root, err := mt.GetSubTreeRoot(merkleChunkSize/2, 3*merkleChunkSize-1)
+		require.Nil(t, err)
+		require.Equal(t, MHash(MHash(leafRoot(0), leafRoot(1)), MHash(leafRoot(2), leafRoot(2))), root)
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		_, err := mt.GetSubTreeRoot(0, chunkSize+1)
+		require.NotNil(t, err)
+		_, err = mt.GetSubTreeRoot(10, 10)
+		require.NotNil(t, err)
+	})
+}
+
+func TestFixedMerkleTreeGetCheckedMerkleRoot(t *testing.T) {
+	mt := NewFixedMerkleTree(64 * 1024)
+	require.NoError(t, mt.Write(GenerateRandomBytes(64*1024), 0))
+	expected := mt.GetMerkleRoot()
+
+	root, err := mt.GetCheckedMerkleRoot(func(root string) error {
+		require.Equal(t, expected, root)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, root)
+
+	root, err = mt.GetCheckedMerkleRoot(func(root string) error {
+		if root != "blobber-root" {
+			return errors.New("root_mismatch", "blobber reported another root")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "root_mismatch")
+	require.Empty(t, root)
+}
+
+func TestFixedMerkleTreeGetMerkleRootConcurrent(t *testing.T) {
+	const chunkSize = 64 * 1024
+	mt := NewFixedMerkleTree(chunkSize)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, mt.Write(GenerateRandomBytes(chunkSize), i))
+	}
+	require.NoError(t, mt.Write(GenerateRandomBytes(100), 3))
+
+	expected := mt.GetMerkleRoot()
+	for _, workers := range []int{0, 1, 2, 3, 8, 2048} {
+		require.Equal(t, expected, mt.GetMerkleRootConcurrent(workers), workers)
+	}
+}
+
+func benchmarkLeafHashes(count int) []Hashable {
+	leaves := make([]Hashable, count)
+	for i := range leaves {
+		leaves[i] = NewStringHashable(Hash(strconv.Itoa(i)))
+	}
+	return leaves
+}
+
+func TestReduceMerkleRootOddCounts(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 5, 6, 1023, 1024} {
+		leaves := benchmarkLeafHashes(count)
+		mt := &MerkleTree{}
+		mt.ComputeTree(leaves)
+		for _, workers := range []int{1, 4} {
+			root := reduceMerkleRoot(count, func(i int) string { return leaves[i].GetHash() }, workers, MHash)
+			require.Equal(t, mt.GetRoot(), root, count)
+		}
+	}
+
+	h := func(i int) string { return strconv.Itoa(i) }
+	require.Equal(t, MHash("0", "0"), reduceMerkleRoot(1, h, 1, MHash))
+	require.Equal(t, MHash(MHash("0", "1"), MHash("2", "2")), reduceMerkleRoot(3, h, 1, MHash))
+	require.Equal(t, MHash(MHash(MHash("0", "1"), MHash("2", "3")), MHash(MHash("4", "4"), MHash("4", "4"))), reduceMerkleRoot(5, h, 1, MHash))
+	require.Empty(t, reduceMerkleRoot(0, h, 1, MHash))
+}
+
+func BenchmarkMerkleRootSerial(b *testing.B) {
+	for _, count := range []int{1024, 16384} {
+		leaves := benchmarkLeafHashes(count)
+		b.Run(strconv.Itoa(count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mt := &MerkleTree{}
+				mt.ComputeTree(leaves)
+				mt.GetRoot()
+			}
+		})
+	}
+}
+
+func BenchmarkMerkleRootConcurrent(b *testing.B) {
+	for _, count := range []int{1024, 16384} {
+		leaves := benchmarkLeafHashes(count)
+		b.Run(strconv.Itoa(count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				reduceMerkleRoot(count, func(i int) string { return leaves[i].GetHash() }, 8, MHash)
+			}
+		})
+	}
+}
+
+func TestFixedMerkleTreeCompareLeaves(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(4 * chunkSize)
+	edited := make([]byte, len(data))
+	copy(edited, data)
+	// a 10 bytes edit in the third chunk touches a single leaf
+	for i := 2*chunkSize + 100; i < 2*chunkSize+110; i++ {
+		edited[i]++
+	}
+
+	v1 := NewFixedMerkleTree(chunkSize)
+	require.NoError(t, v1.Reload(bytes.NewReader(data)))
+	v2 := NewFixedMerkleTree(chunkSize)
+	require.NoError(t, v2.Reload(bytes.NewReader(edited)))
+
+	changes, err := v1.CompareLeaves(v2)
+	require.NoError(t, err)
+	require.Equal(t, 1024, changes.Total)
+	require.Equal(t, 1, changes.Changed)
+	require.Less(t, changes.Percent, 1.0)
+
+	changes, err = v1.CompareLeaves(v1)
+	require.NoError(t, err)
+	require.Zero(t, changes.Changed)
+
+	_, err = v1.CompareLeaves(NewFixedMerkleTree(1024))
+	require.Error(t, err)
+	broken := NewFixedMerkleTree(chunkSize)
+	broken.Leaves = broken.Leaves[:512]
+	_, err = v1.CompareLeaves(broken)
+	require.Error(t, err)
+}
+
+// flakyReader returns an error once after failAt bytes, then goes on
+type flakyReader struct {
+	r      io.Reader
+	read   int
+	failAt int
+	failed bool
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if !f.failed && f.read+len(p) > f.failAt {
+		p = p[:f.failAt-f.read]
+		n, _ := f.r.Read(p)
+		f.read += n
+		f.failed = true
+		return n, errors.New("read_failed", "simulated read failure")
+	}
+	n, err := f.r.Read(p)
+	f.read += n
+	return n, err
+}
+
+func TestFixedMerkleTreeReloadBoundaries(t *testing.T) {
+	const chunkSize = 64 * 1024
+	for _, size := range []int{1, 7, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 3*chunkSize + 1} {
+		data := GenerateRandomBytes(size)
+
+		// one Write per chunk, as on upload
+		expected := NewFixedMerkleTree(chunkSize)
+		for i := 0; i*chunkSize < size; i++ {
+			end := (i + 1) * chunkSize
+			if end > size {
+				end = size
+			}
+			require.NoError(t, expected.Write(data[i*chunkSize:end], i))
+		}
+
+		for name, reader := range map[string]io.Reader{
+			"reader":    bytes.NewReader(data),
+			"one byte":  iotest.OneByteReader(bytes.NewReader(data)),
+			"data+EOF":  iotest.DataErrReader(bytes.NewReader(data)),
+			"half read": iotest.HalfReader(bytes.NewReader(data)),
+		} {
+			mt := NewFixedMerkleTree(chunkSize)
+			require.NoError(t, mt.Reload(reader), "%v %v", size, name)
+			require.Equal(t, expected.GetMerkleRoot(), mt.GetMerkleRoot(), "%v %v", size, name)
+		}
+	}
+}
+
+func TestFixedMerkleTreeReloadReadError(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(3 * chunkSize)
+
+	mt := NewFixedMerkleTree(chunkSize)
+	err := mt.Reload(&flakyReader{r: bytes.NewReader(data), failAt: chunkSize + 100})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "simulated read failure")
+}
+
+func TestFixedMerkleTreeFinalBlockLeafSizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunkSize  int
+		totalSize  int64
+		fullLeaves int
+		lastLeaf   int
+	}{
+		{name: "empty", chunkSize: 64 * 1024, totalSize: 0},
+		{name: "one byte", chunkSize: 64 * 1024, totalSize: 1, lastLeaf: 1},
+		{name: "short leaf", chunkSize: 64 * 1024, totalSize: 63, lastLeaf: 63},
+		{name: "one leaf", chunkSize: 64 * 1024, totalSize: 64, fullLeaves: 1},
+		{name: "leaf and a byte", chunkSize: 64 * 1024, totalSize: 65, fullLeaves: 1, lastLeaf: 1},
+		{name: "not a multiple of 64", chunkSize: 64 * 1024, totalSize: 1000, fullLeaves: 15, lastLeaf: 40},
+		{name: "full chunk", chunkSize: 64 * 1024, totalSize: 64 * 1024, fullLeaves: 1024},
+		{name: "chunk minus a byte", chunkSize: 64 * 1024, totalSize: 64*1024 - 1, fullLeaves: 1023, lastLeaf: 63},
+		{name: "after full chunks", chunkSize: 64 * 1024, totalSize: 3*64*1024 + 130, fullLeaves: 2, lastLeaf: 2},
+		{name: "multiple full chunks", chunkSize: 64 * 1024, totalSize: 2 * 64 * 1024, fullLeaves: 1024},
+		{name: "chunk smaller than 1024", chunkSize: 1000, totalSize: 1500, fullLeaves: 500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mt := NewFixedMerkleTree(test.chunkSize)
+			leafSize := mt.leafBlockSize()
+
+			expected := make([]int, 1024)
+			for i := 0; i < test.fullLeaves; i++ {
+				expected[i] = leafSize
+			}
+			if test.lastLeaf > 0 {
+				expected[test.fullLeaves] = test.lastLeaf
+			}
+			require.Equal(t, expected, mt.FinalBlockLeafSizes(test.totalSize))
+		})
+	}
+}
+
+func TestFixedMerkleTreeGetMerklePath(t *testing.T) {
+	ft := NewFixedMerkleTree(64 * 1024)
+	require.NoError(t, ft.Write(GenerateRandomBytes(64*1024), 0))
+	root := ft.GetMerkleRoot()
+
+	for i := 0; i < 1024; i++ {
+		path, err := ft.GetMerklePath(i)
+		require.NoError(t, err)
+		require.Equal(t, root, path.RootHash)
+		require.Len(t, path.Nodes, 10)
+		require.True(t, path.VerifyMerklePath(), "leaf %v", i)
+	}
+
+	path, err := ft.GetMerklePath(5)
+	require.NoError(t, err)
+	tampered := path
+	tampered.Nodes = append([]string(nil), path.Nodes...)
+	tampered.Nodes[3] = Hash("tampered")
+	require.False(t, tampered.VerifyMerklePath())
+	tampered = path
+	tampered.LeafInd = 4
+	require.False(t, tampered.VerifyMerklePath())
+	tampered = path
+	tampered.LeafHash = ft.Leaves[6].GetMerkleRoot()
+	require.False(t, tampered.VerifyMerklePath())
+
+	for _, i := range []int{-1, 1024} {
+		_, err = ft.GetMerklePath(i)
+		require.Error(t, err)
+	}
+}
+
+func TestFixedMerkleTreeGetMerkleTree(t *testing.T) {
+	ft := NewFixedMerkleTree(64 * 1024)
+	require.NoError(t, ft.Write(GenerateRandomBytes(64*1024), 0))
+
+	mt := ft.GetMerkleTree()
+	require.Equal(t, ft.GetMerkleRoot(), mt.GetRoot())
+	tree := mt.GetTree()
+	// 1024 leaves, then 512, 256... up to the root
+	require.Len(t, tree, 2047)
+	for i, leaf := range ft.Leaves {
+		require.Equal(t, leaf.GetMerkleRoot(), tree[i])
+	}
+	require.Equal(t, MHash(tree[0], tree[1]), tree[1024])
+	require.Equal(t, mt.GetRoot(), tree[len(tree)-1])
+
+	loaded := &MerkleTree{}
+	require.NoError(t, loaded.SetTree(1024, tree))
+	require.Equal(t, mt.GetRoot(), loaded.GetRoot())
+}
+
+func TestFixedMerkleTreeSaveLoad(t *testing.T) {
+	chunkSize := 64 * 1024
+	chunks := [][]byte{GenerateRandomBytes(chunkSize), GenerateRandomBytes(chunkSize), GenerateRandomBytes(chunkSize / 3)}
+
+	full := NewFixedMerkleTree(chunkSize)
+	for i, chunk := range chunks {
+		require.NoError(t, full.Write(chunk, i))
+	}
+
+	// save after the first two chunks, then resume with the last one
+	ft := NewFixedMerkleTree(chunkSize)
+	require.NoError(t, ft.Write(chunks[0], 0))
+	require.NoError(t, ft.Write(chunks[1], 1))
+	var buf bytes.Buffer
+	require.NoError(t, ft.Save(&buf))
+	saved := buf.String()
+
+	loaded := &FixedMerkleTree{}
+	require.NoError(t, loaded.Load(&buf))
+	require.Equal(t, chunkSize, loaded.ChunkSize)
+	require.Equal(t, ft.GetMerkleRoot(), loaded.GetMerkleRoot())
+	require.NoError(t, loaded.Write(chunks[2], 2))
+	require.Equal(t, full.GetMerkleRoot(), loaded.GetMerkleRoot())
+
+	t.Run("corrupted state", func(t *testing.T) {
+		tampered := &FixedMerkleTree{}
+		var state fixedMerkleTreeState
+		require.NoError(t, json.Unmarshal([]byte(saved), &state))
+		state.MerkleRoot = Hash("other")
+		by, err := json.Marshal(state)
+		require.NoError(t, err)
+		require.Error(t, tampered.Load(bytes.NewReader(by)))
+		require.Nil(t, tampered.Leaves)
+
+		state.Leaves = state.Leaves[:10]
+		by, err = json.Marshal(state)
+		require.NoError(t, err)
+		require.Error(t, tampered.Load(bytes.NewReader(by)))
+
+		require.Error(t, tampered.Load(bytes.NewReader([]byte("{"))))
+	})
+}
+
+func TestNewFixedMerkleTreeWithHash(t *testing.T) {
+	chunkSize := 64 * 1024
+	data := GenerateRandomBytes(chunkSize)
+
+	build := func(newHash func() hash.Hash) *FixedMerkleTree {
+		ft := NewFixedMerkleTree(chunkSize)
+		if newHash != nil {
+			ft = NewFixedMerkleTreeWithHash(chunkSize, newHash)
+		}
+		require.NoError(t, ft.Write(data, 0))
+		return ft
+	}
+
+	def := build(nil)
+	ft := build(sha256.New)
+	root := ft.GetMerkleRoot()
+	require.NotEqual(t, def.GetMerkleRoot(), root)
+	require.Equal(t, root, build(sha256.New).GetMerkleRoot())
+	require.Equal(t, root, ft.GetMerkleRootConcurrent(4))
+
+	// the leaves and the nodes are all hashed with sha256
+	hashHex := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	// a leaf of a single block is its hash paired with itself
+	leafRoot := func(i int) string {
+		block := hashHex(data[i*64 : (i+1)*64])
+		return hashHex([]byte(block + block))
+	}
+	level := make([]string, 1024)
+	for i := range level {
+		level[i] = leafRoot(i)
+	}
+	for len(level) > 1 {
+		for i := 0; i < len(level)/2; i++ {
+			level[i] = hashHex([]byte(level[2*i] + level[2*i+1]))
+		}
+		level = level[:len(level)/2]
+	}
+	require.Equal(t, level[0], root)
+
+	path, err := ft.GetMerklePath(100)
+	require.NoError(t, err)
+	require.True(t, path.VerifyMerklePath())
+	require.True(t, ft.GetMerkleTree().VerifyPath(NewStringHashable(path.LeafHash), &MTPath{Nodes: path.Nodes, LeafIndex: 100}))
+
+	var buf bytes.Buffer
+	require.NoError(t, ft.Save(&buf))
+	saved := buf.Bytes()
+	loaded := NewFixedMerkleTreeWithHash(0, sha256.New)
+	require.NoError(t, loaded.Load(bytes.NewReader(saved)))
+	require.Equal(t, root, loaded.GetMerkleRoot())
+	// the root doesn't match with another hash
+	require.Error(t, (&FixedMerkleTree{}).Load(bytes.NewReader(saved)))
+}
+
+func TestVerifyBlock(t *testing.T) {
+	chunkSize := 64 * 1024
+	chunks := [][]byte{GenerateRandomBytes(chunkSize), GenerateRandomBytes(chunkSize), GenerateRandomBytes(chunkSize)}
+	leafData := func(i int, chunks [][]byte) []byte {
+		var data []byte
+		for _, chunk := range chunks {
+			data = append(data, chunk[i*64:(i+1)*64]...)
+		}
+		return data
+	}
+
+	t.Run("single chunk", func(t *testing.T) {
+		ft := NewFixedMerkleTree(chunkSize)
+		require.NoError(t, ft.Write(chunks[0], 0))
+		for _, i := range []int{0, 1, 511, 1023} {
+			path, err := ft.GetMerklePath(i)
+			require.NoError(t, err)
+			require.True(t, VerifyBlock(chunks[0][i*64:(i+1)*64], path), "leaf %v", i)
+		}
+	})
+
+	t.Run("several chunks", func(t *testing.T) {
+		ft := NewFixedMerkleTree(chunkSize)
+		for i, chunk := range chunks {
+			require.NoError(t, ft.Write(chunk, i))
+		}
+		path, err := ft.GetMerklePath(42)
+		require.NoError(t, err)
+		data := leafData(42, chunks)
+		require.True(t, VerifyBlock(data, path))
+
+		// the data of another leaf, partial or tampered data are rejected
+		require.False(t, VerifyBlock(leafData(43, chunks), path))
+		require.False(t, VerifyBlock(data[:128], path))
+		tampered := append([]byte(nil), data...)
+		tampered[100] ^= 1
+		require.False(t, VerifyBlock(tampered, path))
+		require.False(t, VerifyBlock(nil, path))
+
+		// a path leading to another root is rejected
+		other := path
+		other.RootHash = Hash("other")
+		require.False(t, VerifyBlock(data, other))
+	})
+}
+
+func TestFixedMerkleTreeWriteFrom(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(3*chunkSize + 500)
+	expected := NewFixedMerkleTree(chunkSize)
+	require.NoError(t, expected.Reload(bytes.NewReader(data)))
+
+	mt := NewFixedMerkleTree(chunkSize)
+	n, err := mt.WriteFrom(iotest.HalfReader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, expected.GetMerkleRoot(), mt.GetMerkleRoot())
+
+	// a stream written in parts goes on from the next chunk
+	mt = &FixedMerkleTree{ChunkSize: chunkSize}
+	n, err = mt.WriteFrom(bytes.NewReader(data[:2*chunkSize]))
+	require.NoError(t, err)
+	require.Equal(t, int64(2*chunkSize), n)
+	n, err = mt.WriteFrom(bytes.NewReader(data[2*chunkSize:]))
+	require.NoError(t, err)
+	require.Equal(t, int64(chunkSize+500), n)
+	require.Equal(t, expected.GetMerkleRoot(), mt.GetMerkleRoot())
+
+	// only the whole chunks read before the failure are counted
+	mt = NewFixedMerkleTree(chunkSize)
+	n, err = mt.WriteFrom(&flakyReader{r: bytes.NewReader(data), failAt: chunkSize + 100})
+	require.Error(t, err)
+	require.Equal(t, int64(chunkSize), n)
+}
+
+func TestVerifyFileMerkleRoot(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(2*chunkSize + 700)
+	mt := NewFixedMerkleTree(chunkSize)
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		require.NoError(t, mt.Write(data[i*chunkSize:end], i))
+	}
+	root := mt.GetMerkleRoot()
+
+	ok, err := VerifyFileMerkleRoot(bytes.NewReader(data), root)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[chunkSize+10] ^= 0xff
+	ok, err = VerifyFileMerkleRoot(bytes.NewReader(corrupted), root)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// a truncated stream doesn't match either
+	ok, err = VerifyFileMerkleRoot(bytes.NewReader(data[:len(data)-1]), root)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = VerifyFileMerkleRoot(&flakyReader{r: bytes.NewReader(data), failAt: chunkSize + 100}, root)
+	require.Error(t, err)
+	require.False(t, ok)
+}
+
+func TestFixedMerkleTreeCompletedLeaves(t *testing.T) {
+	const chunkSize = 64 * 1024
+	mt := NewFixedMerkleTree(chunkSize)
+	leaves, err := mt.CompletedLeaves()
+	require.NoError(t, err)
+	require.Empty(t, leaves)
+
+	// two whole chunks and 100 bytes, which go to the leaves 0 and 1
+	data := GenerateRandomBytes(2*chunkSize + 100)
+	require.NoError(t, mt.Reload(bytes.NewReader(data)))
+	leaves, err = mt.CompletedLeaves()
+	require.NoError(t, err)
+	require.Len(t, leaves, FixedMerkleLeaves)
+	require.Equal(t, LeafRange{Index: 0, Hash: mt.Leaves[0].GetMerkleRoot(), Chunks: 3, Start: 0, End: 64}, leaves[0])
+	require.Equal(t, 3, leaves[1].Chunks)
+	require.Equal(t, LeafRange{Index: 2, Hash: mt.Leaves[2].GetMerkleRoot(), Chunks: 2, Start: 128, End: 192}, leaves[2])
+	require.Equal(t, int64(chunkSize-64), leaves[FixedMerkleLeaves-1].Start)
+	require.Equal(t, int64(chunkSize), leaves[FixedMerkleLeaves-1].End)
+
+	// the leaf hash covers its block of every chunk
+	leaf := NewCompactMerkleTree(nil)
+	for c := 0; c < 2; c++ {
+		require.NoError(t, leaf.AddDataBlocks(data[c*chunkSize+128:c*chunkSize+192], c))
+	}
+	require.Equal(t, leaf.GetMerkleRoot(), leaves[2].Hash)
+
+	require.NoError(t, mt.Compact())
+	_, err = mt.CompletedLeaves()
+	require.ErrorIs(t, err, ErrMerkleTreeCompacted)
+}
+
+func TestLeavesForSize(t *testing.T) {
+	for size, leaves := range map[int64]int{
+		-1:               0,
+		0:                0,
+		1:                1,
+		64:               1,
+		65:               2,
+		1000:             16,
+		64 * 1024:        FixedMerkleLeaves,
+		64*1024 - 1:      FixedMerkleLeaves,
+		64*1024 - 64:     FixedMerkleLeaves - 1,
+		10 * 1024 * 1024: FixedMerkleLeaves,
+	} {
+		require.Equal(t, leaves, LeavesForSize(size), size)
+	}
+}
+
+func TestDepthForLeaves(t *testing.T) {
+	for leaves, depth := range map[int]int{0: 0, 1: 1, 2: 2, 3: 3, 4: 3, 5: 4, 512: 10, 1000: 11, 1024: 11, 1025: 12} {
+		require.Equal(t, depth, DepthForLeaves(leaves), leaves)
+	}
+	require.Equal(t, FixedMTDepth, DepthForLeaves(FixedMerkleLeaves))
+
+	// the path of a leaf has a sibling per level under the root
+	tree := NewFixedMerkleTree(64 * 1024)
+	require.NoError(t, tree.Write(GenerateRandomBytes(64*1024), 0))
+	path, err := tree.GetMerklePath(3)
+	require.NoError(t, err)
+	require.Len(t, path.Nodes, FixedMTDepth-1)
+	require.True(t, path.VerifyMerklePath())
+	short := path
+	short.Nodes = path.Nodes[:FixedMTDepth-2]
+	require.False(t, short.VerifyMerklePath())
+	require.Len(t, tree.GetMerkleTree().GetTree(), 2*FixedMerkleLeaves-1)
+	require.Equal(t, tree.GetMerkleRoot(), tree.GetMerkleRootConcurrent(4))
+}
+
+func TestFixedMerkleTreeCompact(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(3*chunkSize + 100)
+	for name, newTree := range map[string]func() *FixedMerkleTree{
+		"default": func() *FixedMerkleTree { return NewFixedMerkleTree(chunkSize) },
+		"sha256":  func() *FixedMerkleTree { return NewFixedMerkleTreeWithHash(chunkSize, sha256.New) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			tree := newTree()
+			require.NoError(t, tree.Reload(bytes.NewReader(data)))
+			root := tree.GetMerkleRoot()
+			path, err := tree.GetMerklePath(513)
+			require.NoError(t, err)
+			subRoot, err := tree.GetSubTreeRoot(0, chunkSize/2)
+			require.NoError(t, err)
+			uncompacted := newTree()
+			require.NoError(t, uncompacted.Reload(bytes.NewReader(data)))
+
+			require.False(t, tree.IsCompacted())
+			require.NoError(t, tree.Compact())
+			require.True(t, tree.IsCompacted())
+			require.Nil(t, tree.Leaves)
+			require.NoError(t, tree.Compact())
+
+			require.Equal(t, root, tree.GetMerkleRoot())
+			require.Equal(t, root, tree.GetMerkleRootConcurrent(4))
+			compactedPath, err := tree.GetMerklePath(513)
+			require.NoError(t, err)
+			require.Equal(t, path.LeafHash, compactedPath.LeafHash)
+			require.Equal(t, path.Nodes, compactedPath.Nodes)
+			require.True(t, compactedPath.VerifyMerklePath())
+			compactedSubRoot, err := tree.GetSubTreeRoot(0, chunkSize/2)
+			require.NoError(t, err)
+			require.Equal(t, subRoot, compactedSubRoot)
+			changes, err := tree.CompareLeaves(uncompacted)
+			require.NoError(t, err)
+			require.Zero(t, changes.Changed)
+
+			require.ErrorIs(t, tree.Write(data[:chunkSize], 4), ErrMerkleTreeCompacted)
+			_, err = tree.WriteFrom(bytes.NewReader(data))
+			require.ErrorIs(t, err, ErrMerkleTreeCompacted)
+			require.ErrorIs(t, tree.Save(io.Discard), ErrMerkleTreeCompacted)
+
+			// Reload starts over
+			require.NoError(t, tree.Reload(bytes.NewReader(data)))
+			require.False(t, tree.IsCompacted())
+			require.Equal(t, root, tree.GetMerkleRoot())
+		})
+	}
+}
+
+// BenchmarkFixedMerkleTreeCompact reports the heap held by a tree of a file of 64 chunks, with and without Compact
+func BenchmarkFixedMerkleTreeCompact(b *testing.B) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(64 * chunkSize)
+	for _, compact := range []bool{false, true} {
+		b.Run("compact="+strconv.FormatBool(compact), func(b *testing.B) {
+			trees := make([]*FixedMerkleTree, b.N)
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			for i := range trees {
+				trees[i] = NewFixedMerkleTree(chunkSize)
+				if err := trees[i].Reload(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+				if compact {
+					if err := trees[i].Compact(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/tree")
+			runtime.KeepAlive(trees)
+		})
+	}
+}
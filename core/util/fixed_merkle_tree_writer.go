@@ -0,0 +1,87 @@
+package util
+
+import (
+	goErrors "errors"
+	"sync"
+)
+
+// ErrMerkleTreeFinalized data is written after a short last chunk was flushed, it can't be part of the same stream
+var ErrMerkleTreeFinalized = goErrors.New("merkle: the last chunk is flushed, no more data can be written")
+
+// FixedMerkleTreeWriter buffers a stream of writes of any size into whole chunks for a FixedMerkleTree.
+// FixedMerkleTree.Write splits its input across the leaves starting from the first one, so a chunk must be written in a single call.
+// It is safe for concurrent use, a Write and the final flush of GetMerkleRoot don't interleave.
+type FixedMerkleTreeWriter struct {
+	mu         sync.Mutex
+	tree       *FixedMerkleTree
+	buf        []byte
+	chunkIndex int
+	// final a short chunk was flushed, it can only be the last one
+	final bool
+}
+
+// NewFixedMerkleTreeWriter create a writer feeding tree from chunk 0
+func NewFixedMerkleTreeWriter(tree *FixedMerkleTree) *FixedMerkleTreeWriter {
+	return &FixedMerkleTreeWriter{
+		tree: tree,
+		buf:  make([]byte, 0, tree.ChunkSize),
+	}
+}
+
+// Write implements io.Writer, full chunks are written to the tree as soon as they are complete
+// The writes don't need to be aligned, bytes short of a chunk stay buffered until the next Write or Flush.
+func (w *FixedMerkleTreeWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.final && len(p) > 0 {
+		return 0, ErrMerkleTreeFinalized
+	}
+	written := 0
+	for len(p) > 0 {
+		n := w.tree.ChunkSize - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(w.buf) == w.tree.ChunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush writes the buffered bytes to the tree as a chunk, it must be called once the stream ends so the last partial chunk is not lost.
+// A partial chunk ends the stream, writing after it fails with ErrMerkleTreeFinalized instead of shifting the next bytes across the leaves.
+func (w *FixedMerkleTreeWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *FixedMerkleTreeWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if err := w.tree.Write(w.buf, w.chunkIndex); err != nil {
+		return err
+	}
+	w.final = len(w.buf) < w.tree.ChunkSize
+	w.chunkIndex++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// GetMerkleRoot flushes the buffered bytes and returns the merkle root of the tree, so a root is never computed without the trailing data
+func (w *FixedMerkleTreeWriter) GetMerkleRoot() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.flush(); err != nil {
+		return "", err
+	}
+	return w.tree.GetMerkleRoot(), nil
+}
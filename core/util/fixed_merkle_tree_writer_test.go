@@ -0,0 +1,164 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedMerkleTreeWriter(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(3*chunkSize + 1000)
+
+	direct := NewFixedMerkleTree(chunkSize)
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		require.NoError(t, direct.Write(data[i*chunkSize:end], i))
+	}
+
+	for _, writeSize := range []int{1, 7, 1000, chunkSize, chunkSize + 1, len(data)} {
+		w := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+		for i := 0; i < len(data); i += writeSize {
+			end := i + writeSize
+			if end > len(data) {
+				end = len(data)
+			}
+			n, err := w.Write(data[i:end])
+			require.NoError(t, err)
+			require.Equal(t, end-i, n)
+		}
+		root, err := w.GetMerkleRoot()
+		require.NoError(t, err)
+		require.Equal(t, direct.GetMerkleRoot(), root, writeSize)
+	}
+}
+
+func TestFixedMerkleTreeWriterFinal(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(2*chunkSize + 100)
+
+	w := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	// the tree alone misses the 100 buffered bytes, the writer root includes them
+	partial := w.tree.GetMerkleRoot()
+	root, err := w.GetMerkleRoot()
+	require.NoError(t, err)
+	require.NotEqual(t, partial, root)
+
+	finalized := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+	_, err = finalized.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, finalized.Flush())
+	require.Equal(t, finalized.tree.GetMerkleRoot(), root)
+
+	// the short chunk ends the stream
+	_, err = w.Write([]byte{1})
+	require.ErrorIs(t, err, ErrMerkleTreeFinalized)
+	again, err := w.GetMerkleRoot()
+	require.NoError(t, err)
+	require.Equal(t, root, again)
+
+	// full chunks don't
+	full := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+	_, err = full.Write(data[:chunkSize])
+	require.NoError(t, err)
+	_, err = full.GetMerkleRoot()
+	require.NoError(t, err)
+	_, err = full.Write(data[chunkSize:])
+	require.NoError(t, err)
+}
+
+func TestFixedMerkleTreeWriterOddSizes(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(5*chunkSize + 333)
+
+	direct := NewFixedMerkleTree(chunkSize)
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		require.NoError(t, direct.Write(data[i*chunkSize:end], i))
+	}
+
+	// the writes straddle the chunk boundaries, only whole chunks reach the tree
+	w := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+	sizes := []int{3, chunkSize - 1, 5000, 1, chunkSize + 7, 63}
+	for off, i := 0, 0; off < len(data); i++ {
+		end := off + sizes[i%len(sizes)]
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err := w.Write(data[off:end])
+		require.NoError(t, err)
+		off = end
+		require.Equal(t, off/chunkSize, w.chunkIndex)
+		require.Len(t, w.buf, off%chunkSize)
+	}
+	root, err := w.GetMerkleRoot()
+	require.NoError(t, err)
+	require.Equal(t, direct.GetMerkleRoot(), root)
+}
+
+func TestFixedMerkleTreeWriterConcurrentRoot(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(4 * chunkSize)
+
+	w := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for off := 0; off < len(data); off += 1024 {
+			if _, err := w.Write(data[off : off+1024]); err != nil {
+				// the root flushed a short chunk first
+				require.ErrorIs(t, err, ErrMerkleTreeFinalized)
+				return
+			}
+		}
+	}()
+	root, err := w.GetMerkleRoot()
+	require.NoError(t, err)
+	<-done
+
+	// the root covers the writes done before it, none is cut by the flush
+	prefixRoot := func(size int) string {
+		pw := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+		_, err := pw.Write(data[:size])
+		require.NoError(t, err)
+		r, err := pw.GetMerkleRoot()
+		require.NoError(t, err)
+		return r
+	}
+	found := false
+	for size := 0; size <= len(data) && !found; size += 1024 {
+		found = prefixRoot(size) == root
+	}
+	require.True(t, found)
+}
+
+func BenchmarkFixedMerkleTreeSmallWrites(b *testing.B) {
+	const chunkSize = 64 * 1024
+	data := GenerateRandomBytes(16 * chunkSize)
+
+	b.Run("chunks", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mt := NewFixedMerkleTree(chunkSize)
+			for c := 0; c < 16; c++ {
+				_ = mt.Write(data[c*chunkSize:(c+1)*chunkSize], c)
+			}
+		}
+	})
+	b.Run("buffered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			w := NewFixedMerkleTreeWriter(NewFixedMerkleTree(chunkSize))
+			for off := 0; off < len(data); off += 512 {
+				_, _ = w.Write(data[off : off+512])
+			}
+			_ = w.Flush()
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -9,22 +11,51 @@ type MerkleTree struct {
 	tree        []string
 	leavesCount int
 	levels      int
+	// hash merkle hashing of a pair of child hashes, MHash if nil
+	hash func(left, right string) string
 }
 
 func VerifyMerklePath(hash string, path *MTPath, root string) bool {
+	return computeMerklePathRoot(hash, path, MHash) == root
+}
+
+// VerifyMerklePathAgainstRoots verifies the path against each of the accepted raw roots, e.g. while the root of a file is rotated.
+// It returns the index in roots of the first one matching, -1 when none matches.
+func VerifyMerklePathAgainstRoots(hash string, path *MTPath, roots [][]byte) (bool, int) {
+	mthash, err := hex.DecodeString(computeMerklePathRoot(hash, path, MHash))
+	if err != nil {
+		return false, -1
+	}
+	for i, root := range roots {
+		if bytes.Equal(mthash, root) {
+			return true, i
+		}
+	}
+	return false, -1
+}
+
+// computeMerklePathRoot computes the root the path leads to from the leaf hash, hashing pairs with mhash
+func computeMerklePathRoot(hash string, path *MTPath, mhash func(left, right string) string) string {
 	mthash := hash
 	pathNodes := path.Nodes
 	pl := len(pathNodes)
 	idx := path.LeafIndex
 	for i := 0; i < pl; i++ {
 		if idx&1 == 1 {
-			mthash = MHash(pathNodes[i], mthash)
+			mthash = mhash(pathNodes[i], mthash)
 		} else {
-			mthash = MHash(mthash, pathNodes[i])
+			mthash = mhash(mthash, pathNodes[i])
 		}
 		idx = (idx - idx&1) / 2
 	}
-	return mthash == root
+	return mthash
+}
+
+func (mt *MerkleTree) mhash(left, right string) string {
+	if mt.hash == nil {
+		return MHash(left, right)
+	}
+	return mt.hash(left, right)
 }
 
 func (mt *MerkleTree) computeSize(leaves int) (int, int) {
@@ -32,14 +63,11 @@ func (mt *MerkleTree) computeSize(leaves int) (int, int) {
 		return 2, 2
 	}
 	var tsize int
-	var levels int
 	for ll := leaves; ll > 1; ll = (ll + 1) / 2 {
 		tsize += ll
-		levels++
 	}
 	tsize++
-	levels++
-	return tsize, levels
+	return tsize, DepthForLeaves(leaves)
 }
 
 /*ComputeTree - given the leaf nodes, compute the merkle tree */
@@ -52,16 +80,16 @@ func (mt *MerkleTree) ComputeTree(hashes []Hashable) {
 		mt.tree[idx] = hashable.GetHash()
 	}
 	if len(hashes) == 1 {
-		mt.tree[1] = MHash(mt.tree[0], mt.tree[0])
+		mt.tree[1] = mt.mhash(mt.tree[0], mt.tree[0])
 		return
 	}
 	for pl0, plsize := 0, mt.leavesCount; plsize > 1; pl0, plsize = pl0+plsize, (plsize+1)/2 {
 		l0 := pl0 + plsize
 		for i, j := 0, 0; i < plsize; i, j = i+2, j+1 {
-			mt.tree[pl0+plsize+j] = MHash(mt.tree[pl0+i], mt.tree[pl0+i+1])
+			mt.tree[pl0+plsize+j] = mt.mhash(mt.tree[pl0+i], mt.tree[pl0+i+1])
 		}
 		if plsize&1 == 1 {
-			mt.tree[l0+plsize/2] = MHash(mt.tree[pl0+plsize-1], mt.tree[pl0+plsize-1])
+			mt.tree[l0+plsize/2] = mt.mhash(mt.tree[pl0+plsize-1], mt.tree[pl0+plsize-1])
 		}
 	}
 }
@@ -111,7 +139,7 @@ func (mt *MerkleTree) GetPath(hash Hashable) *MTPath {
 /*VerifyPath - given a leaf node and the path, verify that the node is part of the tree */
 func (mt *MerkleTree) VerifyPath(hash Hashable, path *MTPath) bool {
 	hs := hash.GetHash()
-	return VerifyMerklePath(hs, path, mt.GetRoot())
+	return computeMerklePathRoot(hs, path, mt.mhash) == mt.GetRoot()
 }
 
 /*GetPathByIndex - get the path of a leaf node at index i */
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/0chain/gosdk/core/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyMerklePathAgainstRoots(t *testing.T) {
+	newTree := func(prefix string) *MerkleTree {
+		leaves := make([]Hashable, 7)
+		for i := range leaves {
+			leaves[i] = NewStringHashable(encryption.Hash(prefix + strconv.Itoa(i)))
+		}
+		mt := &MerkleTree{}
+		mt.ComputeTree(leaves)
+		return mt
+	}
+	rawRoot := func(mt *MerkleTree) []byte {
+		root, err := hex.DecodeString(mt.GetRoot())
+		require.NoError(t, err)
+		return root
+	}
+	current := newTree("current")
+	previous := newTree("previous")
+	other := newTree("other")
+
+	leaf := encryption.Hash("current3")
+	path := current.GetPathByIndex(3)
+	require.True(t, VerifyMerklePath(leaf, path, current.GetRoot()))
+
+	ok, idx := VerifyMerklePathAgainstRoots(leaf, path, [][]byte{rawRoot(previous), rawRoot(current), rawRoot(other)})
+	require.True(t, ok)
+	require.Equal(t, 1, idx)
+
+	ok, idx = VerifyMerklePathAgainstRoots(leaf, path, [][]byte{rawRoot(previous), rawRoot(other)})
+	require.False(t, ok)
+	require.Equal(t, -1, idx)
+
+	ok, idx = VerifyMerklePathAgainstRoots(encryption.Hash("tampered"), path, [][]byte{rawRoot(previous), rawRoot(current)})
+	require.False(t, ok)
+	require.Equal(t, -1, idx)
+
+	ok, idx = VerifyMerklePathAgainstRoots(leaf, path, nil)
+	require.False(t, ok)
+	require.Equal(t, -1, idx)
+}
@@ -0,0 +1,121 @@
+package allocationchange
+
+import (
+	"path"
+	"strings"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// RenameItem one rename of a BatchRenameChange
+type RenameItem struct {
+	OldPath string `json:"old_path"`
+	NewName string `json:"new_name"`
+}
+
+// BatchRenameChange renames several objects in one change. The renames are applied in order,
+// a later one sees the paths left by the earlier ones, and the whole batch is validated first,
+// so an invalid rename fails the batch without touching the tree.
+type BatchRenameChange struct {
+	change
+	Renames []RenameItem
+}
+
+func (ch *BatchRenameChange) ProcessChange(rootRef *fileref.Ref) error {
+	if err := ch.validate(rootRef); err != nil {
+		return err
+	}
+	for _, r := range ch.Renames {
+		objectTree, err := findRef(rootRef, r.OldPath)
+		if err != nil {
+			return err
+		}
+		renameChange := &RenameFileChange{ObjectTree: objectTree, NewName: r.NewName}
+		if err := renameChange.ProcessChange(rootRef); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate replays the renames on the set of paths of the tree
+func (ch *BatchRenameChange) validate(rootRef *fileref.Ref) error {
+	if len(ch.Renames) == 0 {
+		return errors.New("invalid_batch", "No rename in the batch")
+	}
+	paths := make(map[string]bool)
+	collectPaths(rootRef, paths)
+	for _, r := range ch.Renames {
+		if err := validateNewName(r.NewName); err != nil {
+			return err
+		}
+		oldPath := path.Clean(r.OldPath)
+		if oldPath == "/" || !paths[oldPath] {
+			return errors.New("file_not_found", "Object "+r.OldPath+" to rename not found in blobber")
+		}
+		newPath := path.Join(path.Dir(oldPath), r.NewName)
+		if newPath == oldPath {
+			continue
+		}
+		if paths[newPath] {
+			return errors.New("rename_conflict", "Object "+newPath+" already exists")
+		}
+		for p := range paths {
+			if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+				delete(paths, p)
+				paths[newPath+strings.TrimPrefix(p, oldPath)] = true
+			}
+		}
+	}
+	return nil
+}
+
+func collectPaths(curRef *fileref.Ref, paths map[string]bool) {
+	for _, childRefEntity := range curRef.Children {
+		childRef := getRef(childRefEntity)
+		paths[childRef.Path] = true
+		if childRef.Type == fileref.DIRECTORY {
+			collectPaths(childRef, paths)
+		}
+	}
+}
+
+// findRef gets the ref at p under rootRef
+func findRef(rootRef *fileref.Ref, p string) (fileref.RefEntity, error) {
+	fields, err := common.GetPathFields(p)
+	if err != nil {
+		return nil, err
+	}
+	var ref fileref.RefEntity = rootRef
+	for _, field := range fields {
+		dirRef, ok := ref.(*fileref.Ref)
+		if !ok {
+			return nil, errors.New("invalid_reference_path", "Invalid reference path from the blobber")
+		}
+		ref = nil
+		for _, child := range dirRef.Children {
+			if child.GetName() == field {
+				ref = child
+				break
+			}
+		}
+		if ref == nil {
+			return nil, errors.New("file_not_found", "Object "+p+" not found in blobber")
+		}
+	}
+	return ref, nil
+}
+
+func (ch *BatchRenameChange) GetAffectedPath() []string {
+	affected := make([]string, 0, len(ch.Renames))
+	for _, r := range ch.Renames {
+		affected = append(affected, r.OldPath)
+	}
+	return affected
+}
+
+func (ch *BatchRenameChange) GetSize() int64 {
+	return int64(0)
+}
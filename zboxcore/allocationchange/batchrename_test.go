@@ -0,0 +1,54 @@
+package allocationchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchRenameChange(t *testing.T) {
+	rootRef := newTestTree()
+	ch := &BatchRenameChange{Renames: []RenameItem{
+		{OldPath: "/a", NewName: "z"},
+		{OldPath: "/z/d.txt", NewName: "f.txt"},
+		{OldPath: "/e.txt", NewName: "d.txt"},
+	}}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	for _, p := range []string{"/z/b/c.txt", "/z/f.txt", "/d.txt"} {
+		require.NotNil(t, findTestRef(rootRef, p), p)
+	}
+	for _, p := range []string{"/a", "/z/d.txt", "/e.txt"} {
+		require.Nil(t, findTestRef(rootRef, p), p)
+	}
+	require.Equal(t, []string{"/a", "/z/d.txt", "/e.txt"}, ch.GetAffectedPath())
+	require.NoError(t, validateRefTree(rootRef, map[string]bool{}))
+
+	// a rename freed by an earlier one of the batch is not a conflict
+	rootRef = newTestTree()
+	ch = &BatchRenameChange{Renames: []RenameItem{
+		{OldPath: "/e.txt", NewName: "g.txt"},
+		{OldPath: "/a", NewName: "e.txt"},
+	}}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	require.NotNil(t, findTestRef(rootRef, "/e.txt/b/c.txt"))
+}
+
+func TestBatchRenameChangeInvalid(t *testing.T) {
+	for name, renames := range map[string][]RenameItem{
+		"conflict":       {{OldPath: "/e.txt", NewName: "x.txt"}, {OldPath: "/a/d.txt", NewName: "b"}},
+		"not found":      {{OldPath: "/e.txt", NewName: "x.txt"}, {OldPath: "/e.txt", NewName: "y.txt"}},
+		"invalid name":   {{OldPath: "/e.txt", NewName: "x.txt"}, {OldPath: "/a/d.txt", NewName: "../d.txt"}},
+		"renamed parent": {{OldPath: "/a", NewName: "z"}, {OldPath: "/a/d.txt", NewName: "f.txt"}},
+		"empty":          nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rootRef := newTestTree()
+			ch := &BatchRenameChange{Renames: renames}
+			require.Error(t, ch.ProcessChange(rootRef))
+			// the tree is left unchanged
+			for _, p := range []string{"/a/b/c.txt", "/a/d.txt", "/e.txt"} {
+				require.NotNil(t, findTestRef(rootRef, p), p)
+			}
+		})
+	}
+}
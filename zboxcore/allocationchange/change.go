@@ -1,8 +1,10 @@
 package allocationchange
 
 import (
+	"path"
 	"strings"
 
+	"github.com/0chain/errors"
 	"github.com/0chain/gosdk/zboxcore/fileref"
 )
 
@@ -28,3 +30,92 @@ func getSubDirs(p string) []string {
 	}
 	return tSubDirs
 }
+
+func getRef(refEntity fileref.RefEntity) *fileref.Ref {
+	if refEntity.GetType() == fileref.FILE {
+		return &(refEntity.(*fileref.FileRef)).Ref
+	}
+	return refEntity.(*fileref.Ref)
+}
+
+// validateChildren checks that every child of curRef has a non empty path derived from curRef
+// and that no path is used twice, which would corrupt the tree once the hashes are recalculated.
+func validateChildren(curRef *fileref.Ref, seen map[string]bool) error {
+	for _, childRefEntity := range curRef.Children {
+		childRef := getRef(childRefEntity)
+		if childRef.Name == "" || childRef.Path != path.Join(curRef.Path, childRef.Name) {
+			return errors.Newf("invalid_ref_tree", "ref %v is not consistent with its parent %v", childRef.Path, curRef.Path)
+		}
+		if seen[childRef.Path] {
+			return errors.Newf("invalid_ref_tree", "path %v is used by more than one ref", childRef.Path)
+		}
+		seen[childRef.Path] = true
+	}
+	return nil
+}
+
+// validateRefTree runs the checks of validateChildren on the whole subtree under curRef
+func validateRefTree(curRef *fileref.Ref, seen map[string]bool) error {
+	if err := validateChildren(curRef, seen); err != nil {
+		return err
+	}
+	for _, childRefEntity := range curRef.Children {
+		childRef := getRef(childRefEntity)
+		if childRef.Type == fileref.DIRECTORY {
+			if err := validateRefTree(childRef, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessChanges applies the batch of changes on rootRef in order and returns the total size of the changes.
+func ProcessChanges(rootRef *fileref.Ref, changes []AllocationChange) (int64, error) {
+	var size int64
+	for _, change := range changes {
+		if err := change.ProcessChange(rootRef); err != nil {
+			return 0, err
+		}
+		size += change.GetSize()
+	}
+	return size, nil
+}
+
+// ValidateChanges checks the tree left by ProcessChanges where the batch touched it, i.e. the directories holding
+// the affected paths and the subtrees under them, so an inconsistent batch, e.g. two changes creating the same path,
+// can fail before its write marker is sent. The rest of the tree is not checked.
+func ValidateChanges(rootRef *fileref.Ref, changes []AllocationChange) error {
+	checked := make(map[string]bool)
+	for _, change := range changes {
+		for _, affected := range change.GetAffectedPath() {
+			affected = path.Clean(affected)
+			dir := path.Dir(affected)
+			if checked[affected] || affected == "/" {
+				continue
+			}
+			checked[affected] = true
+			dirRef, err := findRef(rootRef, dir)
+			if err != nil {
+				// removed by a later change of the batch
+				continue
+			}
+			parentRef, ok := dirRef.(*fileref.Ref)
+			if !ok || parentRef.Type != fileref.DIRECTORY {
+				return errors.Newf("invalid_ref_tree", "parent %v of %v is not a directory", dir, affected)
+			}
+			if err := validateChildren(parentRef, make(map[string]bool)); err != nil {
+				return errors.Wrap(err, "inconsistent batch of changes")
+			}
+			for _, childRefEntity := range parentRef.Children {
+				childRef := getRef(childRefEntity)
+				if childRef.Path == affected && childRef.Type == fileref.DIRECTORY {
+					if err := validateRefTree(childRef, map[string]bool{childRef.Path: true}); err != nil {
+						return errors.Wrap(err, "inconsistent batch of changes")
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
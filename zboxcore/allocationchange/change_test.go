@@ -0,0 +1,52 @@
+package allocationchange
+
+import (
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessChanges(t *testing.T) {
+	rootRef := newTestTree()
+	size, err := ProcessChanges(rootRef, []AllocationChange{
+		&NewFileChange{File: newTestFileRef("/f/g.txt", "g.txt", 6)},
+		&RenameFileChange{ObjectTree: findTestRef(rootRef, "/e.txt"), NewName: "h.txt"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), size)
+	require.NotNil(t, findTestRef(rootRef, "/f/g.txt"))
+	require.NotNil(t, findTestRef(rootRef, "/h.txt"))
+
+	require.NoError(t, ValidateChanges(rootRef, nil))
+
+	// the same path created twice
+	rootRef = newTestTree()
+	changes := []AllocationChange{
+		&NewFileChange{File: newTestFileRef("/f/g.txt", "g.txt", 6)},
+		&NewFileChange{File: newTestFileRef("/f/g.txt", "g.txt", 7)},
+	}
+	_, err = ProcessChanges(rootRef, changes)
+	require.NoError(t, err)
+	err = ValidateChanges(rootRef, changes)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "inconsistent batch of changes")
+}
+
+func TestValidateChangesTouchedSubtrees(t *testing.T) {
+	// an inconsistency outside of the paths of the batch is not checked
+	rootRef := newTestTree()
+	findTestRef(rootRef, "/a/b/c.txt").(*fileref.FileRef).Path = "/wrong/c.txt"
+	changes := []AllocationChange{&NewFileChange{File: newTestFileRef("/f/g.txt", "g.txt", 6)}}
+	_, err := ProcessChanges(rootRef, changes)
+	require.NoError(t, err)
+	require.NoError(t, ValidateChanges(rootRef, changes))
+
+	// the subtree of an affected directory is
+	rootRef = newTestTree()
+	findTestRef(rootRef, "/a/b/c.txt").(*fileref.FileRef).Path = "/wrong/c.txt"
+	changes = []AllocationChange{&RenameFileChange{ObjectTree: findTestRef(rootRef, "/e.txt"), NewName: "h.txt"}, &DirCreateChange{RemotePath: "/a"}}
+	_, err = ProcessChanges(rootRef, changes)
+	require.NoError(t, err)
+	require.Error(t, ValidateChanges(rootRef, changes))
+}
@@ -46,16 +46,13 @@ func (ch *CopyFileChange) ProcessChange(rootRef *fileref.Ref) error {
 
 	rootRef.HashToBeComputed = true
 
-	var affectedRef *fileref.Ref
-	if ch.ObjectTree.GetType() == fileref.FILE {
-		affectedRef = &(ch.ObjectTree.(*fileref.FileRef)).Ref
-	} else {
-		affectedRef = ch.ObjectTree.(*fileref.Ref)
-	}
+	// the copy gets the new paths, ObjectTree may be the source ref of the same tree and must stay intact
+	copied := cloneRefEntity(ch.ObjectTree)
+	affectedRef := getRef(copied)
 
 	affectedRef.Path = zboxutil.Join(dirRef.GetPath(), affectedRef.Name)
 	ch.processChildren(affectedRef)
-	dirRef.AddChild(ch.ObjectTree)
+	dirRef.AddChild(copied)
 
 	rootRef.CalculateHash()
 	return nil
@@ -76,6 +73,22 @@ func (ch *CopyFileChange) processChildren(curRef *fileref.Ref) {
 	}
 }
 
+// cloneRefEntity deep copies a ref with its subtree
+func cloneRefEntity(entity fileref.RefEntity) fileref.RefEntity {
+	if entity.GetType() == fileref.FILE {
+		fr := *entity.(*fileref.FileRef)
+		fr.CommitMetaTxns = append([]fileref.CommitMetaTxn(nil), fr.CommitMetaTxns...)
+		fr.Collaborators = append([]fileref.Collaborator(nil), fr.Collaborators...)
+		return &fr
+	}
+	ref := *entity.(*fileref.Ref)
+	ref.Children = make([]fileref.RefEntity, 0, len(ref.Children))
+	for _, child := range entity.(*fileref.Ref).Children {
+		ref.Children = append(ref.Children, cloneRefEntity(child))
+	}
+	return &ref
+}
+
 func (n *CopyFileChange) GetAffectedPath() []string {
 	return []string{n.DestPath}
 }
@@ -0,0 +1,36 @@
+package allocationchange
+
+import (
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFileChange(t *testing.T) {
+	rootRef := newTestTree()
+	rootRef.CalculateHash()
+	source := findTestRef(rootRef, "/a")
+	sourceHash := source.GetHash()
+
+	ch := &CopyFileChange{ObjectTree: source, DestPath: "/backup"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	require.Equal(t, int64(7), ch.GetSize())
+
+	// the source is intact
+	require.Same(t, source, findTestRef(rootRef, "/a"))
+	for _, p := range []string{"/a", "/a/b", "/a/b/c.txt", "/a/d.txt"} {
+		require.NotNil(t, findTestRef(rootRef, p), p)
+	}
+	// the copy has the new paths and the same files
+	for _, p := range []string{"/backup/a", "/backup/a/b", "/backup/a/b/c.txt", "/backup/a/d.txt"} {
+		require.NotNil(t, findTestRef(rootRef, p), p)
+	}
+	require.Equal(t, sourceHash, findTestRef(rootRef, "/a").CalculateHash())
+	require.Equal(t, findTestRef(rootRef, "/a/d.txt").GetSize(), findTestRef(rootRef, "/backup/a/d.txt").GetSize())
+	require.NoError(t, validateRefTree(rootRef, map[string]bool{}))
+
+	// changing the copy doesn't change the source
+	findTestRef(rootRef, "/backup/a/d.txt").(*fileref.FileRef).Size = 40
+	require.Equal(t, int64(4), findTestRef(rootRef, "/a/d.txt").GetSize())
+}
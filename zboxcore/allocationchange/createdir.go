@@ -2,7 +2,7 @@ package allocationchange
 
 import (
 	"errors"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/0chain/gosdk/core/common"
@@ -41,7 +41,7 @@ func (d *DirCreateChange) ProcessChange(rootRef *fileref.Ref) error {
 			newRef := &fileref.Ref{
 				Type:         fileref.DIRECTORY,
 				AllocationID: dirRef.AllocationID,
-				Path:         filepath.Join("/", strings.Join(fields[:i+1], "/")),
+				Path:         path.Join("/", strings.Join(fields[:i+1], "/")),
 				Name:         fields[i],
 			}
 			newRef.HashToBeComputed = true
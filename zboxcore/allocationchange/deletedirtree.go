@@ -0,0 +1,80 @@
+package allocationchange
+
+import (
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// DeleteDirTreeChange removes the directory RemotePath with its whole subtree in one change, "/" clears the allocation
+type DeleteDirTreeChange struct {
+	change
+	RemotePath string
+	// removedSize total size of the files removed, known once the change is processed
+	removedSize int64
+}
+
+func (ch *DeleteDirTreeChange) ProcessChange(rootRef *fileref.Ref) error {
+	fields, err := common.GetPathFields(ch.RemotePath)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		ch.removedSize = treeSize(rootRef)
+		rootRef.Children = nil
+		rootRef.CalculateHash()
+		return nil
+	}
+
+	dirRef := rootRef
+	for _, name := range fields[:len(fields)-1] {
+		found := false
+		for _, child := range dirRef.Children {
+			if child.GetName() == name && child.GetType() == fileref.DIRECTORY {
+				dirRef = child.(*fileref.Ref)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("invalid_reference_path", "Invalid reference path from the blobber")
+		}
+	}
+
+	name := fields[len(fields)-1]
+	for i, child := range dirRef.Children {
+		if child.GetName() != name {
+			continue
+		}
+		if child.GetType() != fileref.DIRECTORY {
+			return errors.New("not_a_directory", ch.RemotePath+" is not a directory")
+		}
+		ch.removedSize = treeSize(child.(*fileref.Ref))
+		dirRef.RemoveChild(i)
+		rootRef.CalculateHash()
+		return nil
+	}
+	return errors.New("directory_not_found", "Directory to delete not found in blobber")
+}
+
+// treeSize sums the size of the files under dirRef
+func treeSize(dirRef *fileref.Ref) int64 {
+	var size int64
+	for _, child := range dirRef.Children {
+		if child.GetType() == fileref.DIRECTORY {
+			size += treeSize(child.(*fileref.Ref))
+			continue
+		}
+		size += child.GetSize()
+	}
+	return size
+}
+
+func (ch *DeleteDirTreeChange) GetAffectedPath() []string {
+	return []string{ch.RemotePath}
+}
+
+// GetSize is the negated size of the files removed, 0 before the change is processed
+func (ch *DeleteDirTreeChange) GetSize() int64 {
+	return -ch.removedSize
+}
@@ -0,0 +1,44 @@
+package allocationchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteDirTreeChange(t *testing.T) {
+	rootRef := newTestTree()
+	rootRef.CalculateHash()
+	hash := rootRef.Hash
+
+	ch := &DeleteDirTreeChange{RemotePath: "/a"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	require.Equal(t, int64(-7), ch.GetSize())
+	for _, p := range []string{"/a", "/a/b", "/a/b/c.txt", "/a/d.txt"} {
+		require.Nil(t, findTestRef(rootRef, p), p)
+	}
+	require.NotNil(t, findTestRef(rootRef, "/e.txt"))
+	require.NotEqual(t, hash, rootRef.Hash)
+	require.Equal(t, []string{"/a"}, ch.GetAffectedPath())
+
+	// a nested directory
+	rootRef = newTestTree()
+	ch = &DeleteDirTreeChange{RemotePath: "/a/b"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	require.Equal(t, int64(-3), ch.GetSize())
+	require.Nil(t, findTestRef(rootRef, "/a/b"))
+	require.NotNil(t, findTestRef(rootRef, "/a/d.txt"))
+
+	// the root
+	rootRef = newTestTree()
+	ch = &DeleteDirTreeChange{RemotePath: "/"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+	require.Equal(t, int64(-12), ch.GetSize())
+	require.Empty(t, rootRef.Children)
+
+	for _, p := range []string{"/e.txt", "/x", "/e.txt/y", "relative"} {
+		rootRef = newTestTree()
+		require.Error(t, (&DeleteDirTreeChange{RemotePath: p}).ProcessChange(rootRef), p)
+		require.NotNil(t, findTestRef(rootRef, "/a/b/c.txt"))
+	}
+}
@@ -1,7 +1,7 @@
 package allocationchange
 
 import (
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/0chain/errors"
@@ -40,7 +40,7 @@ func (ch *MoveFileChange) ProcessChange(rootRef *fileref.Ref) error {
 			newRef := &fileref.Ref{
 				Type:         fileref.DIRECTORY,
 				AllocationID: dirRef.AllocationID,
-				Path:         filepath.Join("/", strings.Join(fields[:i+1], "/")),
+				Path:         path.Join("/", strings.Join(fields[:i+1], "/")),
 				Name:         fields[i],
 			}
 			dirRef.AddChild(newRef)
@@ -60,7 +60,7 @@ func (ch *MoveFileChange) ProcessChange(rootRef *fileref.Ref) error {
 		affectedRef = ch.ObjectTree.(*fileref.Ref)
 	}
 
-	oldParentPath, oldFileName := filepath.Split(ch.ObjectTree.GetPath())
+	oldParentPath, oldFileName := path.Split(ch.ObjectTree.GetPath())
 	affectedRef.Path = zboxutil.Join(dirRef.GetPath(), affectedRef.Name)
 	ch.processChildren(affectedRef)
 
@@ -121,7 +121,7 @@ func (ch *MoveFileChange) processChildren(curRef *fileref.Ref) {
 }
 
 func (n *MoveFileChange) GetAffectedPath() []string {
-	return []string{n.DestPath, filepath.Dir(n.ObjectTree.GetPath())}
+	return []string{n.DestPath, path.Dir(n.ObjectTree.GetPath())}
 }
 
 func (n *MoveFileChange) GetSize() int64 {
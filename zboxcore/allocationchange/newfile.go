@@ -2,7 +2,6 @@ package allocationchange
 
 import (
 	"path"
-	"path/filepath"
 	"strings"
 
 	"github.com/0chain/gosdk/core/common"
@@ -34,7 +33,7 @@ func (ch *NewFileChange) ProcessChange(rootRef *fileref.Ref) error {
 			newRef := &fileref.Ref{
 				Type:         fileref.DIRECTORY,
 				AllocationID: dirRef.AllocationID,
-				Path:         filepath.Join("/", strings.Join(tSubDirs[:i+1], "/")),
+				Path:         path.Join("/", strings.Join(tSubDirs[:i+1], "/")),
 				Name:         tSubDirs[i],
 			}
 			dirRef.AddChild(newRef)
@@ -2,7 +2,8 @@ package allocationchange
 
 import (
 	"path"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/0chain/errors"
 	"github.com/0chain/gosdk/core/common"
@@ -16,6 +17,9 @@ type RenameFileChange struct {
 }
 
 func (ch *RenameFileChange) ProcessChange(rootRef *fileref.Ref) error {
+	if err := validateNewName(ch.NewName); err != nil {
+		return err
+	}
 	parentPath := path.Dir(ch.ObjectTree.GetPath())
 	fields, err := common.GetPathFields(parentPath)
 	if err != nil {
@@ -36,6 +40,13 @@ func (ch *RenameFileChange) ProcessChange(rootRef *fileref.Ref) error {
 		}
 	}
 
+	newPath := path.Join(parentPath, ch.NewName)
+	for _, child := range dirRef.Children {
+		if child.GetName() == ch.NewName && child.GetPath() != ch.ObjectTree.GetPath() {
+			return errors.New("rename_conflict", "Object "+newPath+" already exists")
+		}
+	}
+
 	found := false
 	var affectedRef *fileref.Ref
 	for i, child := range dirRef.Children {
@@ -48,8 +59,9 @@ func (ch *RenameFileChange) ProcessChange(rootRef *fileref.Ref) error {
 				affectedRef = ch.ObjectTree.(*fileref.Ref)
 			}
 
-			affectedRef.Path = filepath.Join(parentPath, ch.NewName)
+			affectedRef.Path = newPath
 			affectedRef.Name = ch.NewName
+			affectedRef.LookupHash = fileref.GetReferenceLookup(affectedRef.AllocationID, newPath)
 
 			dirRef.AddChild(ch.ObjectTree)
 			found = true
@@ -62,10 +74,23 @@ func (ch *RenameFileChange) ProcessChange(rootRef *fileref.Ref) error {
 	}
 
 	ch.processChildren(affectedRef)
+	if err := validateRefTree(affectedRef, map[string]bool{affectedRef.Path: true}); err != nil {
+		return err
+	}
 	rootRef.CalculateHash()
 	return nil
 }
 
+// validateNewName checks the new name is a single path segment, so a rename can't move the object to another directory
+func validateNewName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid_name", "Invalid new name "+strconv.Quote(name)+", it must be a single path segment")
+	}
+	return nil
+}
+
+// processChildren moves the descendants of curRef under its new path, their lookup hash follows the path
+// as the blobber derives it from the path of the ref
 func (ch *RenameFileChange) processChildren(curRef *fileref.Ref) {
 	for _, childRefEntity := range curRef.Children {
 		var childRef *fileref.Ref
@@ -74,7 +99,8 @@ func (ch *RenameFileChange) processChildren(curRef *fileref.Ref) {
 		} else {
 			childRef = childRefEntity.(*fileref.Ref)
 		}
-		childRef.Path = filepath.Join(curRef.Path, childRef.Name)
+		childRef.Path = path.Join(curRef.Path, childRef.Name)
+		childRef.LookupHash = fileref.GetReferenceLookup(childRef.AllocationID, childRef.Path)
 		if childRefEntity.GetType() == fileref.DIRECTORY {
 			ch.processChildren(childRef)
 		}
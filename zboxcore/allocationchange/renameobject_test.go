@@ -0,0 +1,118 @@
+package allocationchange
+
+import (
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDirRef(p, name string, children ...fileref.RefEntity) *fileref.Ref {
+	ref := &fileref.Ref{Type: fileref.DIRECTORY, Path: p, Name: name}
+	for _, child := range children {
+		ref.AddChild(child)
+	}
+	return ref
+}
+
+func newTestFileRef(p, name string, size int64) *fileref.FileRef {
+	return &fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE, Path: p, Name: name, Size: size}}
+}
+
+// newTestTree builds /a/b/c.txt, /a/d.txt and /e.txt
+func newTestTree() *fileref.Ref {
+	return newTestDirRef("/", "/",
+		newTestDirRef("/a", "a",
+			newTestDirRef("/a/b", "b", newTestFileRef("/a/b/c.txt", "c.txt", 3)),
+			newTestFileRef("/a/d.txt", "d.txt", 4),
+		),
+		newTestFileRef("/e.txt", "e.txt", 5),
+	)
+}
+
+func findTestRef(root *fileref.Ref, p string) fileref.RefEntity {
+	for _, child := range root.Children {
+		if child.GetPath() == p {
+			return child
+		}
+		if child.GetType() == fileref.DIRECTORY {
+			if found := findTestRef(child.(*fileref.Ref), p); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func TestRenameFileChangeSubtreeIntegrity(t *testing.T) {
+	rootRef := newTestTree()
+	ch := &RenameFileChange{ObjectTree: findTestRef(rootRef, "/a"), NewName: "z"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+
+	for _, p := range []string{"/z", "/z/b", "/z/b/c.txt", "/z/d.txt", "/e.txt"} {
+		require.NotNil(t, findTestRef(rootRef, p), p)
+	}
+	require.Nil(t, findTestRef(rootRef, "/a"))
+	require.NoError(t, validateRefTree(rootRef, map[string]bool{}))
+}
+
+func TestValidateRefTreeDetectsCorruption(t *testing.T) {
+	rootRef := newTestTree()
+	findTestRef(rootRef, "/a/d.txt").(*fileref.FileRef).Path = "/a/b/c.txt"
+	require.Error(t, validateRefTree(rootRef, map[string]bool{}))
+
+	rootRef = newTestTree()
+	findTestRef(rootRef, "/a/b").(*fileref.Ref).AddChild(newTestFileRef("/a/b/c.txt", "c.txt", 3))
+	require.Error(t, validateRefTree(rootRef, map[string]bool{}))
+}
+
+func TestRenameFileChangeConflict(t *testing.T) {
+	rootRef := newTestTree()
+	ch := &RenameFileChange{ObjectTree: findTestRef(rootRef, "/a/d.txt"), NewName: "b"}
+	err := ch.ProcessChange(rootRef)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rename_conflict")
+	// the tree is left unchanged
+	require.NotNil(t, findTestRef(rootRef, "/a/d.txt"))
+	require.NotNil(t, findTestRef(rootRef, "/a/b/c.txt"))
+
+	// keeping the same name is not a conflict
+	ch = &RenameFileChange{ObjectTree: findTestRef(rootRef, "/e.txt"), NewName: "e.txt"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+}
+
+func TestRenameFileChangeInvalidName(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../foo", "a/b", "/c", `a\b`} {
+		rootRef := newTestTree()
+		ch := &RenameFileChange{ObjectTree: findTestRef(rootRef, "/a/d.txt"), NewName: name}
+		err := ch.ProcessChange(rootRef)
+		require.Error(t, err, name)
+		require.Contains(t, err.Error(), "invalid_name", name)
+		require.NotNil(t, findTestRef(rootRef, "/a/d.txt"), name)
+	}
+}
+
+func TestRenameFileChangeDescendantLookupHash(t *testing.T) {
+	rootRef := newTestTree()
+	var setAllocationID func(ref *fileref.Ref)
+	setAllocationID = func(ref *fileref.Ref) {
+		ref.AllocationID = "alloc"
+		ref.LookupHash = fileref.GetReferenceLookup("alloc", ref.Path)
+		for _, child := range ref.Children {
+			setAllocationID(getRef(child))
+		}
+	}
+	setAllocationID(rootRef)
+	untouched := findTestRef(rootRef, "/e.txt").GetLookupHash()
+
+	ch := &RenameFileChange{ObjectTree: findTestRef(rootRef, "/a"), NewName: "z"}
+	require.NoError(t, ch.ProcessChange(rootRef))
+
+	for _, p := range []string{"/z", "/z/b", "/z/b/c.txt", "/z/d.txt"} {
+		ref := findTestRef(rootRef, p)
+		require.NotNil(t, ref, p)
+		require.Equal(t, p, ref.GetPath())
+		require.Equal(t, fileref.GetReferenceLookup("alloc", p), ref.GetLookupHash(), p)
+	}
+	require.Equal(t, untouched, findTestRef(rootRef, "/e.txt").GetLookupHash())
+}
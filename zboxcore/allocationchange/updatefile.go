@@ -1,7 +1,7 @@
 package allocationchange
 
 import (
-	"path/filepath"
+	"path"
 
 	"github.com/0chain/errors"
 	"github.com/0chain/gosdk/zboxcore/fileref"
@@ -14,8 +14,8 @@ type UpdateFileChange struct {
 }
 
 func (ch *UpdateFileChange) ProcessChange(rootRef *fileref.Ref) error {
-	path, _ := filepath.Split(ch.NewFile.Path)
-	tSubDirs := getSubDirs(path)
+	parentPath, _ := path.Split(ch.NewFile.Path)
+	tSubDirs := getSubDirs(parentPath)
 	dirRef := rootRef
 	treelevel := 0
 	for treelevel < len(tSubDirs) {
@@ -720,6 +720,10 @@ func (a *Allocation) ListDirFromAuthTicket(authTicket string, lookupHash string)
 }
 
 func (a *Allocation) ListDir(path string) (*ListResult, error) {
+	return a.listDir(path, nil)
+}
+
+func (a *Allocation) listDir(path string, breaker *blobberBreaker) (*ListResult, error) {
 	if !a.isInitialized() {
 		return nil, notInitialized
 	}
@@ -739,6 +743,7 @@ func (a *Allocation) ListDir(path string) (*ListResult, error) {
 	listReq.consensusThresh = a.consensusThreshold
 	listReq.ctx = a.ctx
 	listReq.remotefilepath = path
+	listReq.breaker = breaker
 	ref, err := listReq.GetListFromBlobbers()
 	if err != nil {
 		return nil, err
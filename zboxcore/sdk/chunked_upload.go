@@ -125,7 +125,7 @@ func CreateChunkedUpload(
 		fullconsensus:   allocationObj.fullconsensus,
 	}
 
-	uploadMask := zboxutil.NewUint128(1).Lsh(uint64(len(allocationObj.Blobbers))).Sub64(1)
+	uploadMask := newUploadMask(len(allocationObj.Blobbers))
 	if isRepair {
 		opCode = OpUpdate
 		found, repairRequired, _, err := allocationObj.RepairRequired(fileMeta.RemotePath)
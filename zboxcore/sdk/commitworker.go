@@ -172,14 +172,18 @@ func (commitreq *CommitRequest) processCommit() {
 		}
 	}
 
-	var size int64
-	for _, change := range commitreq.changes {
-		err = change.ProcessChange(rootRef)
-		if err != nil {
+	size, err := allocationchange.ProcessChanges(rootRef, commitreq.changes)
+	if err != nil {
+		commitreq.result = ErrorCommitResult(err.Error())
+		return
+	}
+	// a batch can leave the paths it touched inconsistent, e.g. two changes creating the same path, which the blobber
+	// would reject as a whole, a single change is checked by its ProcessChange
+	if len(commitreq.changes) > 1 {
+		if err = allocationchange.ValidateChanges(rootRef, commitreq.changes); err != nil {
 			commitreq.result = ErrorCommitResult(err.Error())
 			return
 		}
-		size += change.GetSize()
 	}
 
 	err = commitreq.commitBlobber(rootRef, lR.LatestWM, size)
@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitRequest_processCommitInconsistentBatch(t *testing.T) {
+	const mockBlobberUrl = "TestCommitRequest_processCommitInconsistentBatch"
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  "mock client id",
+		ClientKey: "mock client key",
+	}
+
+	refPath, err := json.Marshal(ReferencePathResult{ReferencePath: &fileref.ReferencePath{
+		Meta: map[string]interface{}{"type": fileref.DIRECTORY, "path": "/", "name": "/"},
+	}})
+	require.NoError(t, err)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, mockBlobberUrl+zboxutil.REFERENCE_ENDPOINT)
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(refPath)),
+	}, nil)
+
+	newFile := func(size int64) allocationchange.AllocationChange {
+		return &allocationchange.NewFileChange{File: &fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE, Path: "/a.txt", Name: "a.txt", Size: size}}}
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	req := &CommitRequest{
+		changes:      []allocationchange.AllocationChange{newFile(1), newFile(2)},
+		blobber:      &blockchain.StorageNode{Baseurl: mockBlobberUrl},
+		allocationID: "mock allocation id",
+		allocationTx: "mock transaction id",
+		wg:           wg,
+	}
+	req.processCommit()
+
+	require.NotNil(t, req.result)
+	require.False(t, req.result.Success)
+	require.Contains(t, req.result.ErrorMessage, "inconsistent batch of changes")
+	// the write marker was never sent
+	mockClient.AssertNumberOfCalls(t, "Do", 1)
+}
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/0chain/errors"
+)
+
+var errBlobberUnavailable = errors.New("blobber_unavailable", "blobber skipped after repeated list failures")
+
+// blobberBreaker stops querying a blobber for the rest of a walk once it failed threshold times in a row
+type blobberBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	failures  map[string]int
+	tripped   map[string]bool
+}
+
+func newBlobberBreaker(threshold int) *blobberBreaker {
+	return &blobberBreaker{
+		threshold: threshold,
+		failures:  make(map[string]int),
+		tripped:   make(map[string]bool),
+	}
+}
+
+func (b *blobberBreaker) isOpen(baseURL string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.tripped[baseURL]
+}
+
+func (b *blobberBreaker) record(baseURL string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		b.failures[baseURL] = 0
+		return
+	}
+	b.failures[baseURL]++
+	if b.failures[baseURL] >= b.threshold {
+		b.tripped[baseURL] = true
+	}
+}
+
+func (b *blobberBreaker) trippedBlobbers() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	tripped := make([]string, 0, len(b.tripped))
+	for baseURL := range b.tripped {
+		tripped = append(tripped, baseURL)
+	}
+	sort.Strings(tripped)
+	return tripped
+}
+
+// breakerLister lists the allocation through a breaker shared by all the ListDir calls of a walk
+type breakerLister struct {
+	allocation *Allocation
+	breaker    *blobberBreaker
+}
+
+func (bl *breakerLister) ListDir(path string) (*ListResult, error) {
+	return bl.allocation.listDir(path, bl.breaker)
+}
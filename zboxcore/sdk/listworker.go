@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +32,7 @@ type ListRequest struct {
 	authToken          *marker.AuthTicket
 	ctx                context.Context
 	wg                 *sync.WaitGroup
+	breaker            *blobberBreaker
 	Consensus
 }
 
@@ -55,6 +57,8 @@ type ListResult struct {
 	ActualNumBlocks int64            `json:"actual_num_blocks"`
 	CreatedAt       common.Timestamp `json:"created_at"`
 	UpdatedAt       common.Timestamp `json:"updated_at"`
+	Mode            os.FileMode      `json:"mode,omitempty"`
+	Shared          bool             `json:"shared,omitempty"`
 	Children        []*ListResult    `json:"list"`
 	Consensus       `json:"-"`
 }
@@ -133,12 +137,20 @@ func (req *ListRequest) getlistFromBlobbers() []*listResponse {
 	req.wg.Add(numList)
 	rspCh := make(chan *listResponse, numList)
 	for i := 0; i < numList; i++ {
+		if req.breaker != nil && req.breaker.isOpen(req.blobbers[i].Baseurl) {
+			rspCh <- &listResponse{blobberIdx: i, err: errBlobberUnavailable}
+			req.wg.Done()
+			continue
+		}
 		go req.getListInfoFromBlobber(req.blobbers[i], i, rspCh)
 	}
 	req.wg.Wait()
 	listInfos := make([]*listResponse, len(req.blobbers))
 	for i := 0; i < numList; i++ {
 		listInfos[i] = <-rspCh
+		if req.breaker != nil && listInfos[i].err != errBlobberUnavailable {
+			req.breaker.record(req.blobbers[listInfos[i].blobberIdx].Baseurl, listInfos[i].err)
+		}
 	}
 	return listInfos
 }
@@ -204,6 +216,7 @@ func (req *ListRequest) GetListFromBlobbers() (*ListResult, error) {
 				childResult.MimeType = (child.(*fileref.FileRef)).MimeType
 				childResult.EncryptionKey = (child.(*fileref.FileRef)).EncryptedKey
 				childResult.ActualSize = (child.(*fileref.FileRef)).ActualFileSize
+				childResult.Shared = len((child.(*fileref.FileRef)).Collaborators) > 0
 				if childResult.ActualSize > 0 {
 					childResult.ActualNumBlocks = childResult.ActualSize / CHUNK_SIZE
 				}
@@ -305,3 +305,68 @@ func TestListRequest_GetListFromBlobbers(t *testing.T) {
 		})
 	}
 }
+
+func TestListRequest_GetListFromBlobbersBreaker(t *testing.T) {
+	const (
+		mockBlobberUrl     = "TestListRequest_GetListFromBlobbersBreaker"
+		mockAllocationRoot = "mock allocation root"
+		numBlobbers        = 4
+		failingBlobber     = 3
+	)
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  "mock client id",
+		ClientKey: "mock client key",
+	}
+
+	var mu sync.Mutex
+	calls := make(map[int]int)
+	for i := 0; i < numBlobbers; i++ {
+		idx := i
+		url := mockBlobberUrl + strconv.Itoa(i)
+		mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+			return strings.HasPrefix(req.URL.Path, url)
+		})).Return(func(req *http.Request) *http.Response {
+			mu.Lock()
+			calls[idx]++
+			mu.Unlock()
+			if idx == failingBlobber {
+				return &http.Response{StatusCode: http.StatusInternalServerError, Body: ioutil.NopCloser(strings.NewReader(""))}
+			}
+			jsonFR, err := json.Marshal(&fileref.ListResult{
+				AllocationRoot: mockAllocationRoot,
+				Meta:           map[string]interface{}{"type": fileref.DIRECTORY},
+			})
+			require.NoError(t, err)
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(jsonFR))}
+		}, nil)
+	}
+
+	breaker := newBlobberBreaker(2)
+	for n := 0; n < 5; n++ {
+		req := &ListRequest{
+			allocationID: "mock allocation id",
+			allocationTx: "mock transaction id",
+			ctx:          context.TODO(),
+			breaker:      breaker,
+			Consensus: Consensus{
+				consensusThresh: 2,
+				fullconsensus:   numBlobbers,
+			},
+		}
+		for i := 0; i < numBlobbers; i++ {
+			req.blobbers = append(req.blobbers, &blockchain.StorageNode{Baseurl: mockBlobberUrl + strconv.Itoa(i)})
+		}
+		got, err := req.GetListFromBlobbers()
+		require.NoError(t, err)
+		require.NotNil(t, got)
+	}
+
+	require.Equal(t, []string{mockBlobberUrl + strconv.Itoa(failingBlobber)}, breaker.trippedBlobbers())
+	require.Equal(t, 2, calls[failingBlobber])
+	require.Equal(t, 5, calls[0])
+}
@@ -1,21 +1,22 @@
 package sdk
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"sort"
 	"time"
 
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/encryption"
 	"github.com/0chain/gosdk/core/sys"
+	"github.com/0chain/gosdk/core/util"
 	"github.com/0chain/gosdk/zboxcore/fileref"
 	l "github.com/0chain/gosdk/zboxcore/logger"
 )
@@ -28,6 +29,45 @@ const (
 	Delete      = "Delete"
 	Conflict    = "Conflict"
 	LocalDelete = "LocalDelete"
+	// Link the local file is a hardlink of LinkTo, it can be created remotely as a copy of LinkTo
+	Link = "Link"
+	// Chmod the content matches but the remote permission bits differ from the local ones
+	Chmod = "Chmod"
+	// Pack the Members small files of the directory Path are planned together, each is uploaded as its own file
+	Pack = "Pack"
+	// Rename the remote file OldPath is moved to Path, as it was locally, instead of deleted and uploaded again
+	Rename = "Rename"
+	// LocalRename the local file OldPath is moved to Path, as it was remotely, instead of deleted and downloaded again
+	LocalRename = "LocalRename"
+	// CreateDir the new local directory Path is created remotely, planned with WithEmptyDirSync
+	CreateDir = "CreateDir"
+	// LocalCreateDir the new remote directory Path is created locally, planned with WithEmptyDirSync
+	LocalCreateDir = "LocalCreateDir"
+)
+
+var (
+	// ErrLocalRootNotFound the local root path of a sync doesn't exist
+	ErrLocalRootNotFound = errors.New("local_root_not_found", "local root path doesn't exist")
+	// ErrLocalRootNotDir the local root path of a sync is not a directory
+	ErrLocalRootNotDir = errors.New("local_root_not_dir", "local root path is not a directory")
+	// ErrLocalRootUnreadable the local root directory of a sync can't be read
+	ErrLocalRootUnreadable = errors.New("local_root_unreadable", "local root path can't be read")
+	// ErrInvalidRemoteRoot the remote root path of a sync is not an absolute path of the allocation
+	ErrInvalidRemoteRoot = errors.New("invalid_remote_root", "remote root path must be absolute")
+	// ErrRemoteRootNotDir the remote root path of a sync is not a directory
+	ErrRemoteRootNotDir = errors.New("remote_root_not_dir", "remote root path is not a directory")
+	// ErrLocalPathTooLong a local path is longer than the filesystem accepts
+	ErrLocalPathTooLong = errors.New("local_path_too_long", "local path exceeds the filesystem path length limit")
+	// ErrInvalidCacheFile the sync state file is a directory or its content can't be decoded
+	ErrInvalidCacheFile = errors.New("invalid_cache_file", "invalid cache content.")
+	// ErrReadCache the sync state file can't be read
+	ErrReadCache = errors.New("read_cache_failed", "can't read cache file.")
+	// ErrSoftDeadline the sync stopped at the deadline of WithSoftDeadline or SyncToRemoteOptions.SoftDeadline before completing
+	ErrSoftDeadline = errors.New("soft_deadline_reached", "sync stopped at its soft deadline")
+	// ErrRemoteList the remote tree failed to list, it is worth retrying a transient failure
+	ErrRemoteList = errors.New("remote_list_failed", "error getting list dir from remote.")
+	// ErrLocalList the local tree failed to walk
+	ErrLocalList = errors.New("local_list_failed", "error getting list dir from local.")
 )
 
 type fileInfo struct {
@@ -39,121 +79,630 @@ type fileInfo struct {
 	LookupHash   string    `json:"lookup_hash"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	LinkTo       string    `json:"link_to,omitempty"`
+	// Mode permission bits, 0 when unknown
+	Mode os.FileMode `json:"mode,omitempty"`
+	// Shared the remote file has collaborators
+	Shared bool `json:"shared,omitempty"`
+	// Unreadable the local file couldn't be hashed or the local directory couldn't be read, it is left out of the diff
+	Unreadable bool `json:"-"`
+	// ModTime last modification of the local file, or update of the remote one, to resolve conflicts with PreferNewer
+	ModTime time.Time `json:"-"`
 }
 
 type FileDiff struct {
-	Op   string `json:"operation"`
-	Path string `json:"path"`
-	Type string `json:"type"`
+	Op     string `json:"operation"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	LinkTo string `json:"link_to,omitempty"`
+	// Members paths of the files grouped by a Pack
+	Members []string `json:"members,omitempty"`
+	// OldPath path the file of a Rename or LocalRename is moved from
+	OldPath string `json:"old_path,omitempty"`
+	// Size, Hash and ModTime, in unix seconds, of the file on the side the operation reads it from,
+	// the local file of an Upload or an Update and the remote one of a Download, e.g. to show the size of the sync
+	Size    int64  `json:"size,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	ModTime int64  `json:"mod_time,omitempty"`
+}
+
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// remoteLister lists a remote directory, it is implemented by Allocation
+type remoteLister interface {
+	ListDir(path string) (*ListResult, error)
+}
+
+func newRemoteFileInfo(child *ListResult) fileInfo {
+	return fileInfo{
+		Size:         child.Size,
+		ActualSize:   child.ActualSize,
+		Hash:         child.Hash,
+		Type:         child.Type,
+		EncryptedKey: child.EncryptionKey,
+		LookupHash:   child.LookupHash,
+		CreatedAt:    child.CreatedAt.ToTime(),
+		UpdatedAt:    child.UpdatedAt.ToTime(),
+		Mode:         child.Mode,
+		Shared:       child.Shared,
+		ModTime:      child.UpdatedAt.ToTime(),
+	}
 }
 
 func (a *Allocation) getRemoteFilesAndDirs(dirList []string, fMap map[string]fileInfo, exclMap map[string]int) ([]string, error) {
+	return getRemoteFilesAndDirs(a, dirList, fMap, exclMap)
+}
+
+// RemoteListError a remote directory which failed to list
+type RemoteListError struct {
+	Dir string
+	Err error
+}
+
+// RemoteListErrors the remote directories which failed to list, in the order they were listed.
+// The walk went on with the rest of the tree, the subtrees of these directories are missing from its result.
+type RemoteListErrors []RemoteListError
+
+func (e RemoteListErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, le := range e {
+		msgs = append(msgs, le.Dir+": "+le.Err.Error())
+	}
+	return fmt.Sprintf("remote_list_failed: %v directories failed to list: %v", len(e), strings.Join(msgs, "; "))
+}
+
+// hasRoot tells if the root failed to list, then nothing was listed
+func (e RemoteListErrors) hasRoot() bool {
+	for _, le := range e {
+		if le.Dir == "/" {
+			return true
+		}
+	}
+	return false
+}
+
+// Dirs the directories which failed to list
+func (e RemoteListErrors) Dirs() []string {
+	dirs := make([]string, 0, len(e))
+	for _, le := range e {
+		dirs = append(dirs, le.Dir)
+	}
+	return dirs
+}
+
+// getRemoteFilesAndDirs lists the directories of dirList into fMap and returns their child directories.
+// A directory failing to list doesn't stop the others, the failures are returned as RemoteListErrors.
+// Only a cancellation stops the listing, its error is then returned as is.
+func getRemoteFilesAndDirs(lister remoteLister, dirList []string, fMap map[string]fileInfo, exclMap map[string]int) ([]string, error) {
 	childDirList := make([]string, 0)
+	matcher := remoteMatcher(exclMap)
+	var listErrs RemoteListErrors
 	for _, dir := range dirList {
-		ref, err := a.ListDir(dir)
+		ref, err := lister.ListDir(dir)
 		if err != nil {
-			return []string{}, err
+			// a cancelled walk stops at once
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return []string{}, err
+			}
+			l.Logger.Error("Remote list error for path", dir, err.Error())
+			listErrs = append(listErrs, RemoteListError{Dir: dir, Err: err})
+			continue
 		}
 		for _, child := range ref.Children {
-			if _, ok := exclMap[child.Path]; ok {
+			childPath := normalizePath(child.Path)
+			if skip, _ := matcher.Matches(childPath, listResultInfo{child}); skip {
 				continue
 			}
-			fMap[child.Path] = fileInfo{
-				Size:         child.Size,
-				ActualSize:   child.ActualSize,
-				Hash:         child.Hash,
-				Type:         child.Type,
-				EncryptedKey: child.EncryptionKey,
-				LookupHash:   child.LookupHash,
-				CreatedAt:    child.CreatedAt.ToTime(),
-				UpdatedAt:    child.UpdatedAt.ToTime(),
-			}
+			fMap[childPath] = newRemoteFileInfo(child)
 			if child.Type == fileref.DIRECTORY {
-				childDirList = append(childDirList, child.Path)
+				childDirList = append(childDirList, childPath)
 			}
 		}
 	}
+	if len(listErrs) > 0 {
+		return childDirList, listErrs
+	}
 	return childDirList, nil
 }
 
+// LocalReadError a local directory which couldn't be read
+type LocalReadError struct {
+	Dir string
+	Err error
+}
+
+// LocalReadErrors the local directories which couldn't be read, e.g. for lack of permission, in the order they were walked.
+// GetAllocationDiff returns them with the plan of the rest of the tree: their subtrees are left out on both sides,
+// so nothing under them is planned, and should be shown to the user as not synced.
+type LocalReadErrors []LocalReadError
+
+func (e LocalReadErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, le := range e {
+		msgs = append(msgs, le.Dir+": "+le.Err.Error())
+	}
+	return fmt.Sprintf("local_dir_unreadable: %v directories couldn't be read: %v", len(e), strings.Join(msgs, "; "))
+}
+
+// Dirs the directories which couldn't be read
+func (e LocalReadErrors) Dirs() []string {
+	dirs := make([]string, 0, len(e))
+	for _, le := range e {
+		dirs = append(dirs, le.Dir)
+	}
+	return dirs
+}
+
 func (a *Allocation) GetRemoteFileMap(exclMap map[string]int) (map[string]fileInfo, error) {
+	return getRemoteFileMap(a, exclMap)
+}
+
+// getRemoteFileMap walks the remote tree. The directories failing to list are skipped with their subtree
+// and returned as RemoteListErrors, with the rest of the tree.
+func getRemoteFileMap(lister remoteLister, exclMap map[string]int) (map[string]fileInfo, error) {
 	// 1. Iteratively get dir and files separately till no more dirs left
 	remoteList := make(map[string]fileInfo)
 	dirs := []string{"/"}
-	var err error
-	for {
-		dirs, err = a.getRemoteFilesAndDirs(dirs, remoteList, exclMap)
-		if err != nil {
-			l.Logger.Error(err.Error())
-			break
-		}
-		if len(dirs) == 0 {
-			break
+	var listErrs RemoteListErrors
+	for len(dirs) > 0 {
+		var err error
+		dirs, err = getRemoteFilesAndDirs(lister, dirs, remoteList, exclMap)
+		if dirErrs, ok := err.(RemoteListErrors); ok {
+			listErrs = append(listErrs, dirErrs...)
+		} else if err != nil {
+			return remoteList, err
 		}
 	}
 	l.Logger.Debug("Remote List: ", remoteList)
-	return remoteList, err
+	if len(listErrs) > 0 {
+		return remoteList, listErrs
+	}
+	return remoteList, nil
+}
+
+// softDeadlineErr gets the error of the done ctx derived from parent, ErrSoftDeadline if the soft deadline ended it
+func softDeadlineErr(parent, ctx context.Context) error {
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrSoftDeadline
+	}
+	return ctx.Err()
+}
+
+// contextLister fails the listings once ctx is done
+type contextLister struct {
+	ctx    context.Context
+	lister remoteLister
 }
 
-func calcFileHash(filePath string) string {
-	fp, err := os.Open(filePath)
+func (cl *contextLister) ListDir(dir string) (*ListResult, error) {
+	if err := cl.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cl.lister.ListDir(dir)
+}
+
+// RemoteFileInfo a remote file or directory as returned by the sync APIs, e.g. WalkFiles or LoadRemoteSnapshot
+type RemoteFileInfo struct {
+	Path         string
+	Type         string
+	Size         int64
+	ActualSize   int64
+	Hash         string
+	EncryptedKey string
+	LookupHash   string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// Mode permission bits, 0 when unknown
+	Mode os.FileMode
+	// Shared the remote file has collaborators
+	Shared bool
+}
+
+func newRemoteFileInfoEntry(p string, info fileInfo) RemoteFileInfo {
+	return RemoteFileInfo{
+		Path:         p,
+		Type:         info.Type,
+		Size:         info.Size,
+		ActualSize:   info.ActualSize,
+		Hash:         info.Hash,
+		EncryptedKey: info.EncryptedKey,
+		LookupHash:   info.LookupHash,
+		CreatedAt:    info.CreatedAt,
+		UpdatedAt:    info.UpdatedAt,
+		Mode:         info.Mode,
+		Shared:       info.Shared,
+	}
+}
+
+// remoteFileInfoMap gets the RemoteFileInfo of every entry of fMap
+func remoteFileInfoMap(fMap map[string]fileInfo) map[string]RemoteFileInfo {
+	infos := make(map[string]RemoteFileInfo, len(fMap))
+	for p, info := range fMap {
+		infos[p] = newRemoteFileInfoEntry(p, info)
+	}
+	return infos
+}
+
+// RemoteFileEntry a remote file or directory sent by StreamRemoteFiles
+type RemoteFileEntry struct {
+	Path string
+	Info RemoteFileInfo
+}
+
+// StreamRemoteFiles walks the remote allocation like GetRemoteFileMap but sends the entries of every directory as soon as it is listed,
+// so they can be processed while the walk goes on. The entries channel is closed when the walk ends,
+// the error channel then gets the error that stopped it, if any, and is closed.
+func (a *Allocation) StreamRemoteFiles(ctx context.Context, exclMap map[string]int) (<-chan RemoteFileEntry, <-chan error) {
+	return streamRemoteFiles(ctx, a, exclMap)
+}
+
+func streamRemoteFiles(ctx context.Context, lister remoteLister, exclMap map[string]int) (<-chan RemoteFileEntry, <-chan error) {
+	entries := make(chan RemoteFileEntry)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(entries)
+		dirs := []string{"/"}
+		for len(dirs) > 0 {
+			dir := dirs[0]
+			dirs = dirs[1:]
+			fMap := make(map[string]fileInfo)
+			childDirs, err := getRemoteFilesAndDirs(lister, []string{dir}, fMap, exclMap)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			dirs = append(dirs, childDirs...)
+
+			paths := make([]string, 0, len(fMap))
+			for p := range fMap {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			for _, p := range paths {
+				if err := ctx.Err(); err != nil {
+					errCh <- err
+					return
+				}
+				select {
+				case entries <- RemoteFileEntry{Path: p, Info: newRemoteFileInfoEntry(p, fMap[p])}:
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+	return entries, errCh
+}
+
+// GetVanishedRemoteFiles lists the paths saved in the last sync snapshot which are gone from the remote allocation.
+// It doesn't look at the local tree, a non empty result while nothing was deleted on purpose is a sign of remote data loss.
+func (a *Allocation) GetVanishedRemoteFiles(lastSyncCachePath string, remoteExcludePath []string) ([]string, error) {
+	return getVanishedRemoteFiles(a, lastSyncCachePath, remoteExcludePath)
+}
+
+func getVanishedRemoteFiles(lister remoteLister, lastSyncCachePath string, remoteExcludePath []string) ([]string, error) {
+	prevRemoteFileMap, err := loadRemoteSnapshot(lastSyncCachePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	exclMap := getRemoteExcludeMap(remoteExcludePath)
+	remoteFileMap, err := getRemoteFileMap(lister, exclMap)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.Wrap(err, ErrRemoteList)
+	}
+
+	var vanished []string
+	matcher := remoteMatcher(exclMap)
+	for rPath, info := range prevRemoteFileMap {
+		if _, ok := remoteFileMap[rPath]; ok || isRemoteExcluded(matcher, rPath, info) {
+			continue
+		}
+		vanished = append(vanished, rPath)
+	}
+	sort.Strings(vanished)
+	return vanished, nil
+}
+
+// isRemoteExcluded checks if the remote path or one of its parent directories is excluded
+func isRemoteExcluded(matcher *Matcher, remotePath string, info fileInfo) bool {
+	for p := remotePath; p != "/" && p != "."; p = path.Dir(p) {
+		if p != remotePath {
+			info = fileInfo{Type: fileref.DIRECTORY}
+		}
+		if skip, _ := matcher.Matches(p, remoteEntryInfo(p, info)); skip {
+			return true
+		}
+	}
+	return false
+}
+
+// calcFileHash the SHA-256 of the content, the actual file hash the uploader computes and ListDir reports as the hash of a file
+func calcFileHash(filePath string) (string, error) {
+	return defaultFileHasher.hash(filePath)
+}
+
+func calcFileMerkleRoot(filePath string, chunkSize int) (string, error) {
+	fp, err := os.Open(localLongPath(filePath))
+	if err != nil {
+		return "", err
 	}
 	defer fp.Close()
 
-	h := sha256.New()
-	if _, err := io.Copy(h, fp); err != nil {
-		log.Fatal(err)
+	mt := util.NewFixedMerkleTree(chunkSize)
+	if err := mt.Reload(fp); err != nil {
+		return "", err
 	}
-	return hex.EncodeToString(h.Sum(nil))
+	return mt.GetMerkleRoot(), nil
 }
 
 func getRemoteExcludeMap(exclPath []string) map[string]int {
 	exclMap := make(map[string]int)
 	for idx, path := range exclPath {
-		exclMap[strings.TrimRight(path, "/")] = idx
+		// a trailing / is part of a pattern, it only matches directories
+		if isExcludePattern(path) {
+			exclMap[path] = idx
+			continue
+		}
+		exclMap[strings.TrimRight(normalizePath(path), "/")] = idx
 	}
 	return exclMap
 }
 
-func addLocalFileList(root string, fMap map[string]fileInfo, dirList *[]string, filter map[string]bool, exclMap map[string]int) filepath.WalkFunc {
-	return func(path string, info os.FileInfo, err error) error {
+// normalizePath canonicalizes a remote path of the sync, so the same file listed as /docs//a.txt or /docs/./a.txt/
+// is compared as /docs/a.txt: a single leading slash, no trailing one, duplicate slashes and dot segments resolved.
+// The local walk gets clean paths from filepath.Rel.
+func normalizePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+func addLocalFileList(ctx context.Context, root string, fMap map[string]fileInfo, dirList *[]string, filter map[string]bool, exclMap map[string]int, so *syncOptions) filepath.WalkFunc {
+	links := make(map[inodeKey]string)
+	seen := make(map[string]bool)
+	visited := 0
+	lf := newLocalFilter(root, filter, exclMap, so)
+	walkedDirs := make(map[inodeKey]bool)
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if len(path) > maxLocalPathLength {
+			// reported and left out of the diff like an unreadable path, the rest of the tree is still synced
+			l.Logger.Error("Local path too long", path)
+			if info == nil {
+				return nil
+			}
+			if lPath, included, _, _ := lf.match(path, info); included {
+				fileType := fileref.FILE
+				if info.IsDir() {
+					fileType = fileref.DIRECTORY
+				}
+				fMap[lPath] = fileInfo{Type: fileType, Unreadable: true}
+				so.skipLongPath(lPath, errors.Wrap(ErrLocalPathTooLong, path))
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if err != nil {
 			l.Logger.Error("Local file list error for path", path, err.Error())
+			// the directory was listed before its entries failed to read, its subtree is left out of the diff
+			if info != nil && info.IsDir() {
+				if lPath, included, _, _ := lf.match(path, info); included {
+					fMap[lPath] = fileInfo{Type: fileref.DIRECTORY, Unreadable: true}
+					so.skipUnreadableDir(lPath, err)
+				}
+			}
 			return nil
 		}
-		// Filter out
-		if _, ok := filter[info.Name()]; ok {
+		lPath, included, prune, _ := lf.match(path, info)
+		if !included {
+			if prune && info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		lPath, err := filepath.Rel(root, path)
-		if err != nil {
-			l.Logger.Error("getting relative path failed", err)
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !so.followSymlinks {
+				so.skipSymlink(lPath, "symlinks are not followed")
+				return nil
+			}
+			target, err := os.Stat(localLongPath(path))
+			if err != nil {
+				so.skipSymlink(lPath, err.Error())
+				return nil
+			}
+			if target.IsDir() {
+				return walkSymlinkDir(path, lPath, target, walkedDirs, so, walk)
+			}
+			info = target
 		}
-		lPath = "/" + lPath
-		// Exclude
-		if _, ok := exclMap[lPath]; ok {
-			return nil
+		if info.IsDir() && so.followSymlinks {
+			if key, ok := getInodeKey(info); ok {
+				walkedDirs[key] = true
+			}
+		}
+		if so.dedupPaths {
+			lPath = filepath.ToSlash(filepath.Clean(lPath))
+			if seen[lPath] {
+				so.warnDuplicate(lPath, false)
+				return nil
+			}
+			seen[lPath] = true
+		}
+		if so.progress != nil {
+			visited++
+			so.progress(SyncProgress{Stage: ProgressLocalWalk, CurrentPath: lPath, Processed: visited})
 		}
 		// Add to list
 		if info.IsDir() {
 			*dirList = append(*dirList, lPath)
 		} else {
-			fMap[lPath] = fileInfo{Size: info.Size(), Hash: calcFileHash(path), Type: fileref.FILE}
+			var key inodeKey
+			var isLink bool
+			if so.detectHardlinks {
+				key, isLink = getFileInodeKey(info)
+				if first, ok := links[key]; isLink && ok {
+					fMap[lPath] = fileInfo{Size: info.Size(), Hash: fMap[first].Hash, Type: fileref.FILE, LinkTo: first, Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+					return nil
+				}
+			}
+			hash, err := so.hashFile(path)
+			if err != nil {
+				// The file was removed after it was visited, it is genuinely gone
+				if os.IsNotExist(err) {
+					l.Logger.Info("Local file disappeared during walk, skipping", path)
+					return nil
+				}
+				if err = so.hashError(path, err); err != nil {
+					return err
+				}
+				fMap[lPath] = fileInfo{Size: info.Size(), Type: fileref.FILE, Unreadable: true}
+				return nil
+			}
+			fMap[lPath] = fileInfo{Size: info.Size(), Hash: hash, Type: fileref.FILE, Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+			if isLink {
+				links[key] = lPath
+			}
+		}
+		return nil
+	}
+	return walk
+}
+
+// excludeUnreadable leaves the local files which couldn't be hashed and the subtrees of the local directories
+// which couldn't be read out of the diff, on both sides so their remote copy is neither deleted nor downloaded over them
+func excludeUnreadable(rMap, lMap, prevMap map[string]fileInfo) {
+	var dirs []string
+	for p, info := range lMap {
+		if info.Unreadable {
+			delete(lMap, p)
+			delete(rMap, p)
+			delete(prevMap, p)
+			if info.Type == fileref.DIRECTORY {
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	excludeSubtrees(dirs, rMap, lMap, prevMap)
+}
+
+// excludeSubtrees leaves the entries under dirs out of fMaps, e.g. the local and previous entries under the remote
+// directories which failed to list, so they are neither uploaded nor deleted for being missing remotely
+func excludeSubtrees(dirs []string, fMaps ...map[string]fileInfo) {
+	for _, dir := range dirs {
+		prefix := strings.TrimSuffix(dir, "/") + "/"
+		for _, fMap := range fMaps {
+			for p := range fMap {
+				if strings.HasPrefix(p, prefix) {
+					delete(fMap, p)
+				}
+			}
+		}
+	}
+}
+
+// validateLocalRoot checks the local root is an existing and readable directory before walking it
+func validateLocalRoot(rootPath string) error {
+	fInfo, err := sys.Files.Stat(rootPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrap(ErrLocalRootNotFound, rootPath)
+		}
+		return errors.Wrap(ErrLocalRootUnreadable, err.Error())
+	}
+	if !fInfo.IsDir() {
+		return errors.Wrap(ErrLocalRootNotDir, rootPath)
+	}
+	dir, err := os.Open(rootPath)
+	if err != nil {
+		return errors.Wrap(ErrLocalRootUnreadable, err.Error())
+	}
+	defer dir.Close()
+	if _, err = dir.Readdirnames(1); err != nil && err != io.EOF {
+		return errors.Wrap(ErrLocalRootUnreadable, err.Error())
+	}
+	return nil
+}
+
+// resolveLocalRoot validates the local root of a sync. A single file is synced with the remote path /<file name>,
+// it is then returned as the name of the file in its parent directory.
+func resolveLocalRoot(rootPath string) (dir string, singleFile string, err error) {
+	fInfo, err := sys.Files.Stat(rootPath)
+	if err == nil && fInfo.Mode().IsRegular() {
+		fp, err := os.Open(rootPath)
+		if err != nil {
+			return "", "", errors.Wrap(ErrLocalRootUnreadable, err.Error())
 		}
+		fp.Close()
+		return filepath.Dir(rootPath), "/" + filepath.Base(rootPath), nil
+	}
+	return rootPath, "", validateLocalRoot(rootPath)
+}
+
+// ValidateSyncRoots checks the roots of a sync before anything is scanned: the local root must be a readable directory
+// or file, and the remote root, if not empty, an absolute path of an existing remote directory.
+func (a *Allocation) ValidateSyncRoots(localRootPath string, remoteRootPath string) error {
+	if _, _, err := resolveLocalRoot(strings.TrimRight(localRootPath, "/")); err != nil {
+		return err
+	}
+	if remoteRootPath == "" {
 		return nil
 	}
+	return validateRemoteRoot(a, remoteRootPath)
+}
+
+// validateRemoteRoot checks that remoteRootPath is absolute, doesn't leave the allocation and is a listed directory
+func validateRemoteRoot(lister remoteLister, remoteRootPath string) error {
+	if !path.IsAbs(remoteRootPath) {
+		return errors.Wrap(ErrInvalidRemoteRoot, remoteRootPath)
+	}
+	for _, field := range strings.Split(remoteRootPath, "/") {
+		if field == ".." {
+			return errors.Wrap(ErrInvalidRemoteRoot, remoteRootPath)
+		}
+	}
+	ref, err := lister.ListDir(normalizePath(remoteRootPath))
+	if err != nil {
+		return errors.Wrap(err, ErrRemoteList)
+	}
+	if ref.Type != fileref.DIRECTORY {
+		return errors.Wrap(ErrRemoteRootNotDir, remoteRootPath)
+	}
+	return nil
 }
 
-func getLocalFileMap(rootPath string, filters []string, exclMap map[string]int) (map[string]fileInfo, error) {
+// restrictToFile keeps only the entry of the single file synced
+func restrictToFile(fMap map[string]fileInfo, singleFile string) map[string]fileInfo {
+	restricted := make(map[string]fileInfo)
+	if info, ok := fMap[singleFile]; ok {
+		restricted[singleFile] = info
+	}
+	return restricted
+}
+
+func getLocalFileMap(rootPath string, filters []string, exclMap map[string]int, so *syncOptions) (map[string]fileInfo, error) {
+	return walkLocalFileMap(context.Background(), rootPath, rootPath, filters, exclMap, so)
+}
+
+// walkLocalFileMap walks walkPath, which is rootPath or a file or directory under it, with the paths relative to rootPath
+func walkLocalFileMap(ctx context.Context, rootPath string, walkPath string, filters []string, exclMap map[string]int, so *syncOptions) (map[string]fileInfo, error) {
 	localMap := make(map[string]fileInfo)
 	var dirList []string
 	filterMap := make(map[string]bool)
 	for _, f := range filters {
 		filterMap[f] = true
 	}
-	err := filepath.Walk(rootPath, addLocalFileList(rootPath, localMap, &dirList, filterMap, exclMap))
+	err := filepath.Walk(walkPath, addLocalFileList(ctx, rootPath, localMap, &dirList, filterMap, exclMap, so))
 	// Add the dirs at the end of the list for dir deletiion after all file deletion
 	for _, d := range dirList {
 		localMap[d] = fileInfo{Type: fileref.DIRECTORY}
@@ -162,6 +711,89 @@ func getLocalFileMap(rootPath string, filters []string, exclMap map[string]int)
 	return localMap, err
 }
 
+func contentSize(info fileInfo) int64 {
+	if info.ActualSize > 0 {
+		return info.ActualSize
+	}
+	return info.Size
+}
+
+// computeTreeHashes computes for every directory in fMap a hash folding the name, size and hash of its files
+// and the tree hash of its sub directories. Children are sorted by name so the hash doesn't depend on listing order.
+func computeTreeHashes(fMap map[string]fileInfo) map[string]string {
+	children := make(map[string][]string)
+	for p := range fMap {
+		parent := path.Dir(p)
+		children[parent] = append(children[parent], p)
+	}
+
+	treeHashes := make(map[string]string)
+	var hashDir func(dir string) string
+	hashDir = func(dir string) string {
+		childPaths := children[dir]
+		sort.Strings(childPaths)
+		parts := make([]string, 0, len(childPaths))
+		for _, childPath := range childPaths {
+			info := fMap[childPath]
+			if info.Type == fileref.DIRECTORY {
+				parts = append(parts, fmt.Sprintf("%s:d:%s", path.Base(childPath), hashDir(childPath)))
+			} else {
+				parts = append(parts, fmt.Sprintf("%s:f:%d:%s", path.Base(childPath), contentSize(info), info.Hash))
+			}
+		}
+		treeHashes[dir] = encryption.Hash(strings.Join(parts, "/"))
+		return treeHashes[dir]
+	}
+
+	for p, info := range fMap {
+		if _, ok := treeHashes[p]; !ok && info.Type == fileref.DIRECTORY {
+			hashDir(p)
+		}
+	}
+	return treeHashes
+}
+
+// pruneMatchingSubtrees removes from both maps the directories, and everything under them,
+// whose tree hash is the same on the remote and the local side.
+func pruneMatchingSubtrees(rMap map[string]fileInfo, lMap map[string]fileInfo) []string {
+	rTreeHashes := computeTreeHashes(rMap)
+	lTreeHashes := computeTreeHashes(lMap)
+
+	dirs := make([]string, 0, len(rTreeHashes))
+	for dir := range rTreeHashes {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var pruned []string
+	for _, dir := range dirs {
+		if dir == "/" || isParentFolderPruned(pruned, dir) {
+			continue
+		}
+		if lHash, ok := lTreeHashes[dir]; ok && lHash == rTreeHashes[dir] {
+			pruned = append(pruned, dir)
+		}
+	}
+
+	for _, fMap := range []map[string]fileInfo{rMap, lMap} {
+		for p := range fMap {
+			if isParentFolderPruned(pruned, p) {
+				delete(fMap, p)
+			}
+		}
+	}
+	return pruned
+}
+
+func isParentFolderPruned(pruned []string, p string) bool {
+	for _, dir := range pruned {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func isParentFolderExists(lFDiff []FileDiff, path string) bool {
 	subdirs := strings.Split(path, "/")
 	p := "/"
@@ -176,6 +808,36 @@ func isParentFolderExists(lFDiff []FileDiff, path string) bool {
 	return false
 }
 
+// hasTransferUnder checks if a file under dir is planned for anything but a deletion
+func hasTransferUnder(lFDiff []FileDiff, dir string) bool {
+	prefix := dir + "/"
+	for _, f := range lFDiff {
+		if f.Op != LocalDelete && f.Op != Delete && f.Type == fileref.FILE && strings.HasPrefix(f.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findModeDelta returns a Chmod for every file with the same content on both sides but different permission bits.
+// Remote files without mode, as listed by blobbers that don't store it, are skipped. They are returned in path order.
+func findModeDelta(rMap map[string]fileInfo, lMap map[string]fileInfo) []FileDiff {
+	var lFDiff []FileDiff
+	for rPath, rInfo := range rMap {
+		lInfo, ok := lMap[rPath]
+		if !ok || rInfo.Type != fileref.FILE || rInfo.Mode == 0 || rInfo.Hash != lInfo.Hash {
+			continue
+		}
+		if lInfo.Mode != rInfo.Mode {
+			lFDiff = append(lFDiff, FileDiff{Path: rPath, Op: Chmod, Type: rInfo.Type})
+		}
+	}
+	sort.Slice(lFDiff, func(i, j int) bool { return lFDiff[i].Path < lFDiff[j].Path })
+	return lFDiff
+}
+
+// findDelta compares the remote, local and previous states. The maps are walked in random order, the result is
+// sorted by path so it is the same on every run: a directory comes before what it holds and each path is planned once.
 func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[string]fileInfo, localRootPath string) []FileDiff {
 	var lFDiff []FileDiff
 
@@ -204,7 +866,6 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 	}
 
 	// Iterate remote list and get diff
-	rDelMap := make(map[string]string)
 	for rPath := range rMap {
 		op := Download
 		bRemoteModified := false
@@ -226,13 +887,6 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 			continue
 		} else if _, ok := prevMap[rPath]; ok {
 			op = Delete
-			// Remote allows delete directory skip individual file deletion
-			rDelMap[rPath] = "d"
-			rDir, _ := filepath.Split(rPath)
-			rDir = strings.TrimRight(rDir, "/")
-			if _, ok := rDelMap[rDir]; ok {
-				continue
-			}
 		}
 		lFDiff = append(lFDiff, FileDiff{Path: rPath, Op: op, Type: rMap[rPath].Type})
 	}
@@ -248,7 +902,7 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 		if op != LocalDelete {
 			// Skip if it is a directory
 			lAbsPath := filepath.Join(localRootPath, lPath)
-			fInfo, err := sys.Files.Stat(lAbsPath)
+			fInfo, err := sys.Files.Stat(localLongPath(lAbsPath))
 			if err != nil {
 				continue
 			}
@@ -256,6 +910,10 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 				continue
 			}
 		}
+		if linkTo := lMap[lPath].LinkTo; linkTo != "" && op != LocalDelete {
+			lFDiff = append(lFDiff, FileDiff{Path: lPath, Op: Link, Type: lMap[lPath].Type, LinkTo: linkTo})
+			continue
+		}
 		lFDiff = append(lFDiff, FileDiff{Path: lPath, Op: op, Type: lMap[lPath].Type})
 	}
 
@@ -266,6 +924,10 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 		var newlFDiff []FileDiff
 		for _, f := range lFDiff {
 			if f.Op == LocalDelete || f.Op == Delete {
+				// A directory still holding files to transfer is not deleted as a whole, its files are deleted one by one
+				if f.Type == fileref.DIRECTORY && hasTransferUnder(lFDiff, f.Path) {
+					continue
+				}
 				if !isParentFolderExists(newlFDiff, f.Path) {
 					newlFDiff = append(newlFDiff, f)
 				}
@@ -281,85 +943,667 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 	return lFDiff
 }
 
-func (a *Allocation) GetAllocationDiff(lastSyncCachePath string, localRootPath string, localFileFilters []string, remoteExcludePath []string) ([]FileDiff, error) {
+// findRemoteAuthoritativeDelta downloads every remote file whose local copy is missing or differs, without looking
+// for conflicts. Local only files and directories are deleted when deleteLocalOnly is set, they are left alone otherwise.
+func findRemoteAuthoritativeDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, deleteLocalOnly bool) []FileDiff {
+	var lFDiff []FileDiff
+	for rPath, rInfo := range rMap {
+		if rInfo.Type != fileref.FILE {
+			continue
+		}
+		if lInfo, ok := lMap[rPath]; ok && lInfo.Hash == rInfo.Hash {
+			continue
+		}
+		lFDiff = append(lFDiff, FileDiff{Path: rPath, Op: Download, Type: rInfo.Type})
+	}
+	if deleteLocalOnly {
+		// directories holding remote files are kept even if the remote listing has no entry for them
+		remoteDirs := make(map[string]bool)
+		for rPath := range rMap {
+			for p := path.Dir(rPath); p != "/" && p != "."; p = path.Dir(p) {
+				remoteDirs[p] = true
+			}
+		}
+		var deletes []FileDiff
+		for lPath, lInfo := range lMap {
+			if _, ok := rMap[lPath]; ok || remoteDirs[lPath] || lPath == "/." {
+				continue
+			}
+			deletes = append(deletes, FileDiff{Path: lPath, Op: LocalDelete, Type: lInfo.Type})
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path < deletes[j].Path })
+		var collapsed []FileDiff
+		for _, d := range deletes {
+			if !isParentFolderExists(collapsed, d.Path) {
+				collapsed = append(collapsed, d)
+			}
+		}
+		lFDiff = append(lFDiff, collapsed...)
+	}
+	sort.SliceStable(lFDiff, func(i, j int) bool { return lFDiff[i].Path < lFDiff[j].Path })
+	return lFDiff
+}
+
+// findCheckedDelta runs findDelta and, if enabled, verifies the plan with checkDiffConsistency
+func findCheckedDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[string]fileInfo, localRootPath string, so *syncOptions) ([]FileDiff, error) {
+	excludeUnreadable(rMap, lMap, prevMap)
+	var dirDiffs []FileDiff
+	if so.syncEmptyDirs {
+		// computed first, findDelta consumes lMap
+		dirDiffs = findNewDirs(rMap, lMap, prevMap, !so.remoteAuthoritative)
+	}
+	if so.remoteAuthoritative {
+		return setDiffSizes(mergeDirDiffs(findRemoteAuthoritativeDelta(rMap, lMap, so.deleteLocalOnly), dirDiffs), rMap, lMap), nil
+	}
+	// findDelta consumes the local map, which is still needed after it
+	lCopy := make(map[string]fileInfo, len(lMap))
+	for p, info := range lMap {
+		lCopy[p] = info
+	}
+	lFdiff := findDelta(rMap, lCopy, prevMap, localRootPath)
+	if so.checkDiff {
+		if err := checkDiffConsistency(rMap, lMap, prevMap, lFdiff); err != nil {
+			return nil, err
+		}
+	}
+	if so.conflictPolicy != Manual {
+		resolveConflicts(lFdiff, rMap, lMap, so.conflictPolicy)
+	}
+	if so.detectRenames {
+		lFdiff = detectRenames(lFdiff, rMap, lMap)
+	}
+	return setDiffSizes(mergeDirDiffs(lFdiff, dirDiffs), rMap, lMap), nil
+}
+
+// setDiffSizes sets in place the size, hash and modification time of the files of diffs, from the side the operation
+// reads the file from: the local one for the uploads and local deletes, the remote one for the others
+func setDiffSizes(diffs []FileDiff, rMap, lMap map[string]fileInfo) []FileDiff {
+	for i, d := range diffs {
+		if d.Type != fileref.FILE {
+			continue
+		}
+		fMap := rMap
+		switch d.Op {
+		case Upload, Update, Link, Rename, LocalDelete:
+			fMap = lMap
+		}
+		info, ok := fMap[d.Path]
+		if !ok {
+			continue
+		}
+		diffs[i].Size = contentSize(info)
+		diffs[i].Hash = info.Hash
+		if !info.ModTime.IsZero() {
+			diffs[i].ModTime = info.ModTime.Unix()
+		}
+	}
+	return diffs
+}
+
+// ConflictPolicy how the files changed on both sides since the last sync are planned
+type ConflictPolicy int
+
+const (
+	// Manual the files are planned as Conflict, for the caller to resolve
+	Manual ConflictPolicy = iota
+	// PreferLocal the local files are uploaded over the remote ones, as an Update
+	PreferLocal
+	// PreferRemote the remote files are downloaded over the local ones
+	PreferRemote
+	// PreferNewer the file modified last wins, a conflict between files modified at the same time is left as is
+	PreferNewer
+)
+
+// resolveConflicts replaces in place the Conflict operations of diffs the policy decides by an Update or a Download
+func resolveConflicts(diffs []FileDiff, rMap, lMap map[string]fileInfo, policy ConflictPolicy) {
+	for i, d := range diffs {
+		if d.Op != Conflict {
+			continue
+		}
+		switch policy {
+		case PreferLocal:
+			diffs[i].Op = Update
+		case PreferRemote:
+			diffs[i].Op = Download
+		case PreferNewer:
+			lTime, rTime := lMap[d.Path].ModTime, rMap[d.Path].ModTime
+			if lTime.After(rTime) {
+				diffs[i].Op = Update
+			} else if rTime.After(lTime) {
+				diffs[i].Op = Download
+			}
+		}
+	}
+}
+
+// findNewDirs plans the creation of the directories new on one side, which findDelta leaves out as they are created
+// with the files transferred into them: an empty one would never be. Local directories are created remotely only if upload is set.
+func findNewDirs(rMap, lMap, prevMap map[string]fileInfo, upload bool) []FileDiff {
+	var dirDiffs []FileDiff
+	for rPath, rInfo := range rMap {
+		if _, ok := lMap[rPath]; ok || rInfo.Type != fileref.DIRECTORY {
+			continue
+		}
+		if _, ok := prevMap[rPath]; !ok {
+			dirDiffs = append(dirDiffs, FileDiff{Op: LocalCreateDir, Path: rPath, Type: fileref.DIRECTORY})
+		}
+	}
+	if !upload {
+		return dirDiffs
+	}
+	for lPath, lInfo := range lMap {
+		if _, ok := rMap[lPath]; ok || lInfo.Type != fileref.DIRECTORY || lPath == "/." {
+			continue
+		}
+		if _, ok := prevMap[lPath]; !ok {
+			dirDiffs = append(dirDiffs, FileDiff{Op: CreateDir, Path: lPath, Type: fileref.DIRECTORY})
+		}
+	}
+	return dirDiffs
+}
+
+// mergeDirDiffs adds the directory creations to the plan in path order, so a directory is created before the files it holds
+func mergeDirDiffs(diffs []FileDiff, dirDiffs []FileDiff) []FileDiff {
+	if len(dirDiffs) == 0 {
+		return diffs
+	}
+	merged := append(dirDiffs, diffs...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Path < merged[j].Path })
+	return merged
+}
+
+// detectRenames replaces a file deleted on one side and a file with the same content transferred from that side
+// by a single rename: a Delete and an Upload become a Rename, a LocalDelete and a Download a LocalRename.
+// The files are paired in path order, a rename takes the place of its transfer in the plan.
+// Files deleted with their directory are not paired.
+func detectRenames(diffs []FileDiff, rMap, lMap map[string]fileInfo) []FileDiff {
+	// deleted files by side and hash, in path order
+	remoteDeleted := make(map[string][]string)
+	localDeleted := make(map[string][]string)
+	for _, d := range diffs {
+		if d.Type != fileref.FILE {
+			continue
+		}
+		switch d.Op {
+		case Delete:
+			remoteDeleted[rMap[d.Path].Hash] = append(remoteDeleted[rMap[d.Path].Hash], d.Path)
+		case LocalDelete:
+			localDeleted[lMap[d.Path].Hash] = append(localDeleted[lMap[d.Path].Hash], d.Path)
+		}
+	}
+	if len(remoteDeleted) == 0 && len(localDeleted) == 0 {
+		return diffs
+	}
+
+	renamed := make(map[string]FileDiff)
+	consumed := make(map[string]bool)
+	pair := func(d FileDiff, deleted map[string][]string, hash string, op string) {
+		candidates := deleted[hash]
+		if hash == "" || len(candidates) == 0 {
+			return
+		}
+		deleted[hash] = candidates[1:]
+		consumed[candidates[0]] = true
+		renamed[d.Path] = FileDiff{Op: op, Path: d.Path, Type: d.Type, OldPath: candidates[0]}
+	}
+	for _, d := range diffs {
+		switch d.Op {
+		case Upload:
+			pair(d, remoteDeleted, lMap[d.Path].Hash, Rename)
+		case Download:
+			pair(d, localDeleted, rMap[d.Path].Hash, LocalRename)
+		}
+	}
+
+	var result []FileDiff
+	for _, d := range diffs {
+		if (d.Op == Delete || d.Op == LocalDelete) && consumed[d.Path] {
+			continue
+		}
+		if r, ok := renamed[d.Path]; ok && (d.Op == Upload || d.Op == Download) {
+			d = r
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// GetAllocationDiff - Gets the operations syncing the local tree and the allocation. The plan is the same for the same states:
+// operations are in path order, so a directory is created or deleted before its content, followed by the Chmod operations in path order.
+// Local directories which couldn't be read are returned as LocalReadErrors, with the plan of the rest of the tree.
+func (a *Allocation) GetAllocationDiff(lastSyncCachePath string, localRootPath string, localFileFilters []string, remoteExcludePath []string, opts ...SyncOption) ([]FileDiff, error) {
+	return a.GetAllocationDiffContext(context.Background(), lastSyncCachePath, localRootPath, localFileFilters, remoteExcludePath, opts...)
+}
+
+// GetAllocationDiffContext - Gets the diff like GetAllocationDiff, the remote and local walks stop as soon as ctx is done and ctx error is returned.
+func (a *Allocation) GetAllocationDiffContext(ctx context.Context, lastSyncCachePath string, localRootPath string, localFileFilters []string, remoteExcludePath []string, opts ...SyncOption) ([]FileDiff, error) {
 	var lFdiff []FileDiff
+	so := newSyncOptions(opts)
+	parent := ctx
+	if !so.softDeadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, so.softDeadline)
+		defer cancel()
+	}
+	// The local root is checked before anything is listed
+	localRootPath, singleFile, err := resolveLocalRoot(strings.TrimRight(localRootPath, "/"))
+	if err != nil {
+		return lFdiff, err
+	}
+
+	// 1. Load the previous sync state
+	prevRemoteFileMap, err := loadPrevSnapshot(lastSyncCachePath, so)
+	if err != nil {
+		return lFdiff, err
+	}
+
+	// 2. Build a map for exclude path
+	exclMap := getRemoteExcludeMap(remoteExcludePath)
+
+	// 3. Get flat file list from remote
+	var lister remoteLister = a
+	if so.remoteCache != nil {
+		lister = &cachedLister{lister: a, cache: so.remoteCache}
+	}
+	if so.dedupPaths {
+		lister = &dedupLister{lister: lister, so: so}
+	}
+	if so.remoteFilter != nil {
+		lister = &filterLister{lister: lister, matcher: NewMatcher(skipUnless("excluded by the remote filter", so.remoteFilter))}
+	}
+	remoteFileMap, err := getRemoteFileMap(&contextLister{ctx: ctx, lister: withProgress(lister, so.progress)}, exclMap)
+	if ctx.Err() != nil {
+		return nil, softDeadlineErr(parent, ctx)
+	}
+	var failedDirs []string
+	if listErrs, ok := err.(RemoteListErrors); ok && !listErrs.hasRoot() {
+		// the rest of the tree is still diffed
+		failedDirs = listErrs.Dirs()
+		l.Logger.Error("Remote directories failed to list, leaving them out of the diff", listErrs.Error())
+	} else if err != nil {
+		return lFdiff, errors.Wrap(err, ErrRemoteList)
+	}
+
+	// 4. Get flat file list on the local filesystem
+	// the sync state saved under the local root is not synced itself
+	so.skipLocalPaths = cacheFilePaths(lastSyncCachePath, localRootPath)
+	localFileList, err := walkLocalFileMap(ctx, localRootPath, filepath.Join(localRootPath, singleFile), localFileFilters, exclMap, so)
+	if ctx.Err() != nil {
+		return nil, softDeadlineErr(parent, ctx)
+	}
+	if err != nil {
+		return lFdiff, errors.Wrap(err, ErrLocalList)
+	}
+	excludeSubtrees(failedDirs, localFileList, prevRemoteFileMap)
+	for p := range so.skipLocalPaths {
+		// nor is a remote copy of it downloaded over it
+		delete(remoteFileMap, p)
+		delete(prevRemoteFileMap, p)
+	}
+	if singleFile != "" {
+		remoteFileMap = restrictToFile(remoteFileMap, singleFile)
+		prevRemoteFileMap = restrictToFile(prevRemoteFileMap, singleFile)
+	}
+	if so.verifyRemote {
+		if err = verifyRemoteHashes(ctx, a, remoteFileMap, localFileList); err != nil {
+			if ctx.Err() != nil {
+				return nil, softDeadlineErr(parent, ctx)
+			}
+			return lFdiff, err
+		}
+	}
+	if so.caseInsensitive {
+		localFileList = foldLocalCase(remoteFileMap, localFileList)
+	}
+	if so.encryptor != nil {
+		if err = applyEncryptedHashes(remoteFileMap, localFileList, localRootPath, so.encryptor); err != nil {
+			return lFdiff, err
+		}
+	}
+
+	// 5. Leave out the remote files the flags exclude, on both sides so they are never overwritten
+	if so.excludeRemoteFlags != 0 {
+		for _, p := range excludeByRemoteFlags(remoteFileMap, localFileList, prevRemoteFileMap, so.excludeRemoteFlags) {
+			l.Logger.Info("Remote file excluded from sync by its flags", p)
+		}
+	}
+
+	// 6. Skip the subtrees which are the same on both sides
+	if so.compareDirHashes {
+		pruned := pruneMatchingSubtrees(remoteFileMap, localFileList)
+		l.Logger.Debug("Unchanged subtrees: ", pruned)
+	}
+
+	// 7. Get the permission differences before findDelta consumes the local map
+	var modeDiff []FileDiff
+	if so.syncRemoteMode {
+		modeDiff = findModeDelta(remoteFileMap, localFileList)
+	}
+
+	// 8. Get the file diff with operation
+	lFdiff, err = findCheckedDelta(remoteFileMap, localFileList, prevRemoteFileMap, localRootPath, so)
+	if err != nil {
+		return nil, err
+	}
+	lFdiff = append(lFdiff, modeDiff...)
+	if so.packMaxFileSize > 0 {
+		lFdiff = packSmallFiles(lFdiff, localRootPath, so.packMaxFileSize, so.packMinFiles)
+	}
+	l.Logger.Debug("Diff: ", lFdiff)
+	if len(so.unreadableDirs) > 0 {
+		return lFdiff, so.unreadableDirs
+	}
+	return lFdiff, nil
+}
+
+// cacheFilePaths gets the remote paths of the sync state file and of its metadata when they are under the local root
+func cacheFilePaths(lastSyncCachePath string, localRootPath string) map[string]bool {
+	if lastSyncCachePath == "" {
+		return nil
+	}
+	cachePath, err := filepath.Abs(lastSyncCachePath)
+	if err != nil {
+		return nil
+	}
+	root, err := filepath.Abs(localRootPath)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(root, cachePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	p := "/" + filepath.ToSlash(rel)
+	return map[string]bool{p: true, snapshotMetaPath(p): true}
+}
+
+// loadPrevSnapshot reads the previous sync state, the snapshot of WithPrevSnapshot or else the one saved to lastSyncCachePath.
+// Without any, the state is empty.
+func loadPrevSnapshot(lastSyncCachePath string, so *syncOptions) (map[string]fileInfo, error) {
+	if so.prevSnapshot != nil {
+		return decodeRemoteSnapshot(so.prevSnapshot, so.snapshotPublicKey)
+	}
 	prevRemoteFileMap := make(map[string]fileInfo)
-	// 1. Validate localSycnCachePath
 	if len(lastSyncCachePath) > 0 {
 		// Validate cache path
 		fileInfo, err := sys.Files.Stat(lastSyncCachePath)
 		if err == nil {
 			if fileInfo.IsDir() {
-				return lFdiff, errors.Wrap(err, "invalid file cache.")
+				return nil, errors.Wrap(errors.New("", lastSyncCachePath+" is a directory"), ErrInvalidCacheFile)
 			}
 			content, err := ioutil.ReadFile(lastSyncCachePath)
 			if err != nil {
-				return lFdiff, errors.New("", "can't read cache file.")
+				return nil, errors.Wrap(err, ErrReadCache)
 			}
-			err = json.Unmarshal(content, &prevRemoteFileMap)
+			prevRemoteFileMap, err = decodeRemoteSnapshot(content, so.snapshotPublicKey)
 			if err != nil {
-				return lFdiff, errors.New("", "invalid cache content.")
+				return nil, err
+			}
+			if meta, err := ReadRemoteSnapshotMeta(lastSyncCachePath); err == nil && meta.Partial {
+				l.Logger.Info("Previous sync state is partial, remote deletions under these directories are not detected", meta.FailedDirs)
 			}
 		}
 	}
+	return prevRemoteFileMap, nil
+}
 
-	// 2. Build a map for exclude path
+// GetManifestDiff - Gets the diff of the local tree against a desired remote state.
+// The manifest maps remote paths to content hashes and stands in for the live remote
+// listing, so the returned operations describe how to make the allocation match it.
+// Local directories which couldn't be read are returned as LocalReadErrors like for GetAllocationDiff.
+func GetManifestDiff(manifest map[string]string, localRootPath string, localFileFilters []string, remoteExcludePath []string, opts ...SyncOption) ([]FileDiff, error) {
+	var lFdiff []FileDiff
+	so := newSyncOptions(opts)
 	exclMap := getRemoteExcludeMap(remoteExcludePath)
 
-	// 3. Get flat file list from remote
-	remoteFileMap, err := a.GetRemoteFileMap(exclMap)
+	manifestFileMap := make(map[string]fileInfo)
+	matcher := remoteMatcher(exclMap)
+	for path, hash := range manifest {
+		if skip, _ := matcher.Matches(path, remoteEntryInfo(path, fileInfo{Type: fileref.FILE})); skip {
+			continue
+		}
+		manifestFileMap[path] = fileInfo{Hash: hash, Type: fileref.FILE}
+	}
+
+	localRootPath, singleFile, err := resolveLocalRoot(strings.TrimRight(localRootPath, "/"))
+	if err != nil {
+		return lFdiff, err
+	}
+	localFileList, err := walkLocalFileMap(context.Background(), localRootPath, filepath.Join(localRootPath, singleFile), localFileFilters, exclMap, so)
 	if err != nil {
-		return lFdiff, errors.Wrap(err, "error getting list dir from remote.")
+		return lFdiff, errors.Wrap(err, ErrLocalList)
+	}
+	if singleFile != "" {
+		manifestFileMap = restrictToFile(manifestFileMap, singleFile)
 	}
 
-	// 4. Get flat file list on the local filesystem
-	localRootPath = strings.TrimRight(localRootPath, "/")
-	localFileList, err := getLocalFileMap(localRootPath, localFileFilters, exclMap)
+	lFdiff, err = findCheckedDelta(manifestFileMap, localFileList, make(map[string]fileInfo), localRootPath, so)
 	if err != nil {
-		return lFdiff, errors.Wrap(err, "error getting list dir from local.")
+		return nil, err
 	}
+	if so.packMaxFileSize > 0 {
+		lFdiff = packSmallFiles(lFdiff, localRootPath, so.packMaxFileSize, so.packMinFiles)
+	}
+	l.Logger.Debug("Manifest diff: ", lFdiff)
+	if len(so.unreadableDirs) > 0 {
+		return lFdiff, so.unreadableDirs
+	}
+	return lFdiff, nil
+}
 
-	// 5. Get the file diff with operation
-	lFdiff = findDelta(remoteFileMap, localFileList, prevRemoteFileMap, localRootPath)
-	l.Logger.Debug("Diff: ", lFdiff)
+// PlanReupload - Gets the Upload operations restoring the given remote paths from the local tree
+// without a full diff, e.g. after they were deleted from the allocation out of band. A directory path is restored with
+// all the files under it. Paths missing locally are reported by the returned error, the plan for the others is still returned.
+func PlanReupload(localRootPath string, paths []string) ([]FileDiff, error) {
+	var lFdiff []FileDiff
+	var missing []string
+	localRootPath = strings.TrimRight(localRootPath, "/")
+	for _, p := range paths {
+		remotePath := path.Clean("/" + p)
+		lAbsPath := filepath.Join(localRootPath, filepath.FromSlash(remotePath))
+		fInfo, err := sys.Files.Stat(localLongPath(lAbsPath))
+		if err != nil {
+			if os.IsNotExist(err) {
+				missing = append(missing, remotePath)
+				continue
+			}
+			return nil, err
+		}
+		if !fInfo.IsDir() {
+			lFdiff = append(lFdiff, FileDiff{Path: remotePath, Op: Upload, Type: fileref.FILE})
+			continue
+		}
+		err = filepath.Walk(lAbsPath, func(walkPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(lAbsPath, walkPath)
+			if err != nil {
+				return err
+			}
+			lFdiff = append(lFdiff, FileDiff{Path: path.Join(remotePath, filepath.ToSlash(rel)), Op: Upload, Type: fileref.FILE})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return lFdiff, errors.Newf("missing_local_files", "paths not found in local tree: %v", strings.Join(missing, ", "))
+	}
 	return lFdiff, nil
 }
 
-// SaveRemoteSnapShot - Saves the remote current information to the given file
-// This file can be passed to GetAllocationDiff to exactly find the previous sync state to current.
-func (a *Allocation) SaveRemoteSnapshot(pathToSave string, remoteExcludePath []string) error {
-	bIsFileExists := false
-	// Validate path
-	fileInfo, err := sys.Files.Stat(pathToSave)
-	if err == nil {
-		if fileInfo.IsDir() {
-			return errors.Wrap(err, "invalid file path to save.")
+// DiffSummary counts of the operations of a sync plan and the bytes they transfer each way
+type DiffSummary struct {
+	// UploadCount files uploaded, by an Upload, Update or Link, or as the members of a Pack
+	UploadCount   int
+	DownloadCount int
+	// DeleteCount remote and local deletes
+	DeleteCount   int
+	ConflictCount int
+	UploadBytes   int64
+	DownloadBytes int64
+}
+
+// SummarizeDiff - Sums up a sync plan from the sizes GetAllocationDiff sets on its operations
+func SummarizeDiff(diffs []FileDiff) DiffSummary {
+	var summary DiffSummary
+	for _, d := range diffs {
+		switch d.Op {
+		case Upload, Update, Link:
+			summary.UploadCount++
+			summary.UploadBytes += d.Size
+		case Pack:
+			summary.UploadCount += len(d.Members)
+			summary.UploadBytes += d.Size
+		case Download:
+			summary.DownloadCount++
+			summary.DownloadBytes += d.Size
+		case Delete, LocalDelete:
+			summary.DeleteCount++
+		case Conflict:
+			summary.ConflictCount++
 		}
-		bIsFileExists = true
 	}
+	return summary
+}
 
-	// Get flat file list from remote
-	exclMap := getRemoteExcludeMap(remoteExcludePath)
-	remoteFileList, err := a.GetRemoteFileMap(exclMap)
+// DiffLimits caps the part of a sync plan applied in one run. A zero value disables the cap.
+type DiffLimits struct {
+	MaxBytes int64
+	MaxCount int
+}
+
+// diffTransferSize gets the bytes an operation transfers, only local files are sized
+func diffTransferSize(d FileDiff, localRootPath string) int64 {
+	if d.Op == Pack {
+		var size int64
+		for _, m := range d.Members {
+			size += diffTransferSize(FileDiff{Op: Upload, Path: m}, localRootPath)
+		}
+		return size
+	}
+	if d.Op != Upload && d.Op != Update {
+		return 0
+	}
+	fInfo, err := sys.Files.Stat(localLongPath(filepath.Join(localRootPath, filepath.FromSlash(d.Path))))
 	if err != nil {
-		return errors.Wrap(err, "error getting list dir from remote.")
+		return 0
 	}
+	return fInfo.Size()
+}
 
-	// Now we got the list from remote, delete the file if exists
-	if bIsFileExists {
-		err = os.Remove(pathToSave)
-		if err != nil {
-			return errors.Wrap(err, "error deleting previous cache.")
+// LimitDiff - Splits the plan into the operations to apply in this run and the remaining ones, keeping their order.
+// It stops at the first operation that would go over either cap, an operation bigger than MaxBytes on its own
+// is still taken when it comes first so every run makes progress.
+func LimitDiff(diffs []FileDiff, localRootPath string, limits DiffLimits) (batch []FileDiff, remaining []FileDiff) {
+	var bytes int64
+	for i, d := range diffs {
+		if limits.MaxCount > 0 && len(batch) >= limits.MaxCount {
+			return batch, diffs[i:]
+		}
+		size := diffTransferSize(d, localRootPath)
+		if limits.MaxBytes > 0 && bytes+size > limits.MaxBytes && len(batch) > 0 {
+			return batch, diffs[i:]
 		}
+		bytes += size
+		batch = append(batch, d)
 	}
-	by, err := json.Marshal(remoteFileList)
-	if err != nil {
-		return errors.Wrap(err, "failed to convert JSON.")
+	return batch, nil
+}
+
+// RequiredRemoteDirs - Gets the remote directories to create before applying the plan, parents first.
+// These are the parent directories of the uploaded files, minus the ones the plan shows to exist remotely
+// because a file under them is updated, downloaded or deleted.
+func RequiredRemoteDirs(diffs []FileDiff) []string {
+	existing := make(map[string]bool)
+	required := make(map[string]bool)
+	for _, d := range diffs {
+		dir := path.Dir(d.Path)
+		switch d.Op {
+		case Upload, Link:
+		case Pack:
+			dir = d.Path
+		case Rename:
+			for p := path.Dir(d.OldPath); p != "/"; p = path.Dir(p) {
+				existing[p] = true
+			}
+		case Update, Download, Delete, Conflict, Chmod:
+			for p := path.Dir(d.Path); p != "/"; p = path.Dir(p) {
+				existing[p] = true
+			}
+			continue
+		default:
+			continue
+		}
+		for ; dir != "/" && dir != "."; dir = path.Dir(dir) {
+			required[dir] = true
+		}
 	}
-	err = ioutil.WriteFile(pathToSave, by, 0644)
-	if err != nil {
-		return errors.Wrap(err, "error saving file.")
+
+	dirs := make([]string, 0, len(required))
+	for dir := range required {
+		if !existing[dir] {
+			dirs = append(dirs, dir)
+		}
 	}
-	// Successfully saved
-	return nil
+	// a parent is a prefix of its children so it sorts first
+	sort.Strings(dirs)
+	return dirs
+}
+
+// packSmallFiles groups the uploads of files up to maxFileSize in the same directory into a Pack, when there are at least minFiles of them.
+// A Pack takes the place of its first member in the plan, the other operations keep their order.
+func packSmallFiles(diffs []FileDiff, localRootPath string, maxFileSize int64, minFiles int) []FileDiff {
+	if minFiles < 2 {
+		minFiles = 2
+	}
+	groups := make(map[string][]string)
+	sizes := make(map[string]int64)
+	for _, d := range diffs {
+		if d.Op == Upload && d.Type == fileref.FILE && diffTransferSize(d, localRootPath) <= maxFileSize {
+			dir := path.Dir(d.Path)
+			groups[dir] = append(groups[dir], d.Path)
+			sizes[dir] += d.Size
+		}
+	}
+
+	var packed []FileDiff
+	for _, d := range diffs {
+		if d.Op != Upload || d.Type != fileref.FILE {
+			packed = append(packed, d)
+			continue
+		}
+		dir := path.Dir(d.Path)
+		members := groups[dir]
+		if len(members) < minFiles || !containsString(members, d.Path) {
+			packed = append(packed, d)
+			continue
+		}
+		if members[0] == d.Path {
+			packed = append(packed, FileDiff{Op: Pack, Path: dir, Type: fileref.DIRECTORY, Members: members, Size: sizes[dir]})
+		}
+	}
+	return packed
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveRemoteSnapShot - Saves the remote current information to the given file
+// This file can be passed to GetAllocationDiff to exactly find the previous sync state to current.
+// Of the sync options, only WithProgress applies: it reports the remote listing.
+func (a *Allocation) SaveRemoteSnapshot(pathToSave string, remoteExcludePath []string, opts ...SyncOption) error {
+	_, err := a.SaveRemoteSnapshotWithOptions(pathToSave, newRemoteSnapshotOptions(remoteExcludePath, opts))
+	return err
 }
@@ -0,0 +1,212 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/sys"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// Actions of a DiffResult, the allocation or local operation a FileDiff maps to
+const (
+	ActionUpload         = "upload"
+	ActionUpdate         = "update"
+	ActionDownload       = "download"
+	ActionDelete         = "delete"
+	ActionMove           = "move"
+	ActionRename         = "rename"
+	ActionCreateDir      = "create_dir"
+	ActionLocalDelete    = "local_delete"
+	ActionLocalRename    = "local_rename"
+	ActionLocalCreateDir = "local_create_dir"
+	// ActionSkip the diff needs no operation ApplyDiff can carry out, e.g. a Conflict or a Chmod
+	ActionSkip = "skip"
+)
+
+// DiffResult the outcome of one FileDiff of ApplyDiff
+type DiffResult struct {
+	Diff   FileDiff `json:"diff"`
+	Action string   `json:"action"`
+	// Bytes uploaded from the local tree, downloads are not sized as the plan doesn't carry the remote size
+	Bytes int64 `json:"bytes"`
+	// Applied the operation was carried out, always false on a dry run
+	Applied bool `json:"applied"`
+}
+
+// diffAction gets the action of a diff, a Rename is a move when the parent directory changes
+func diffAction(d FileDiff) (string, error) {
+	switch d.Op {
+	case Upload, Link, Pack:
+		return ActionUpload, nil
+	case Update:
+		return ActionUpdate, nil
+	case Download:
+		return ActionDownload, nil
+	case Delete:
+		return ActionDelete, nil
+	case Rename:
+		if path.Dir(d.OldPath) != path.Dir(d.Path) {
+			return ActionMove, nil
+		}
+		return ActionRename, nil
+	case CreateDir:
+		return ActionCreateDir, nil
+	case LocalDelete:
+		return ActionLocalDelete, nil
+	case LocalRename:
+		return ActionLocalRename, nil
+	case LocalCreateDir:
+		return ActionLocalCreateDir, nil
+	case Conflict, Chmod:
+		return ActionSkip, nil
+	}
+	return "", errors.Newf("invalid_operation", "unknown operation %v for %v", d.Op, d.Path)
+}
+
+// ApplyDiff - Applies the sync plan to the allocation in order, with the files of localRoot.
+// On a dry run it only reports the planned actions and their byte counts, nothing is sent to the blobbers
+// and the local tree is left untouched. Otherwise it stops at the first failing operation and returns
+// the results so far, the failing one included. Of the sync options, WithSoftDeadline applies: once it is passed,
+// no new operation is started and the results so far are returned with ErrSoftDeadline.
+func (a *Allocation) ApplyDiff(diffs []FileDiff, dryRun bool, localRoot string, opts ...SyncOption) ([]DiffResult, error) {
+	return applyDiffs(diffs, dryRun, localRoot, newSyncOptions(opts), func(d FileDiff, action string) error {
+		return a.applyDiff(d, action, localRoot)
+	})
+}
+
+func applyDiffs(diffs []FileDiff, dryRun bool, localRoot string, so *syncOptions, apply func(d FileDiff, action string) error) ([]DiffResult, error) {
+	diffs = expandPacks(diffs)
+	results := make([]DiffResult, 0, len(diffs))
+	for _, d := range diffs {
+		action, err := diffAction(d)
+		if err != nil {
+			return results, err
+		}
+		result := newDiffResult(d, action, localRoot)
+		if dryRun || action == ActionSkip {
+			results = append(results, result)
+			continue
+		}
+		if softDeadlinePassed(so.softDeadline) {
+			return results, ErrSoftDeadline
+		}
+
+		err = apply(d, action)
+		result.Applied = err == nil
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// expandPacks replaces every Pack by the Uploads of its members, so each file is applied and reported on its own
+func expandPacks(diffs []FileDiff) []FileDiff {
+	expanded := make([]FileDiff, 0, len(diffs))
+	for _, d := range diffs {
+		if d.Op != Pack {
+			expanded = append(expanded, d)
+			continue
+		}
+		for _, m := range d.Members {
+			expanded = append(expanded, FileDiff{Op: Upload, Path: m, Type: fileref.FILE})
+		}
+	}
+	return expanded
+}
+
+func newDiffResult(d FileDiff, action string, localRoot string) DiffResult {
+	result := DiffResult{Diff: d, Action: action, Bytes: diffTransferSize(d, localRoot)}
+	if d.Op == Link {
+		// the hardlink is uploaded as a copy of its local content
+		result.Bytes = diffTransferSize(FileDiff{Op: Upload, Path: d.Path}, localRoot)
+	}
+	return result
+}
+
+func (a *Allocation) applyDiff(d FileDiff, action string, localRoot string) error {
+	lPath := filepath.Join(localRoot, filepath.FromSlash(d.Path))
+	switch action {
+	case ActionUpload:
+		return a.applyUpload(lPath, d.Path, false)
+	case ActionUpdate:
+		return a.applyUpload(lPath, d.Path, true)
+	case ActionDownload:
+		cb := newApplyStatusCB()
+		if err := a.DownloadFile(lPath, d.Path, cb); err != nil {
+			return err
+		}
+		return cb.wait()
+	case ActionDelete:
+		return a.DeleteFile(d.Path)
+	case ActionMove:
+		dir := path.Dir(d.Path)
+		if err := a.MoveObject(d.OldPath, dir); err != nil {
+			return err
+		}
+		if path.Base(d.OldPath) == path.Base(d.Path) {
+			return nil
+		}
+		return a.RenameObject(path.Join(dir, path.Base(d.OldPath)), path.Base(d.Path))
+	case ActionRename:
+		return a.RenameObject(d.OldPath, path.Base(d.Path))
+	case ActionCreateDir:
+		return a.CreateDir(d.Path)
+	case ActionLocalDelete:
+		return sys.Files.Remove(lPath)
+	case ActionLocalRename:
+		if err := sys.Files.MkdirAll(filepath.Dir(lPath), 0744); err != nil {
+			return err
+		}
+		return os.Rename(filepath.Join(localRoot, filepath.FromSlash(d.OldPath)), lPath)
+	case ActionLocalCreateDir:
+		return sys.Files.MkdirAll(lPath, 0744)
+	}
+	return nil
+}
+
+// applyUpload uploads or updates a file, the upload progress is kept in the temp directory
+func (a *Allocation) applyUpload(localPath, remotePath string, isUpdate bool) error {
+	return a.StartChunkedUpload(os.TempDir(), localPath, remotePath, nil, isUpdate, false, "", false)
+}
+
+// applyStatusCB waits for a download of ApplyDiff, downloads run on the allocation worker
+type applyStatusCB struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+func newApplyStatusCB() *applyStatusCB {
+	cb := &applyStatusCB{}
+	cb.wg.Add(1)
+	return cb
+}
+
+func (cb *applyStatusCB) wait() error {
+	cb.wg.Wait()
+	return cb.err
+}
+
+func (cb *applyStatusCB) Started(allocationId, filePath string, op int, totalBytes int) {}
+
+func (cb *applyStatusCB) InProgress(allocationId, filePath string, op int, completedBytes int, data []byte) {
+}
+
+func (cb *applyStatusCB) RepairCompleted(filesRepaired int) {}
+
+func (cb *applyStatusCB) Completed(allocationId, filePath string, filename string, mimetype string, size int, op int) {
+	cb.once.Do(cb.wg.Done)
+}
+
+func (cb *applyStatusCB) Error(allocationID string, filePath string, op int, err error) {
+	cb.once.Do(func() {
+		cb.err = err
+		cb.wg.Done()
+	})
+}
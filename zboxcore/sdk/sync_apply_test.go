@@ -0,0 +1,151 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDiffDryRun(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"new.txt":     "12345",
+		"changed.txt": "123",
+		"gone.txt":    "local",
+	})
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/new.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/changed.txt", Type: fileref.FILE},
+		{Op: Download, Path: "/remote.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/old.txt", Type: fileref.FILE},
+		{Op: Rename, Path: "/b/x.txt", OldPath: "/a/x.txt", Type: fileref.FILE},
+		{Op: Rename, Path: "/a/y.txt", OldPath: "/a/x.txt", Type: fileref.FILE},
+		{Op: LocalDelete, Path: "/gone.txt", Type: fileref.FILE},
+		{Op: LocalCreateDir, Path: "/dir", Type: fileref.DIRECTORY},
+		{Op: Conflict, Path: "/both.txt", Type: fileref.FILE},
+	}
+
+	// the allocation is not initialized, a dry run doesn't reach the blobbers
+	a := &Allocation{}
+	results, err := a.ApplyDiff(diffs, true, root)
+	require.NoError(t, err)
+	require.Len(t, results, len(diffs))
+
+	actions := make([]string, 0, len(results))
+	for i, r := range results {
+		require.Equal(t, diffs[i], r.Diff)
+		require.False(t, r.Applied)
+		actions = append(actions, r.Action)
+	}
+	require.Equal(t, []string{ActionUpload, ActionUpdate, ActionDownload, ActionDelete, ActionMove,
+		ActionRename, ActionLocalDelete, ActionLocalCreateDir, ActionSkip}, actions)
+	require.EqualValues(t, 5, results[0].Bytes)
+	require.EqualValues(t, 3, results[1].Bytes)
+	require.Zero(t, results[2].Bytes)
+
+	require.FileExists(t, filepath.Join(root, "gone.txt"))
+	require.NoDirExists(t, filepath.Join(root, "dir"))
+}
+
+func TestApplyDiffPack(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"docs/a.txt": "a", "docs/b.txt": "bb", "c.txt": "ccc"})
+	diffs := []FileDiff{
+		{Op: Pack, Path: "/docs", Type: fileref.DIRECTORY, Members: []string{"/docs/a.txt", "/docs/b.txt"}, Size: 3},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+	}
+
+	// every member is its own upload
+	results, err := (&Allocation{}).ApplyDiff(diffs, true, root)
+	require.NoError(t, err)
+	uploads := []FileDiff{
+		{Op: Upload, Path: "/docs/a.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/docs/b.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+	}
+	require.Len(t, results, len(uploads))
+	for i, r := range results {
+		require.Equal(t, uploads[i], r.Diff)
+		require.Equal(t, ActionUpload, r.Action)
+		require.EqualValues(t, i+1, r.Bytes)
+	}
+
+	var applied []string
+	err = syncToRemote(diffs, SyncToRemoteOptions{LocalRoot: root}, func(d FileDiff, action string) error {
+		applied = append(applied, d.Op+" "+d.Path)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Upload /docs/a.txt", "Upload /docs/b.txt", "Upload /c.txt"}, applied)
+}
+
+func TestApplyDiff(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"old/x.txt": "x", "gone.txt": "local"})
+
+	a := &Allocation{}
+	results, err := a.ApplyDiff([]FileDiff{
+		{Op: LocalDelete, Path: "/gone.txt", Type: fileref.FILE},
+		{Op: LocalRename, Path: "/new/y.txt", OldPath: "/old/x.txt", Type: fileref.FILE},
+		{Op: LocalCreateDir, Path: "/dir/sub", Type: fileref.DIRECTORY},
+		{Op: Delete, Path: "/remote.txt", Type: fileref.FILE},
+		{Op: LocalCreateDir, Path: "/never", Type: fileref.DIRECTORY},
+	}, false, root)
+	require.Equal(t, notInitialized, err)
+	require.Len(t, results, 4)
+	for _, r := range results[:3] {
+		require.True(t, r.Applied)
+	}
+	require.False(t, results[3].Applied)
+
+	require.NoFileExists(t, filepath.Join(root, "gone.txt"))
+	require.NoFileExists(t, filepath.Join(root, "old", "x.txt"))
+	require.FileExists(t, filepath.Join(root, "new", "y.txt"))
+	require.DirExists(t, filepath.Join(root, "dir", "sub"))
+	require.NoDirExists(t, filepath.Join(root, "never"))
+
+	_, err = a.ApplyDiff([]FileDiff{{Op: "Unknown", Path: "/a"}}, true, root)
+	require.Error(t, err)
+}
+
+func TestApplyDiffSoftDeadline(t *testing.T) {
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Conflict, Path: "/both.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/b.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+	}
+	var applied []string
+	apply := func(d FileDiff, action string) error {
+		time.Sleep(50 * time.Millisecond)
+		applied = append(applied, d.Path)
+		return nil
+	}
+
+	// the deadline passes while /b.txt is uploaded, which completes
+	so := newSyncOptions([]SyncOption{WithSoftDeadline(time.Now().Add(75 * time.Millisecond))})
+	results, err := applyDiffs(diffs, false, t.TempDir(), so, apply)
+	require.Equal(t, ErrSoftDeadline, err)
+	require.Equal(t, []string{"/a.txt", "/b.txt"}, applied)
+	require.Len(t, results, 3)
+	require.True(t, results[0].Applied)
+	require.Equal(t, ActionSkip, results[1].Action)
+	require.True(t, results[2].Applied)
+
+	// a passed deadline starts nothing, a dry run has nothing to stop
+	_, err = (&Allocation{}).ApplyDiff(diffs, false, t.TempDir(), WithSoftDeadline(time.Now().Add(-time.Second)))
+	require.Equal(t, ErrSoftDeadline, err)
+	results, err = (&Allocation{}).ApplyDiff(diffs, true, t.TempDir(), WithSoftDeadline(time.Now().Add(-time.Second)))
+	require.NoError(t, err)
+	require.Len(t, results, len(diffs))
+}
+
+func TestApplyStatusCB(t *testing.T) {
+	cb := newApplyStatusCB()
+	go cb.Error("", "/a", 0, os.ErrNotExist)
+	require.Equal(t, os.ErrNotExist, cb.wait())
+}
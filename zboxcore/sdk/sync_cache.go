@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteListCache keeps ListDir results in memory for a TTL, so diffing the same allocation again
+// in a session doesn't list the whole remote tree every time. Paths changed by the caller must be invalidated.
+type RemoteListCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]remoteListEntry
+	now     func() time.Time
+}
+
+type remoteListEntry struct {
+	result  *ListResult
+	expires time.Time
+}
+
+// NewRemoteListCache create a cache keeping listings for ttl
+func NewRemoteListCache(ttl time.Duration) *RemoteListCache {
+	return &RemoteListCache{
+		ttl:     ttl,
+		entries: make(map[string]remoteListEntry),
+		now:     time.Now,
+	}
+}
+
+// Invalidate drops the listings affected by a change of remotePath: its parent directory, itself and everything under it
+func (c *RemoteListCache) Invalidate(remotePath string) {
+	remotePath = path.Clean("/" + remotePath)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, path.Dir(remotePath))
+	for p := range c.entries {
+		if p == remotePath || strings.HasPrefix(p, strings.TrimRight(remotePath, "/")+"/") {
+			delete(c.entries, p)
+		}
+	}
+}
+
+// Refresh drops every listing so the next diff lists the whole remote tree again
+func (c *RemoteListCache) Refresh() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]remoteListEntry)
+}
+
+func (c *RemoteListCache) get(dir string) (*ListResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[dir]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, dir)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+func (c *RemoteListCache) put(dir string, result *ListResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[dir] = remoteListEntry{result: result, expires: c.now().Add(c.ttl)}
+}
+
+// cachedLister lists through the cache, a miss is listed by lister and cached
+type cachedLister struct {
+	lister remoteLister
+	cache  *RemoteListCache
+}
+
+func (cl *cachedLister) ListDir(dir string) (*ListResult, error) {
+	if result, ok := cl.cache.get(dir); ok {
+		return result, nil
+	}
+	result, err := cl.lister.ListDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	cl.cache.put(dir, result)
+	return result, nil
+}
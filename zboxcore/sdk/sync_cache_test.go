@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteListCache(t *testing.T) {
+	remote := newFakeRemoteLister(map[string]string{
+		"/a.txt":        "a",
+		"/docs/b.txt":   "b",
+		"/docs/s/c.txt": "c",
+		"/img/d.png":    "d",
+	})
+	now := time.Now()
+	cache := NewRemoteListCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	lister := &cachedLister{lister: remote, cache: cache}
+
+	first, err := getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+	listed := remote.totalCalls()
+	require.Equal(t, 4, listed)
+
+	// within the TTL nothing is listed again
+	second, err := getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Equal(t, listed, remote.totalCalls())
+
+	// a change under /docs relists its parent and its subtree only
+	cache.Invalidate("/docs/s")
+	_, err = getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+	require.Equal(t, listed+2, remote.totalCalls())
+	require.Equal(t, 2, remote.calls["/docs"])
+	require.Equal(t, 2, remote.calls["/docs/s"])
+	require.Equal(t, 1, remote.calls["/"])
+
+	cache.Refresh()
+	_, err = getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+	require.Equal(t, listed+6, remote.totalCalls())
+
+	now = now.Add(time.Minute)
+	_, err = getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+	require.Equal(t, listed+10, remote.totalCalls())
+}
@@ -0,0 +1,43 @@
+package sdk
+
+import (
+	"sort"
+	"strings"
+)
+
+// foldLocalCase rekeys the local paths matching remote ones but for their case with the remote spelling, directory by
+// directory so the new files of a directory spelled differently go to the remote one. When remote paths differ only by
+// their case, the first one in path order is matched.
+func foldLocalCase(rMap, lMap map[string]fileInfo) map[string]fileInfo {
+	remotePaths := make([]string, 0, len(rMap))
+	for p := range rMap {
+		remotePaths = append(remotePaths, p)
+	}
+	sort.Strings(remotePaths)
+	byLower := make(map[string]string, len(remotePaths))
+	for _, p := range remotePaths {
+		if _, ok := byLower[strings.ToLower(p)]; !ok {
+			byLower[strings.ToLower(p)] = p
+		}
+	}
+
+	folded := make(map[string]fileInfo, len(lMap))
+	for p, info := range lMap {
+		folded[foldPathCase(p, byLower)] = info
+	}
+	return folded
+}
+
+func foldPathCase(p string, byLower map[string]string) string {
+	if p == "/." {
+		return p
+	}
+	var folded string
+	for _, seg := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		folded += "/" + seg
+		if remote, ok := byLower[strings.ToLower(folded)]; ok {
+			folded = remote
+		}
+	}
+	return folded
+}
@@ -0,0 +1,47 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldLocalCase(t *testing.T) {
+	rMap := map[string]fileInfo{
+		"/Readme.md":      {Type: fileref.FILE, Hash: "readme"},
+		"/Docs":           {Type: fileref.DIRECTORY},
+		"/Docs/Guide.txt": {Type: fileref.FILE, Hash: "guide"},
+	}
+	lMap := map[string]fileInfo{
+		"/.":              {Type: fileref.DIRECTORY},
+		"/readme.md":      {Type: fileref.FILE, Hash: "readme"},
+		"/docs":           {Type: fileref.DIRECTORY},
+		"/docs/guide.txt": {Type: fileref.FILE, Hash: "guide"},
+		"/docs/new.txt":   {Type: fileref.FILE, Hash: "new"},
+	}
+
+	// the case only differences are a delete and an upload of each file
+	require.NotEmpty(t, findDelta(rMap, copyFileMap(lMap), map[string]fileInfo{}, ""))
+
+	folded := foldLocalCase(rMap, lMap)
+	require.Equal(t, map[string]fileInfo{
+		"/.":              {Type: fileref.DIRECTORY},
+		"/Readme.md":      {Type: fileref.FILE, Hash: "readme"},
+		"/Docs":           {Type: fileref.DIRECTORY},
+		"/Docs/Guide.txt": {Type: fileref.FILE, Hash: "guide"},
+		"/Docs/new.txt":   {Type: fileref.FILE, Hash: "new"},
+	}, folded)
+	// a case insensitive filesystem opens /docs/new.txt at /Docs/new.txt
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"Docs/new.txt": "new"})
+	require.Equal(t, []FileDiff{{Op: Upload, Path: "/Docs/new.txt", Type: fileref.FILE}}, findDelta(rMap, folded, map[string]fileInfo{}, root))
+}
+
+func copyFileMap(fMap map[string]fileInfo) map[string]fileInfo {
+	cp := make(map[string]fileInfo, len(fMap))
+	for p, info := range fMap {
+		cp[p] = info
+	}
+	return cp
+}
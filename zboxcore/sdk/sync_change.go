@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"path"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// findRefByPath looks up the ref of remotePath in the tree under rootRef
+func findRefByPath(rootRef *fileref.Ref, remotePath string) (fileref.RefEntity, error) {
+	fields, err := common.GetPathFields(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	var ref fileref.RefEntity = rootRef
+	for _, name := range fields {
+		dirRef, ok := ref.(*fileref.Ref)
+		if !ok || dirRef.Type != fileref.DIRECTORY {
+			return nil, errors.New("invalid_reference_path", "Invalid reference path "+remotePath)
+		}
+		found := false
+		for _, child := range dirRef.Children {
+			if child.GetName() == name {
+				ref = child
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("file_not_found", "Object not found "+remotePath)
+		}
+	}
+	return ref, nil
+}
+
+// DiffToChanges maps the remote tree operations of a sync plan to allocation changes on rootRef, ready for a commit.
+// Only operations mutating the remote tree structure produce changes, Delete, Rename and CreateDir, transfers (Upload, Update, Download...)
+// and local operations are left to the caller. A Rename to another directory is a move followed by a rename if the name changes.
+func DiffToChanges(diffs []FileDiff, rootRef *fileref.Ref) ([]allocationchange.AllocationChange, error) {
+	var changes []allocationchange.AllocationChange
+	for _, d := range diffs {
+		switch d.Op {
+		case Delete:
+			objectTree, err := findRefByPath(rootRef, d.Path)
+			if err != nil {
+				return nil, err
+			}
+			newChange := &allocationchange.DeleteFileChange{ObjectTree: objectTree}
+			newChange.NumBlocks = objectTree.GetNumBlocks()
+			newChange.Operation = constants.FileOperationDelete
+			newChange.Size = objectTree.GetSize()
+			changes = append(changes, newChange)
+		case CreateDir:
+			changes = append(changes, &allocationchange.DirCreateChange{RemotePath: d.Path})
+		case Rename:
+			objectTree, err := findRefByPath(rootRef, d.OldPath)
+			if err != nil {
+				return nil, err
+			}
+			// a move updates the path of objectTree, so the rename after it finds the file at its new place
+			if path.Dir(d.OldPath) != path.Dir(d.Path) {
+				moveChange := &allocationchange.MoveFileChange{ObjectTree: objectTree, DestPath: path.Dir(d.Path)}
+				moveChange.Operation = constants.FileOperationMove
+				changes = append(changes, moveChange)
+			}
+			if path.Base(d.OldPath) != path.Base(d.Path) {
+				renameChange := &allocationchange.RenameFileChange{ObjectTree: objectTree, NewName: path.Base(d.Path)}
+				renameChange.Operation = constants.FileOperationRename
+				changes = append(changes, renameChange)
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/0chain/gosdk/constants"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func newSyncTestRootRef() *fileref.Ref {
+	rootRef := &fileref.Ref{Type: fileref.DIRECTORY, Path: "/", Name: "/"}
+	docs := &fileref.Ref{Type: fileref.DIRECTORY, Path: "/docs", Name: "docs"}
+	docs.AddChild(&fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE, Path: "/docs/a.txt", Name: "a.txt", Size: 10}})
+	rootRef.AddChild(docs)
+	rootRef.AddChild(&fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE, Path: "/b.txt", Name: "b.txt", Size: 20}})
+	return rootRef
+}
+
+func TestDiffToChanges(t *testing.T) {
+	rootRef := newSyncTestRootRef()
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/new.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/docs/a.txt", Type: fileref.FILE},
+		{Op: Download, Path: "/b.txt", Type: fileref.FILE},
+		{Op: LocalDelete, Path: "/old.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/docs", Type: fileref.DIRECTORY},
+	}
+
+	changes, err := DiffToChanges(diffs, rootRef)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	fileDelete, ok := changes[0].(*allocationchange.DeleteFileChange)
+	require.True(t, ok)
+	require.Equal(t, "/docs/a.txt", fileDelete.ObjectTree.GetPath())
+	require.Equal(t, constants.FileOperationDelete, fileDelete.Operation)
+	require.Equal(t, int64(-10), fileDelete.GetSize())
+
+	dirDelete, ok := changes[1].(*allocationchange.DeleteFileChange)
+	require.True(t, ok)
+	require.Equal(t, "/docs", dirDelete.ObjectTree.GetPath())
+
+	for _, ch := range changes {
+		require.NoError(t, ch.ProcessChange(rootRef))
+	}
+	require.Len(t, rootRef.Children, 1)
+}
+
+func TestDiffToChangesMissingRef(t *testing.T) {
+	_, err := DiffToChanges([]FileDiff{{Op: Delete, Path: "/missing.txt"}}, newSyncTestRootRef())
+	require.Error(t, err)
+}
+
+func TestDiffToChangesRenameAndCreateDir(t *testing.T) {
+	rootRef := newSyncTestRootRef()
+	diffs := []FileDiff{
+		{Op: Rename, Path: "/docs/renamed.txt", Type: fileref.FILE, OldPath: "/docs/a.txt"},
+		{Op: Rename, Path: "/docs/c.txt", Type: fileref.FILE, OldPath: "/b.txt"},
+		{Op: CreateDir, Path: "/empty/sub", Type: fileref.DIRECTORY},
+	}
+
+	changes, err := DiffToChanges(diffs, rootRef)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	_, ok := changes[0].(*allocationchange.RenameFileChange)
+	require.True(t, ok)
+	move, ok := changes[1].(*allocationchange.MoveFileChange)
+	require.True(t, ok)
+	require.Equal(t, "/docs", move.DestPath)
+	_, ok = changes[2].(*allocationchange.RenameFileChange)
+	require.True(t, ok)
+
+	for _, ch := range changes {
+		require.NoError(t, ch.ProcessChange(rootRef))
+	}
+	for _, p := range []string{"/docs/renamed.txt", "/docs/c.txt", "/empty/sub"} {
+		_, err := findRefByPath(rootRef, p)
+		require.NoError(t, err, p)
+	}
+	for _, p := range []string{"/docs/a.txt", "/b.txt"} {
+		_, err := findRefByPath(rootRef, p)
+		require.Error(t, err, p)
+	}
+}
@@ -0,0 +1,164 @@
+package sdk
+
+import (
+	"path"
+	"sort"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// expectedDiffOp returns the operation findDelta plans for a file given its remote, local and previous sync state,
+// or "" when the file is in sync.
+func expectedDiffOp(filePath string, rMap, lMap, prevMap map[string]fileInfo) string {
+	rInfo, inRemote := rMap[filePath]
+	lInfo, inLocal := lMap[filePath]
+	pInfo, inPrev := prevMap[filePath]
+	switch {
+	case inRemote && inLocal:
+		if rInfo.Hash == lInfo.Hash {
+			return ""
+		}
+		if inPrev && pInfo.Hash != rInfo.Hash {
+			return Conflict
+		}
+		return Update
+	case inRemote:
+		if inPrev {
+			return Delete
+		}
+		return Download
+	default:
+		if inPrev {
+			return LocalDelete
+		}
+		if lInfo.LinkTo != "" {
+			return Link
+		}
+		return Upload
+	}
+}
+
+// deletedByParent returns the delete operation planned for a parent directory of filePath, if any
+func deletedByParent(filePath string, dirDeletes map[string]string) (string, bool) {
+	for p := path.Dir(filePath); p != "/" && p != "."; p = path.Dir(p) {
+		if op, ok := dirDeletes[p]; ok {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// checkDiffConsistency verifies the plan found for the remote, local and previous sync maps:
+// every file is accounted for exactly once, by its own operation or by the deletion of a parent directory,
+// and applying the plan makes both sides hold the same files, except the ones in Conflict.
+// The maps are the ones given to findDelta, before it consumes lMap.
+func checkDiffConsistency(rMap, lMap, prevMap map[string]fileInfo, diffs []FileDiff) error {
+	planned := make(map[string]string)
+	dirDeletes := make(map[string]string)
+	for _, d := range diffs {
+		if _, ok := planned[d.Path]; ok {
+			return errors.Newf("inconsistent_diff", "%v is planned twice", d.Path)
+		}
+		_, inRemote := rMap[d.Path]
+		_, inLocal := lMap[d.Path]
+		if !inRemote && !inLocal {
+			return errors.Newf("inconsistent_diff", "%v %v is neither remote nor local", d.Op, d.Path)
+		}
+		planned[d.Path] = d.Op
+		if d.Type == fileref.DIRECTORY && (d.Op == Delete || d.Op == LocalDelete) {
+			dirDeletes[d.Path] = d.Op
+		}
+	}
+
+	files := make(map[string]bool)
+	for p, info := range rMap {
+		if info.Type == fileref.FILE {
+			files[p] = true
+		}
+	}
+	for p, info := range lMap {
+		if info.Type == fileref.FILE {
+			files[p] = true
+		}
+	}
+	filePaths := make([]string, 0, len(files))
+	for p := range files {
+		filePaths = append(filePaths, p)
+	}
+	sort.Strings(filePaths)
+
+	for _, p := range filePaths {
+		expected := expectedDiffOp(p, rMap, lMap, prevMap)
+		op, hasOp := planned[p]
+		parentOp, deleted := deletedByParent(p, dirDeletes)
+		switch {
+		case hasOp && deleted:
+			return errors.Newf("inconsistent_diff", "%v is planned as %v and deleted with its parent by %v", p, op, parentOp)
+		case deleted:
+			op, hasOp = parentOp, true
+		}
+		if expected == "" && hasOp {
+			return errors.Newf("inconsistent_diff", "%v is in sync but planned as %v", p, op)
+		}
+		if expected != "" && !hasOp {
+			return errors.Newf("inconsistent_diff", "%v is not planned, expected %v", p, expected)
+		}
+		if op != expected {
+			return errors.Newf("inconsistent_diff", "%v is planned as %v, expected %v", p, op, expected)
+		}
+	}
+
+	return checkDiffConvergence(rMap, lMap, diffs, filePaths)
+}
+
+// checkDiffConvergence applies the plan to copies of the remote and local files and compares the outcome
+func checkDiffConvergence(rMap, lMap map[string]fileInfo, diffs []FileDiff, filePaths []string) error {
+	remote := make(map[string]string)
+	local := make(map[string]string)
+	for p, info := range rMap {
+		if info.Type == fileref.FILE {
+			remote[p] = info.Hash
+		}
+	}
+	for p, info := range lMap {
+		if info.Type == fileref.FILE {
+			local[p] = info.Hash
+		}
+	}
+	deleteTree := func(files map[string]string, root string) {
+		for p := range files {
+			if p == root || isParentFolderExists([]FileDiff{{Path: root}}, p) {
+				delete(files, p)
+			}
+		}
+	}
+
+	conflicts := make(map[string]bool)
+	for _, d := range diffs {
+		switch d.Op {
+		case Upload, Update, Link:
+			remote[d.Path] = local[d.Path]
+		case Download:
+			local[d.Path] = remote[d.Path]
+		case Delete:
+			deleteTree(remote, d.Path)
+		case LocalDelete:
+			deleteTree(local, d.Path)
+		case Conflict:
+			conflicts[d.Path] = true
+		}
+	}
+
+	for _, p := range filePaths {
+		if conflicts[p] {
+			continue
+		}
+		rHash, inRemote := remote[p]
+		lHash, inLocal := local[p]
+		if inRemote != inLocal || rHash != lHash {
+			return errors.Newf("inconsistent_diff", "%v doesn't converge after applying the plan", p)
+		}
+	}
+	return nil
+}
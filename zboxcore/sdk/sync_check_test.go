@@ -0,0 +1,84 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"path"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+var syncCheckPaths = []string{"/a.txt", "/b.txt", "/d/c.txt", "/d/e.txt", "/d/s/f.txt", "/g/h.txt"}
+
+// randomSyncState returns, for each path, either no file or one of two contents
+func randomSyncState(rnd *rand.Rand) map[string]string {
+	state := make(map[string]string)
+	for _, p := range syncCheckPaths {
+		switch rnd.Intn(3) {
+		case 1:
+			state[p] = "one"
+		case 2:
+			state[p] = "two"
+		}
+	}
+	return state
+}
+
+func syncStateToRemoteMap(state map[string]string) map[string]fileInfo {
+	fMap := make(map[string]fileInfo)
+	for p, content := range state {
+		sum := sha256.Sum256([]byte(content))
+		fMap[p] = fileInfo{Type: fileref.FILE, Hash: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+		for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+			fMap[dir] = fileInfo{Type: fileref.DIRECTORY}
+		}
+	}
+	return fMap
+}
+
+func TestFindDeltaConsistencyProperty(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		remote, local, prev := randomSyncState(rnd), randomSyncState(rnd), randomSyncState(rnd)
+
+		root := t.TempDir()
+		writeSyncTestFiles(t, root, local)
+		lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+		require.NoError(t, err)
+		rMap := syncStateToRemoteMap(remote)
+		prevMap := syncStateToRemoteMap(prev)
+
+		lCopy := make(map[string]fileInfo, len(lMap))
+		for p, info := range lMap {
+			lCopy[p] = info
+		}
+		diffs := findDelta(rMap, lCopy, prevMap, root)
+		require.NoError(t, checkDiffConsistency(rMap, lMap, prevMap, diffs),
+			"remote %v\nlocal %v\nprev %v\ndiffs %v", remote, local, prev, diffs)
+	}
+}
+
+func TestCheckDiffConsistencyRejectsBrokenPlans(t *testing.T) {
+	rMap := syncStateToRemoteMap(map[string]string{"/a.txt": "one", "/d/b.txt": "one"})
+	lMap := syncStateToRemoteMap(map[string]string{"/a.txt": "two", "/c.txt": "one"})
+	prevMap := syncStateToRemoteMap(map[string]string{"/d/b.txt": "one"})
+	valid := []FileDiff{
+		{Op: Update, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/d", Type: fileref.DIRECTORY},
+	}
+	require.NoError(t, checkDiffConsistency(rMap, lMap, prevMap, valid))
+
+	for name, diffs := range map[string][]FileDiff{
+		"missing":   valid[1:],
+		"twice":     append([]FileDiff{valid[0]}, valid...),
+		"wrong op":  {{Op: Download, Path: "/a.txt", Type: fileref.FILE}, valid[1], valid[2]},
+		"unknown":   append([]FileDiff{{Op: Upload, Path: "/x.txt", Type: fileref.FILE}}, valid...),
+		"in parent": append([]FileDiff{{Op: Delete, Path: "/d/b.txt", Type: fileref.FILE}}, valid...),
+	} {
+		require.Error(t, checkDiffConsistency(rMap, lMap, prevMap, diffs), name)
+	}
+}
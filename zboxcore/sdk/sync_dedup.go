@@ -0,0 +1,41 @@
+package sdk
+
+import (
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// warnDuplicate reports a path listed twice, the first entry is kept
+func (so *syncOptions) warnDuplicate(p string, remote bool) {
+	l.Logger.Info("Duplicate path in the file list, keeping the first entry", p, "remote", remote)
+	if so.onDuplicate != nil {
+		so.onDuplicate(p, remote)
+	}
+}
+
+// dedupLister normalizes the paths of the remote children and drops the ones listed twice.
+// The listing is updated in place, which is harmless for a cached one as it's idempotent.
+type dedupLister struct {
+	lister remoteLister
+	so     *syncOptions
+}
+
+func (dl *dedupLister) ListDir(dir string) (*ListResult, error) {
+	result, err := dl.lister.ListDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(result.Children))
+	children := make([]*ListResult, 0, len(result.Children))
+	for _, child := range result.Children {
+		childPath := normalizePath(child.Path)
+		if seen[childPath] {
+			dl.so.warnDuplicate(childPath, true)
+			continue
+		}
+		seen[childPath] = true
+		child.Path = childPath
+		children = append(children, child)
+	}
+	result.Children = children
+	return result, nil
+}
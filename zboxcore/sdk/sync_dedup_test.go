@@ -0,0 +1,58 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+type duplicateWarning struct {
+	path   string
+	remote bool
+}
+
+func TestLocalPathDedup(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"real/a.txt": "a"})
+	if err := os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "alias")); err != nil {
+		t.Skip("symlinks not supported", err)
+	}
+
+	var warnings []duplicateWarning
+	so := newSyncOptions([]SyncOption{WithPathDedup(func(path string, remote bool) {
+		warnings = append(warnings, duplicateWarning{path, remote})
+	})})
+	fMap := make(map[string]fileInfo)
+	var dirList []string
+	walkFn := addLocalFileList(context.Background(), root, fMap, &dirList, map[string]bool{"alias": true}, nil, so)
+
+	// a walk following the symlink reaches the files of its target again
+	require.NoError(t, filepath.Walk(root, walkFn))
+	target, err := filepath.EvalSymlinks(filepath.Join(root, "alias"))
+	require.NoError(t, err)
+	require.NoError(t, filepath.Walk(target, walkFn))
+
+	require.Equal(t, []duplicateWarning{{"/real", false}, {"/real/a.txt", false}}, warnings)
+	require.Equal(t, mustFileHash(t, filepath.Join(root, "real", "a.txt")), fMap["/real/a.txt"].Hash)
+	require.NotContains(t, fMap, "/alias")
+}
+
+func TestRemotePathDedup(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "first", "/dir/b.txt": "b"})
+	lister.dirs["/"] = append(lister.dirs["/"], &ListResult{Name: "a.txt", Path: "/a.txt/", Type: fileref.FILE, Hash: "second"})
+	lister.dirs["/dir"] = append(lister.dirs["/dir"], &ListResult{Name: "b.txt", Path: "/dir//b.txt", Type: fileref.FILE, Hash: "b"})
+
+	var warnings []duplicateWarning
+	so := newSyncOptions([]SyncOption{WithPathDedup(func(path string, remote bool) {
+		warnings = append(warnings, duplicateWarning{path, remote})
+	})})
+	rMap, err := getRemoteFileMap(&dedupLister{lister: lister, so: so}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []duplicateWarning{{"/a.txt", true}, {"/dir/b.txt", true}}, warnings)
+	require.Equal(t, "first", rMap["/a.txt"].Hash)
+	require.Len(t, rMap, 3)
+}
@@ -0,0 +1,34 @@
+package sdk
+
+import (
+	"path/filepath"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// RemoteHashEncryptor - Derives the hash a local file gets once encrypted with encryptedKey and uploaded,
+// so it can be compared with the ciphertext hash the blobbers keep for encrypted files.
+type RemoteHashEncryptor interface {
+	EncryptedHash(localPath string, encryptedKey string) (string, error)
+}
+
+// applyEncryptedHashes replaces the hash of the local files stored encrypted on the remote side with the one enc derives
+func applyEncryptedHashes(rMap, lMap map[string]fileInfo, localRootPath string, enc RemoteHashEncryptor) error {
+	for rPath, rInfo := range rMap {
+		if rInfo.EncryptedKey == "" || rInfo.Type != fileref.FILE {
+			continue
+		}
+		lInfo, ok := lMap[rPath]
+		if !ok || lInfo.Type != fileref.FILE {
+			continue
+		}
+		hash, err := enc.EncryptedHash(localLongPath(filepath.Join(localRootPath, filepath.FromSlash(rPath))), rInfo.EncryptedKey)
+		if err != nil {
+			return errors.Wrap(err, "can't derive the encrypted hash of "+rPath)
+		}
+		lInfo.Hash = hash
+		lMap[rPath] = lInfo
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+// xorEncryptor hashes the content xored with the key
+type xorEncryptor struct{}
+
+func (xorEncryptor) EncryptedHash(localPath string, encryptedKey string) (string, error) {
+	content, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return "", err
+	}
+	return xorHash(content, encryptedKey), nil
+}
+
+func xorHash(content []byte, key string) string {
+	cipher := make([]byte, len(content))
+	for i := range content {
+		cipher[i] = content[i] ^ key[i%len(key)]
+	}
+	sum := sha256.Sum256(cipher)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestEncryptedRemoteHashes(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"secret.txt":  "plain secret",
+		"changed.txt": "edited locally",
+		"plain.txt":   "not encrypted",
+	})
+	rMap := map[string]fileInfo{
+		"/secret.txt":  {Type: fileref.FILE, Hash: xorHash([]byte("plain secret"), "k3y"), EncryptedKey: "k3y"},
+		"/changed.txt": {Type: fileref.FILE, Hash: xorHash([]byte("remote version"), "k3y"), EncryptedKey: "k3y"},
+		"/plain.txt":   {Type: fileref.FILE, Hash: mustFileHash(t, filepath.Join(root, "plain.txt"))},
+	}
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+
+	require.NoError(t, applyEncryptedHashes(rMap, lMap, root, xorEncryptor{}))
+	require.Equal(t, rMap["/secret.txt"].Hash, lMap["/secret.txt"].Hash)
+	require.NotEqual(t, rMap["/changed.txt"].Hash, lMap["/changed.txt"].Hash)
+	require.Equal(t, rMap["/plain.txt"].Hash, lMap["/plain.txt"].Hash)
+
+	diffs := findDelta(rMap, lMap, make(map[string]fileInfo), root)
+	require.Equal(t, map[string]string{"/changed.txt": Update}, diffOps(diffs))
+}
@@ -0,0 +1,162 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// LocalFilter decides which local files are part of a sync, it is the filter the local walk of GetAllocationDiff applies
+type LocalFilter struct {
+	root    string
+	matcher *Matcher
+}
+
+// NewLocalFilter create the filter GetAllocationDiff applies with the same arguments, the sync options included,
+// e.g. WithHiddenFiles and WithLocalFilter. The sync state saved to lastSyncCachePath under the local root is left out.
+func NewLocalFilter(lastSyncCachePath string, localRootPath string, localFileFilters []string, remoteExcludePath []string, opts ...SyncOption) *LocalFilter {
+	filter := make(map[string]bool)
+	for _, f := range localFileFilters {
+		filter[f] = true
+	}
+	root := strings.TrimRight(localRootPath, "/")
+	so := newSyncOptions(opts)
+	so.skipLocalPaths = cacheFilePaths(lastSyncCachePath, root)
+	return newLocalFilter(root, filter, getRemoteExcludeMap(remoteExcludePath), so)
+}
+
+// newLocalFilter builds every rule of the local walk: the name filters apply before the path excludes, the exact ones
+// before the patterns, then the sync state files, the hidden files and the local filter of the sync options
+func newLocalFilter(root string, filter map[string]bool, exclMap map[string]int, so *syncOptions) *LocalFilter {
+	names := make(map[string]bool, len(filter))
+	var namePatterns []string
+	for name := range filter {
+		if isFilterPattern(name) {
+			namePatterns = append(namePatterns, name)
+		} else {
+			names[name] = true
+		}
+	}
+	sort.Strings(namePatterns)
+	exact, patterns := splitExcludeMap(exclMap)
+	rules := []MatchRule{
+		skipNameMap(names), SkipPatterns(namePatterns...),
+		skipPathMap(exact), SkipPatterns(patterns...),
+	}
+	if len(so.skipLocalPaths) > 0 {
+		rules = append(rules, SkipIf("sync state file", func(path string, info os.FileInfo) bool {
+			return so.skipLocalPaths[path]
+		}))
+	}
+	if so.skipHidden {
+		rules = append(rules, skipHidden)
+	}
+	if so.localFilter != nil {
+		rules = append(rules, skipUnless("excluded by the local filter", so.localFilter))
+	}
+	return &LocalFilter{root: root, matcher: NewMatcher(rules...)}
+}
+
+// WouldInclude tells if the local file at path would be part of the sync and explains why
+func (lf *LocalFilter) WouldInclude(path string, info os.FileInfo) (included bool, reason string) {
+	rel, err := filepath.Rel(lf.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, "outside of the local root " + lf.root
+	}
+	if len(path) > maxLocalPathLength {
+		return false, ErrLocalPathTooLong.Error()
+	}
+	// the walk doesn't reach the content of a directory skipped with its subtree
+	var dirs []string
+	for dir := filepath.Dir(path); len(dir) > len(lf.root); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirInfo, err := os.Lstat(dirs[i])
+		if err != nil {
+			continue
+		}
+		if _, dirIncluded, prune, dirReason := lf.match(dirs[i], dirInfo); !dirIncluded && prune {
+			return false, dirReason
+		}
+	}
+	_, included, _, reason = lf.match(path, info)
+	return included, reason
+}
+
+// match returns the remote path of the local file, if it is included and else if its subtree is skipped as well
+func (lf *LocalFilter) match(path string, info os.FileInfo) (string, bool, bool, string) {
+	lPath, err := filepath.Rel(lf.root, path)
+	if err != nil {
+		l.Logger.Error("getting relative path failed", err)
+	}
+	// remote paths use / whatever the local separator
+	lPath = "/" + filepath.ToSlash(lPath)
+	skip, prune, reason := lf.matcher.match(lPath, info)
+	return lPath, !skip, prune, reason
+}
+
+// filterLister drops the remote children matcher skips, so the walk doesn't list the directories it skips.
+// Like dedupLister it updates the listing in place.
+type filterLister struct {
+	lister  remoteLister
+	matcher *Matcher
+}
+
+func (fl *filterLister) ListDir(dir string) (*ListResult, error) {
+	result, err := fl.lister.ListDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*ListResult, 0, len(result.Children))
+	for _, child := range result.Children {
+		if skip, reason := fl.matcher.Matches(normalizePath(child.Path), listResultInfo{child}); skip {
+			l.Logger.Debug("Remote path skipped", child.Path, reason)
+			continue
+		}
+		children = append(children, child)
+	}
+	result.Children = children
+	return result, nil
+}
+
+// RemoteFlags attributes of remote files a sync can leave out
+type RemoteFlags int
+
+const (
+	// RemoteEncrypted the remote file is encrypted
+	RemoteEncrypted RemoteFlags = 1 << iota
+	// RemoteShared the remote file has collaborators
+	RemoteShared
+)
+
+func (info fileInfo) remoteFlags() RemoteFlags {
+	var flags RemoteFlags
+	if info.EncryptedKey != "" {
+		flags |= RemoteEncrypted
+	}
+	if info.Shared {
+		flags |= RemoteShared
+	}
+	return flags
+}
+
+// excludeByRemoteFlags removes the remote files having any of flags from the remote, local and previous maps
+// and returns their sorted paths
+func excludeByRemoteFlags(rMap, lMap, prevMap map[string]fileInfo, flags RemoteFlags) []string {
+	var excluded []string
+	for rPath, info := range rMap {
+		if info.remoteFlags()&flags == 0 {
+			continue
+		}
+		delete(rMap, rPath)
+		delete(lMap, rPath)
+		delete(prevMap, rPath)
+		excluded = append(excluded, rPath)
+	}
+	sort.Strings(excluded)
+	return excluded
+}
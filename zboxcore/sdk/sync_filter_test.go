@@ -0,0 +1,216 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFilterWouldInclude(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"keep.txt":       "keep",
+		".DS_Store":      "meta",
+		"build/out.bin":  "out",
+		"src/main.go":    "main",
+		"src/.DS_Store":  "meta",
+		"src/skip/x.txt": "x",
+	})
+	filters := []string{".DS_Store"}
+	excludes := []string{"/build/out.bin", "/src/skip/"}
+	lf := NewLocalFilter("", root, filters, excludes)
+
+	lMap, err := getLocalFileMap(root, filters, getRemoteExcludeMap(excludes), newSyncOptions(nil))
+	require.NoError(t, err)
+
+	for name, want := range map[string]string{
+		"keep.txt":       "included",
+		"src/main.go":    "included",
+		".DS_Store":      "name .DS_Store is filtered",
+		"src/.DS_Store":  "name .DS_Store is filtered",
+		"build/out.bin":  "path /build/out.bin is excluded",
+		"src/skip":       "path /src/skip is excluded",
+		"src/skip/x.txt": "included",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		included, reason := lf.WouldInclude(p, info)
+		require.Equal(t, want, reason, name)
+		require.Equal(t, want == "included", included, name)
+		// same decision as the walk
+		_, walked := lMap["/"+name]
+		require.Equal(t, included, walked, name)
+	}
+
+	info, err := os.Stat(root)
+	require.NoError(t, err)
+	included, reason := lf.WouldInclude(filepath.Dir(root), info)
+	require.False(t, included)
+	require.Contains(t, reason, "outside of the local root")
+}
+
+func TestLocalFilterWouldIncludeOptions(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"keep.txt":    "keep",
+		"large.bin":   "a large file content",
+		".git/config": "config",
+		".env":        "env",
+		"state.json":  "{}",
+	})
+	smallFiles := func(path string, info os.FileInfo) bool { return info.IsDir() || info.Size() <= 10 }
+	opts := []SyncOption{WithHiddenFiles(false), WithLocalFilter(smallFiles)}
+	cachePath := filepath.Join(root, "state.json")
+	lf := NewLocalFilter(cachePath, root, nil, nil, opts...)
+
+	so := newSyncOptions(opts)
+	so.skipLocalPaths = cacheFilePaths(cachePath, root)
+	lMap, err := getLocalFileMap(root, nil, nil, so)
+	require.NoError(t, err)
+
+	for name, want := range map[string]string{
+		"keep.txt":    "included",
+		"large.bin":   "excluded by the local filter",
+		".git":        "hidden .git is skipped",
+		".git/config": "hidden .git is skipped",
+		".env":        "hidden .env is skipped",
+		"state.json":  "sync state file",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		included, reason := lf.WouldInclude(p, info)
+		require.Equal(t, want, reason, name)
+		// same decision as the walk
+		_, walked := lMap["/"+name]
+		require.Equal(t, included, walked, name)
+	}
+}
+
+func TestSyncFilterCallbacks(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"small.txt":       "small",
+		"large.bin":       "a large file content",
+		"dir/small.txt":   "small",
+		"dir/large.bin":   "another large content",
+		"skipped/a.txt":   "a",
+		"skipped/b/c.txt": "c",
+	})
+	smallFiles := func(path string, info os.FileInfo) bool {
+		return path != "/skipped" && (info.IsDir() || info.Size() <= 10)
+	}
+
+	lMap, err := getLocalFileMap(root, nil, map[string]int{}, newSyncOptions([]SyncOption{WithLocalFilter(smallFiles)}))
+	require.NoError(t, err)
+	paths := make([]string, 0, len(lMap))
+	for p := range lMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/.", "/dir", "/dir/small.txt", "/small.txt"}, paths)
+
+	// the remote filter composes with the excludes, the skipped directories are not listed
+	lister := newFakeRemoteLister(map[string]string{
+		"/small.txt":      "small",
+		"/large.bin":      "a large file content",
+		"/dir/small.txt":  "small",
+		"/dir/large.bin":  "another large content",
+		"/skipped/a.txt":  "a",
+		"/excluded/d.txt": "d",
+	})
+	fl := &filterLister{lister: lister, matcher: NewMatcher(skipUnless("excluded by the remote filter", smallFiles))}
+	rMap, err := getRemoteFileMap(fl, getRemoteExcludeMap([]string{"/excluded"}))
+	require.NoError(t, err)
+	paths = paths[:0]
+	for p := range rMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/dir", "/dir/small.txt", "/small.txt"}, paths)
+	require.Zero(t, lister.calls["/skipped"])
+	require.Zero(t, lister.calls["/excluded"])
+}
+
+func TestSyncHiddenFiles(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"a.txt":           "a",
+		".env":            "env",
+		".git/HEAD":       "ref",
+		".git/objects/ab": "object",
+		"dir/.hidden":     "hidden",
+		"dir/b.txt":       "b",
+	})
+	walked := func(opts ...SyncOption) []string {
+		lMap, err := getLocalFileMap(root, nil, map[string]int{}, newSyncOptions(opts))
+		require.NoError(t, err)
+		paths := make([]string, 0, len(lMap))
+		for p := range lMap {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	// included by default
+	require.Equal(t, []string{"/.", "/.env", "/.git", "/.git/HEAD", "/.git/objects", "/.git/objects/ab", "/a.txt", "/dir", "/dir/.hidden", "/dir/b.txt"}, walked())
+	require.Equal(t, walked(), walked(WithHiddenFiles(true)))
+
+	var seen []string
+	require.Equal(t, []string{"/.", "/a.txt", "/dir", "/dir/b.txt"}, walked(WithHiddenFiles(false), WithLocalFilter(func(path string, info os.FileInfo) bool {
+		seen = append(seen, path)
+		return true
+	})))
+	// .git is not walked
+	require.NotContains(t, seen, "/.git/HEAD")
+}
+
+func TestExcludeByRemoteFlags(t *testing.T) {
+	rMap := map[string]fileInfo{
+		"/shared.txt": {Type: fileref.FILE, Hash: "remote", Shared: true},
+		"/secret.txt": {Type: fileref.FILE, Hash: "secret", EncryptedKey: "key"},
+		"/plain.txt":  {Type: fileref.FILE, Hash: "remote"},
+	}
+	lMap := map[string]fileInfo{
+		"/shared.txt": {Type: fileref.FILE, Hash: "local"},
+		"/plain.txt":  {Type: fileref.FILE, Hash: "local"},
+	}
+	prevMap := map[string]fileInfo{"/secret.txt": rMap["/secret.txt"]}
+
+	excluded := excludeByRemoteFlags(rMap, lMap, prevMap, RemoteShared)
+	require.Equal(t, []string{"/shared.txt"}, excluded)
+
+	// the shared file is not overwritten, the encrypted one is still synced
+	diffs := findDelta(rMap, lMap, prevMap, t.TempDir())
+	require.Equal(t, map[string]string{"/plain.txt": Update, "/secret.txt": Delete}, diffOps(diffs))
+
+	require.Equal(t, []string{"/secret.txt"}, excludeByRemoteFlags(rMap, lMap, prevMap, RemoteShared|RemoteEncrypted))
+}
+
+func TestLocalPathsRelativeToRoot(t *testing.T) {
+	// the names share leading characters with the root, which a cutset trim would strip
+	root := filepath.Join(t.TempDir(), "habc")
+	writeSyncTestFiles(t, root, map[string]string{
+		"abc/cab.txt": "1",
+		"b/a.txt":     "2",
+		"habc.txt":    "3",
+		"/h/c/b.txt":  "4",
+	})
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+
+	var files []string
+	for p, info := range lMap {
+		if info.Type == fileref.FILE {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+	require.Equal(t, []string{"/abc/cab.txt", "/b/a.txt", "/h/c/b.txt", "/habc.txt"}, files)
+}
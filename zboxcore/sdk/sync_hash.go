@@ -0,0 +1,104 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/sys"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const defaultHashCheckpointInterval = 1 << 30
+
+// hashCheckpoint state of a file hash interrupted at Offset.
+// Size and ModTime identify the version of the file, a checkpoint of another version is ignored.
+type hashCheckpoint struct {
+	Offset  int64  `json:"offset"`
+	State   []byte `json:"state"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// HashFileResumable computes the same hash as the sync of a local file, saving the hash state to checkpointPath
+// every interval bytes (1 GB if 0). When it is interrupted by ctx or a read error, calling it again with the same
+// checkpointPath resumes from the last checkpoint. The checkpoint is removed once the hash is computed.
+func HashFileResumable(ctx context.Context, filePath string, checkpointPath string, interval int64) (string, error) {
+	var cp *hashCheckpoint
+	if _, err := sys.Files.Stat(checkpointPath); err == nil {
+		cp = &hashCheckpoint{}
+		if err := readSnapshotFile(checkpointPath, cp); err != nil {
+			return "", errors.Wrap(err, "invalid hash checkpoint.")
+		}
+	}
+	hash, err := hashFileFrom(ctx, filePath, sha256.New, cp, interval, func(cp hashCheckpoint) error {
+		return writeSnapshotFile(checkpointPath, cp)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		l.Logger.Error("Removing hash checkpoint failed", err)
+	}
+	return hash, nil
+}
+
+// hashFileFrom hashes filePath, resuming from cp when it matches the file and the hash state can be restored.
+// save is called every interval bytes if the hash state can be marshaled, otherwise an interrupted hash starts over.
+func hashFileFrom(ctx context.Context, filePath string, newHash func() hash.Hash, cp *hashCheckpoint, interval int64, save func(hashCheckpoint) error) (string, error) {
+	if interval <= 0 {
+		interval = defaultHashCheckpointInterval
+	}
+	fp, err := os.Open(localLongPath(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	fInfo, err := fp.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := newHash()
+	marshaler, canSave := h.(encoding.BinaryMarshaler)
+	var offset int64
+	if cp != nil && cp.Size == fInfo.Size() && cp.ModTime == fInfo.ModTime().UnixNano() {
+		if unmarshaler, ok := h.(encoding.BinaryUnmarshaler); ok && unmarshaler.UnmarshalBinary(cp.State) == nil {
+			if _, err := fp.Seek(cp.Offset, io.SeekStart); err != nil {
+				return "", err
+			}
+			offset = cp.Offset
+		} else {
+			h.Reset()
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := io.CopyN(h, fp, interval)
+		offset += n
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if err != nil || offset == fInfo.Size() {
+			break
+		}
+		if canSave {
+			state, merr := marshaler.MarshalBinary()
+			if merr != nil {
+				return "", merr
+			}
+			if err := save(hashCheckpoint{Offset: offset, State: state, Size: fInfo.Size(), ModTime: fInfo.ModTime().UnixNano()}); err != nil {
+				l.Logger.Error("Saving hash checkpoint failed", err)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// opaqueHash hides the state marshaling of the wrapped hash
+type opaqueHash struct {
+	hash.Hash
+}
+
+func TestHashFileResumable(t *testing.T) {
+	root := t.TempDir()
+	data := make([]byte, 10*1024+100)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	filePath := filepath.Join(root, "big.bin")
+	require.NoError(t, os.WriteFile(filePath, data, 0644))
+	expected := mustFileHash(t, filePath)
+
+	// interrupted after the third checkpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	var saved []hashCheckpoint
+	_, err := hashFileFrom(ctx, filePath, sha256.New, nil, 1024, func(cp hashCheckpoint) error {
+		saved = append(saved, cp)
+		if len(saved) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int64(3*1024), saved[2].Offset)
+
+	cpPath := filepath.Join(root, "hash.checkpoint")
+	require.NoError(t, writeSnapshotFile(cpPath, saved[2]))
+	digest, err := HashFileResumable(context.Background(), filePath, cpPath, 1024)
+	require.NoError(t, err)
+	require.Equal(t, expected, digest)
+	require.NoFileExists(t, cpPath)
+
+	// a checkpoint of an older version of the file is ignored
+	stale := saved[2]
+	stale.Size--
+	digest, err = hashFileFrom(context.Background(), filePath, sha256.New, &stale, 1024, func(hashCheckpoint) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, expected, digest)
+
+	// without marshaling the hash can't be checkpointed and starts over
+	newOpaque := func() hash.Hash { return opaqueHash{sha256.New()} }
+	saves := 0
+	digest, err = hashFileFrom(context.Background(), filePath, newOpaque, &saved[2], 1024, func(hashCheckpoint) error {
+		saves++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, digest)
+	require.Zero(t, saves)
+}
@@ -0,0 +1,72 @@
+package sdk
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultHashBufferSize size of the read buffer of the local file hashing
+const defaultHashBufferSize = 64 * 1024
+
+// defaultFileHasher hashes the local files of the syncs without WithHashBufferSize
+var defaultFileHasher = newFileHasher(defaultHashBufferSize)
+
+// fileHasher hashes local files with SHA-256 through buffered readers of size bytes. The readers and hashes are pooled
+// and reused across files, so a walk over many files doesn't allocate a buffer for each one.
+type fileHasher struct {
+	size int
+	pool sync.Pool
+}
+
+type hashBuffer struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func newFileHasher(size int) *fileHasher {
+	if size < 16 {
+		// the smallest buffer bufio accepts
+		size = 16
+	}
+	fh := &fileHasher{size: size}
+	fh.pool.New = func() interface{} {
+		return &hashBuffer{r: bufio.NewReaderSize(nil, size), h: sha256.New()}
+	}
+	return fh
+}
+
+func (fh *fileHasher) hash(filePath string) (string, error) {
+	fp, err := os.Open(localLongPath(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	buf := fh.pool.Get().(*hashBuffer)
+	defer func() {
+		buf.r.Reset(nil)
+		fh.pool.Put(buf)
+	}()
+	buf.r.Reset(fp)
+	buf.h.Reset()
+	for {
+		// a full buffer is hashed at once, without copying it out of the reader
+		chunk, err := buf.r.Peek(fh.size)
+		buf.h.Write(chunk)
+		if _, discardErr := buf.r.Discard(len(chunk)); discardErr != nil {
+			return "", discardErr
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(buf.h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHasher(t *testing.T) {
+	root := t.TempDir()
+	contents := map[string]string{
+		"empty.txt": "",
+		"small.txt": "small",
+		"exact.txt": strings.Repeat("e", 16),
+		"big.txt":   strings.Repeat("0123456789", 1000),
+	}
+	writeSyncTestFiles(t, root, contents)
+
+	for _, size := range []int{0, 16, 100, defaultHashBufferSize} {
+		fh := newFileHasher(size)
+		for name, content := range contents {
+			sum := sha256.Sum256([]byte(content))
+			hash, err := fh.hash(filepath.Join(root, name))
+			require.NoError(t, err)
+			require.Equal(t, hex.EncodeToString(sum[:]), hash, "%v with a buffer of %v", name, size)
+		}
+	}
+
+	_, err := newFileHasher(16).hash(filepath.Join(root, "missing.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+// calcFileHashCopy the hashing with io.Copy, allocating a buffer for every file, to compare fileHasher with
+func calcFileHashCopy(filePath string) (string, error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func BenchmarkCalcFileHash(b *testing.B) {
+	root := b.TempDir()
+	const numFiles = 10000
+	paths := make([]string, numFiles)
+	for i := range paths {
+		paths[i] = filepath.Join(root, fmt.Sprintf("%05d.txt", i))
+		if err := os.WriteFile(paths[i], []byte(strings.Repeat("x", 1+i%4096)), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	benchmarks := []struct {
+		name string
+		hash func(string) (string, error)
+	}{
+		{"io.Copy", calcFileHashCopy},
+		{"buffered", newFileHasher(defaultHashBufferSize).hash},
+		{"buffered_4k", newFileHasher(4096).hash},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, p := range paths {
+					if _, err := bm.hash(p); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
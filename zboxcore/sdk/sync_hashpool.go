@@ -0,0 +1,133 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/0chain/errors"
+	"golang.org/x/time/rate"
+)
+
+// hashPoolReadSize size of the reads of a HashPool, and burst of its rate limiter
+const hashPoolReadSize = 64 * 1024
+
+// ErrHashPoolClosed the file was submitted to a HashPool which is shut down
+var ErrHashPoolClosed = errors.New("hash_pool_closed", "hash pool is shut down")
+
+// HashPool hashes local files on a bounded number of goroutines, reading them at a bounded rate,
+// so the hashing of large syncs doesn't compete with the other work of the host. A pool can be shared by concurrent syncs.
+type HashPool struct {
+	ctx     context.Context
+	jobs    chan hashJob
+	limiter *rate.Limiter
+	wg      sync.WaitGroup
+	closeMu sync.Once
+}
+
+type hashJob struct {
+	filePath string
+	result   chan hashResult
+}
+
+type hashResult struct {
+	hash string
+	err  error
+}
+
+// NewHashPool starts a HashPool of workers goroutines reading at most bytesPerSecond, 0 for no limit.
+// Cancelling ctx shuts the pool down: the hashes in progress stop at their next read and every pending file gets ctx error.
+func NewHashPool(ctx context.Context, workers int, bytesPerSecond int) *HashPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &HashPool{
+		ctx:  ctx,
+		jobs: make(chan hashJob),
+	}
+	if bytesPerSecond > 0 {
+		p.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), hashPoolReadSize)
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *HashPool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			hash, err := p.hash(job.filePath)
+			job.result <- hashResult{hash: hash, err: err}
+		}
+	}
+}
+
+// Hash hashes filePath with SHA-256 on the pool, waiting for a free worker
+func (p *HashPool) Hash(filePath string) (hash string, err error) {
+	defer func() {
+		// the jobs channel is closed by Close
+		if recover() != nil {
+			hash, err = "", ErrHashPoolClosed
+		}
+	}()
+	job := hashJob{filePath: filePath, result: make(chan hashResult, 1)}
+	select {
+	case <-p.ctx.Done():
+		return "", p.ctx.Err()
+	case p.jobs <- job:
+	}
+	res := <-job.result
+	return res.hash, res.err
+}
+
+// Close shuts the pool down once the hashes in progress are done, and waits for its goroutines to exit
+func (p *HashPool) Close() {
+	p.closeMu.Do(func() {
+		close(p.jobs)
+	})
+	p.wg.Wait()
+}
+
+func (p *HashPool) hash(filePath string) (string, error) {
+	fp, err := os.Open(localLongPath(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	buf := make([]byte, hashPoolReadSize)
+	for {
+		if err := p.ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := fp.Read(buf)
+		if n > 0 {
+			if p.limiter != nil {
+				if err := p.limiter.WaitN(p.ctx, n); err != nil {
+					return "", err
+				}
+			}
+			h.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
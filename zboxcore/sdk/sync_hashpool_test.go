@@ -0,0 +1,64 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPool(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+
+	pool := NewHashPool(context.Background(), 2, 0)
+	defer pool.Close()
+	diffs, err := GetManifestDiff(map[string]string{
+		"/a.txt":     mustFileHash(t, filepath.Join(root, "a.txt")),
+		"/dir/b.txt": "stale",
+	}, root, nil, nil, WithHashPool(pool))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/dir/b.txt": Update}, diffOps(diffs))
+
+	pool.Close()
+	_, err = pool.Hash(filepath.Join(root, "a.txt"))
+	require.ErrorIs(t, err, ErrHashPoolClosed)
+}
+
+func TestHashPoolShutdownMidHash(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "large.bin")
+	require.NoError(t, os.WriteFile(filePath, make([]byte, 4*hashPoolReadSize), 0644))
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// one read per second, far slower than the test
+	pool := NewHashPool(ctx, 2, hashPoolReadSize)
+
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := pool.Hash(filePath)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-errs:
+			require.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("hash not stopped by the cancellation")
+		}
+	}
+	pool.Close()
+	// require.Eventually runs the condition on a goroutine of its own
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > baseline; time.Sleep(10 * time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "goroutines leaked by the pool")
+	}
+}
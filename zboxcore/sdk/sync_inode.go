@@ -0,0 +1,27 @@
+//go:build !windows && !js
+// +build !windows,!js
+
+package sdk
+
+import (
+	"os"
+	"syscall"
+)
+
+// getFileInodeKey returns the device and inode identifying the file content on disk
+func getFileInodeKey(info os.FileInfo) (inodeKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inodeKey{}, false
+	}
+	return inodeKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// getInodeKey returns the device and inode of the file, whatever its number of links
+func getInodeKey(info os.FileInfo) (inodeKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inodeKey{}, false
+	}
+	return inodeKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
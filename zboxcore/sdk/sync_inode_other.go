@@ -0,0 +1,16 @@
+//go:build windows || js
+// +build windows js
+
+package sdk
+
+import "os"
+
+// getFileInodeKey inode information is not available, hardlinks are treated as regular files
+func getFileInodeKey(info os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
+
+// getInodeKey inode information is not available
+func getInodeKey(info os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
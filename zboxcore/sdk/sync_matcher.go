@@ -0,0 +1,262 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// MatchRule a rule of a Matcher. When it applies to a path it decides if the path is skipped, with the reason why.
+type MatchRule struct {
+	applies func(path string, info os.FileInfo) bool
+	skip    bool
+	// prune the walks don't descend into a directory skipped by the rule
+	prune  bool
+	reason func(path string, info os.FileInfo) string
+}
+
+// SkipNames skips the files and directories with any of the names, the local filters of GetAllocationDiff
+func SkipNames(names ...string) MatchRule {
+	nameMap := make(map[string]bool, len(names))
+	for _, name := range names {
+		nameMap[name] = true
+	}
+	return skipNameMap(nameMap)
+}
+
+func skipNameMap(nameMap map[string]bool) MatchRule {
+	return MatchRule{
+		applies: func(path string, info os.FileInfo) bool { return nameMap[info.Name()] },
+		skip:    true,
+		reason:  func(path string, info os.FileInfo) string { return "name " + info.Name() + " is filtered" },
+	}
+}
+
+// SkipPaths skips the exact remote paths, the remote excludes of GetAllocationDiff
+func SkipPaths(paths ...string) MatchRule {
+	return skipPathMap(getRemoteExcludeMap(paths))
+}
+
+func skipPathMap(exclMap map[string]int) MatchRule {
+	return MatchRule{
+		applies: func(path string, info os.FileInfo) bool {
+			_, ok := exclMap[path]
+			return ok
+		},
+		skip:   true,
+		reason: func(path string, info os.FileInfo) string { return "path " + path + " is excluded" },
+	}
+}
+
+// SkipIf skips the paths pred is true for
+func SkipIf(reason string, pred func(path string, info os.FileInfo) bool) MatchRule {
+	return MatchRule{
+		applies: pred,
+		skip:    true,
+		reason:  func(path string, info os.FileInfo) string { return reason },
+	}
+}
+
+// skipUnless skips the paths include is false for, but the local root, and doesn't walk the directories it skips
+func skipUnless(reason string, include func(path string, info os.FileInfo) bool) MatchRule {
+	return MatchRule{
+		applies: func(path string, info os.FileInfo) bool { return path != "/." && !include(path, info) },
+		skip:    true,
+		prune:   true,
+		reason:  func(path string, info os.FileInfo) string { return reason },
+	}
+}
+
+// skipHidden skips the hidden files and directories, but the local root, and doesn't walk the directories it skips
+var skipHidden = MatchRule{
+	applies: func(path string, info os.FileInfo) bool { return path != "/." && strings.HasPrefix(info.Name(), ".") },
+	skip:    true,
+	prune:   true,
+	reason:  func(path string, info os.FileInfo) string { return "hidden " + info.Name() + " is skipped" },
+}
+
+// IncludeIf includes the paths pred is true for, whatever the rules after it
+func IncludeIf(reason string, pred func(path string, info os.FileInfo) bool) MatchRule {
+	return MatchRule{
+		applies: pred,
+		reason:  func(path string, info os.FileInfo) string { return reason },
+	}
+}
+
+// Matcher decides which paths a walk skips with an ordered list of rules: the first rule applying to a path decides,
+// a path no rule applies to is included. It is shared by the local and the remote walks, the paths are the remote ones,
+// e.g. /dir/file.txt, whichever side they are on.
+type Matcher struct {
+	rules []MatchRule
+}
+
+// NewMatcher create a Matcher applying the rules in the given order
+func NewMatcher(rules ...MatchRule) *Matcher {
+	return &Matcher{rules: rules}
+}
+
+// Matches tells if path is skipped and why
+func (m *Matcher) Matches(path string, info os.FileInfo) (skip bool, reason string) {
+	skip, _, reason = m.match(path, info)
+	return skip, reason
+}
+
+func (m *Matcher) match(path string, info os.FileInfo) (skip bool, prune bool, reason string) {
+	for _, rule := range m.rules {
+		if rule.applies(path, info) {
+			return rule.skip, rule.skip && rule.prune, rule.reason(path, info)
+		}
+	}
+	return false, false, "included"
+}
+
+// remoteMatcher the matcher of the remote walks, skipping the excluded paths and the ones matching the exclude patterns
+func remoteMatcher(exclMap map[string]int) *Matcher {
+	exact, patterns := splitExcludeMap(exclMap)
+	return NewMatcher(skipPathMap(exact), SkipPatterns(patterns...))
+}
+
+// splitExcludeMap separates the exact remote paths from the patterns of the excludes
+func splitExcludeMap(exclMap map[string]int) (map[string]int, []string) {
+	exact := make(map[string]int, len(exclMap))
+	var patterns []string
+	for p, idx := range exclMap {
+		if isExcludePattern(p) {
+			patterns = append(patterns, p)
+		} else {
+			exact[p] = idx
+		}
+	}
+	sort.Strings(patterns)
+	return exact, patterns
+}
+
+// isExcludePattern tells if a remote exclude is a pattern rather than an exact remote path
+func isExcludePattern(p string) bool {
+	return !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "*?[")
+}
+
+// isFilterPattern tells if a local filter is a pattern rather than an exact name
+func isFilterPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[/")
+}
+
+// excludePattern a compiled gitignore style pattern
+type excludePattern struct {
+	raw      string
+	segments []string
+	// anchored the pattern matches from the root, else a single name at any depth
+	anchored bool
+	// dirOnly the pattern only matches directories
+	dirOnly bool
+}
+
+func compileExcludePattern(raw string) excludePattern {
+	p := excludePattern{raw: raw}
+	pattern := raw
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	p.anchored = strings.Contains(pattern, "/")
+	p.segments = strings.Split(strings.TrimLeft(pattern, "/"), "/")
+	return p
+}
+
+// matches tells if the pattern matches the remote path or one of its parent directories, so it covers their subtree
+func (p excludePattern) matches(remotePath string, isDir bool) bool {
+	cleaned := strings.TrimLeft(path.Clean("/"+remotePath), "/")
+	if cleaned == "" {
+		return false
+	}
+	segs := strings.Split(cleaned, "/")
+	for k := 1; k <= len(segs); k++ {
+		// the parents are directories
+		if p.dirOnly && k == len(segs) && !isDir {
+			continue
+		}
+		if p.anchored {
+			if matchSegments(p.segments, segs[:k]) {
+				return true
+			}
+		} else if ok, _ := path.Match(p.segments[0], segs[k-1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments with pattern segments, ** matching any number of segments
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segs[1:])
+}
+
+// SkipPatterns skips the paths matching any of the gitignore style patterns, with the subtrees of the directories matching:
+// a pattern without / matches a name at any depth, e.g. *.tmp, one with / matches from the root, e.g. /cache/**,
+// where ** matches any number of directories, and a pattern ending with / only matches directories, e.g. node_modules/.
+func SkipPatterns(patterns ...string) MatchRule {
+	compiled := make([]excludePattern, 0, len(patterns))
+	for _, raw := range patterns {
+		compiled = append(compiled, compileExcludePattern(raw))
+	}
+	matching := func(path string, info os.FileInfo) string {
+		for _, p := range compiled {
+			if p.matches(path, info.IsDir()) {
+				return p.raw
+			}
+		}
+		return ""
+	}
+	return MatchRule{
+		applies: func(path string, info os.FileInfo) bool { return matching(path, info) != "" },
+		skip:    true,
+		prune:   true,
+		reason: func(path string, info os.FileInfo) string {
+			return "path " + path + " matches pattern " + matching(path, info)
+		},
+	}
+}
+
+// remoteEntryInfo exposes a remote file known by its path and fileInfo as os.FileInfo to the matcher
+func remoteEntryInfo(remotePath string, info fileInfo) os.FileInfo {
+	return listResultInfo{&ListResult{Name: path.Base(remotePath), Path: remotePath, Type: info.Type, Size: info.Size, Mode: info.Mode}}
+}
+
+// listResultInfo exposes a remote entry as os.FileInfo to the matcher
+type listResultInfo struct {
+	ref *ListResult
+}
+
+func (li listResultInfo) Name() string       { return li.ref.Name }
+func (li listResultInfo) Size() int64        { return li.ref.Size }
+func (li listResultInfo) ModTime() time.Time { return time.Unix(int64(li.ref.UpdatedAt), 0) }
+func (li listResultInfo) IsDir() bool        { return li.ref.Type == fileref.DIRECTORY }
+func (li listResultInfo) Sys() interface{}   { return li.ref }
+
+func (li listResultInfo) Mode() os.FileMode {
+	if li.IsDir() {
+		return li.ref.Mode | os.ModeDir
+	}
+	return li.ref.Mode
+}
@@ -0,0 +1,184 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func testMatchInfo(name string, size int64, dir bool) os.FileInfo {
+	ref := &ListResult{Name: name, Size: size, Type: fileref.FILE}
+	if dir {
+		ref.Type = fileref.DIRECTORY
+	}
+	return listResultInfo{ref}
+}
+
+func TestMatcherPrecedence(t *testing.T) {
+	isLarge := func(path string, info os.FileInfo) bool { return info.Size() > 100 }
+	isKeep := func(path string, info os.FileInfo) bool { return strings.HasPrefix(path, "/keep/") }
+
+	tests := []struct {
+		name   string
+		rules  []MatchRule
+		path   string
+		info   os.FileInfo
+		skip   bool
+		reason string
+	}{
+		{name: "no rule", path: "/a.txt", info: testMatchInfo("a.txt", 1, false), reason: "included"},
+		{name: "name", rules: []MatchRule{SkipNames(".DS_Store")}, path: "/d/.DS_Store", info: testMatchInfo(".DS_Store", 1, false), skip: true, reason: "name .DS_Store is filtered"},
+		{name: "name no match", rules: []MatchRule{SkipNames(".DS_Store")}, path: "/a.txt", info: testMatchInfo("a.txt", 1, false), reason: "included"},
+		{name: "path", rules: []MatchRule{SkipPaths("/tmp/")}, path: "/tmp", info: testMatchInfo("tmp", 0, true), skip: true, reason: "path /tmp is excluded"},
+		{name: "path is exact", rules: []MatchRule{SkipPaths("/tmp")}, path: "/tmp2", info: testMatchInfo("tmp2", 0, true), reason: "included"},
+		{
+			name:  "name before path",
+			rules: []MatchRule{SkipNames("x"), SkipPaths("/x")},
+			path:  "/x", info: testMatchInfo("x", 1, false), skip: true, reason: "name x is filtered",
+		},
+		{
+			name:  "path before name",
+			rules: []MatchRule{SkipPaths("/x"), SkipNames("x")},
+			path:  "/x", info: testMatchInfo("x", 1, false), skip: true, reason: "path /x is excluded",
+		},
+		{
+			name:  "include before skip",
+			rules: []MatchRule{IncludeIf("kept", isKeep), SkipIf("too large", isLarge)},
+			path:  "/keep/big.bin", info: testMatchInfo("big.bin", 1000, false), reason: "kept",
+		},
+		{
+			name:  "skip before include",
+			rules: []MatchRule{SkipIf("too large", isLarge), IncludeIf("kept", isKeep)},
+			path:  "/keep/big.bin", info: testMatchInfo("big.bin", 1000, false), skip: true, reason: "too large",
+		},
+		{
+			name:  "include not applying",
+			rules: []MatchRule{IncludeIf("kept", isKeep), SkipIf("too large", isLarge)},
+			path:  "/other/big.bin", info: testMatchInfo("big.bin", 1000, false), skip: true, reason: "too large",
+		},
+		{
+			name:  "no rule applying",
+			rules: []MatchRule{IncludeIf("kept", isKeep), SkipIf("too large", isLarge), SkipNames("x")},
+			path:  "/other/small.txt", info: testMatchInfo("small.txt", 10, false), reason: "included",
+		},
+		{
+			name: "directory predicate",
+			rules: []MatchRule{SkipIf("directory", func(path string, info os.FileInfo) bool {
+				return info.IsDir() && info.Mode().IsDir()
+			})},
+			path: "/d", info: testMatchInfo("d", 0, true), skip: true, reason: "directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			skip, reason := NewMatcher(test.rules...).Matches(test.path, test.info)
+			require.Equal(t, test.skip, skip)
+			require.Equal(t, test.reason, reason)
+		})
+	}
+}
+
+func TestMatcherRemoteWalk(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{
+		"/a.txt":          "a",
+		"/excluded/b.txt": "b",
+		"/dir/c.txt":      "c",
+		"/dir/d.txt":      "d",
+	})
+	rMap, err := getRemoteFileMap(lister, getRemoteExcludeMap([]string{"/excluded", "/dir/d.txt"}))
+	require.NoError(t, err)
+	paths := make([]string, 0, len(rMap))
+	for p := range rMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/a.txt", "/dir", "/dir/c.txt"}, paths)
+	require.Zero(t, lister.calls["/excluded"])
+}
+
+func TestSkipPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		dir     bool
+		skip    bool
+	}{
+		{"*.tmp", "/a.tmp", false, true},
+		{"*.tmp", "/d/e/x.tmp", false, true},
+		{"*.tmp", "/a.tmpx", false, false},
+		{"*.tmp", "/d.tmp/x.txt", false, true},
+		{"node_modules/", "/x/node_modules", true, true},
+		{"node_modules/", "/x/node_modules/p/a.js", false, true},
+		{"node_modules/", "/node_modules", false, false},
+		{"/cache/**", "/cache/a", false, true},
+		{"/cache/**", "/cache/b/c", false, true},
+		{"/cache/**", "/x/cache/a", false, false},
+		{"/src/*.go", "/src/main.go", false, true},
+		{"/src/*.go", "/src/pkg/main.go", false, false},
+		{"/src/**/*.go", "/src/pkg/sub/main.go", false, true},
+		{"/src/**/*.go", "/src/main.go", false, true},
+		{"/src/**/*.go", "/lib/main.go", false, false},
+		{".*", "/", true, false},
+		{"docs/api/", "/docs/api", true, true},
+		{"docs/api/", "/x/docs/api", true, false},
+	}
+	for _, test := range tests {
+		skip, reason := NewMatcher(SkipPatterns(test.pattern)).Matches(test.path, testMatchInfo(path.Base(test.path), 1, test.dir))
+		require.Equal(t, test.skip, skip, "%v %v", test.pattern, test.path)
+		if skip {
+			require.Equal(t, "path "+test.path+" matches pattern "+test.pattern, reason)
+		}
+	}
+}
+
+func TestExcludePatternsNotDescended(t *testing.T) {
+	files := map[string]string{
+		"/a.txt":                 "a",
+		"/a.tmp":                 "tmp",
+		"/cache/x/y.bin":         "y",
+		"/src/node_modules/m.js": "m",
+		"/src/main.go":           "main",
+	}
+	excludes := []string{"*.tmp", "node_modules/", "/cache/**"}
+	lister := newFakeRemoteLister(files)
+	rMap, err := getRemoteFileMap(lister, getRemoteExcludeMap(excludes))
+	require.NoError(t, err)
+	paths := make([]string, 0, len(rMap))
+	for p := range rMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/a.txt", "/src", "/src/main.go"}, paths)
+	require.Zero(t, lister.calls["/cache"])
+	require.Zero(t, lister.calls["/src/node_modules"])
+
+	root := t.TempDir()
+	local := make(map[string]string)
+	for p, content := range files {
+		local[p[1:]] = content
+	}
+	writeSyncTestFiles(t, root, local)
+	var hashed []string
+	so := newSyncOptions([]SyncOption{func(so *syncOptions) {
+		so.hashFile = func(filePath string) (string, error) {
+			hashed = append(hashed, filePath)
+			return calcFileHash(filePath)
+		}
+	}})
+	lMap, err := getLocalFileMap(root, []string{"*.tmp"}, getRemoteExcludeMap([]string{"node_modules/", "/cache/**"}), so)
+	require.NoError(t, err)
+	require.Contains(t, lMap, "/a.txt")
+	require.Contains(t, lMap, "/src/main.go")
+	require.NotContains(t, lMap, "/a.tmp")
+	require.NotContains(t, lMap, "/cache")
+	require.NotContains(t, lMap, "/src/node_modules/m.js")
+	sort.Strings(hashed)
+	require.Equal(t, []string{filepath.Join(root, "a.txt"), filepath.Join(root, "src", "main.go")}, hashed)
+}
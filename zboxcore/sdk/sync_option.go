@@ -0,0 +1,328 @@
+package sdk
+
+import (
+	"crypto/ed25519"
+	"os"
+	"time"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// SyncOption set sync option
+type SyncOption func(so *syncOptions)
+
+type syncOptions struct {
+	compareDirHashes    bool
+	detectHardlinks     bool
+	syncRemoteMode      bool
+	checkDiff           bool
+	packMaxFileSize     int64
+	packMinFiles        int
+	remoteCache         *RemoteListCache
+	excludeRemoteFlags  RemoteFlags
+	remoteAuthoritative bool
+	deleteLocalOnly     bool
+	hashFile            func(filePath string) (string, error)
+	encryptor           RemoteHashEncryptor
+	dedupPaths          bool
+	onDuplicate         func(path string, remote bool)
+	snapshotPublicKey   ed25519.PublicKey
+	onHashError         func(path string, err error) error
+	detectRenames       bool
+	progress            func(SyncProgress)
+	syncEmptyDirs       bool
+	followSymlinks      bool
+	onSymlinkSkipped    func(path string)
+	conflictPolicy      ConflictPolicy
+	verifyRemote        bool
+	localFilter         func(path string, info os.FileInfo) bool
+	remoteFilter        func(path string, info os.FileInfo) bool
+	caseInsensitive     bool
+	prevSnapshot        []byte
+	onUnreadableDir     func(path string, err error)
+	unreadableDirs      LocalReadErrors
+	onLongPath          func(path string, err error)
+	skipHidden          bool
+	softDeadline        time.Time
+	// skipLocalPaths remote paths of the local files never synced, set by GetAllocationDiff for its own state file
+	skipLocalPaths map[string]bool
+}
+
+// hashError decides if the local walk goes on without the file which failed to hash, by default it does
+func (so *syncOptions) hashError(path string, err error) error {
+	l.Logger.Error("Hashing local file failed", path, err)
+	if so.onHashError == nil {
+		return nil
+	}
+	return so.onHashError(path, err)
+}
+
+// skipUnreadableDir collects and reports a local directory which couldn't be read
+func (so *syncOptions) skipUnreadableDir(p string, err error) {
+	so.unreadableDirs = append(so.unreadableDirs, LocalReadError{Dir: p, Err: err})
+	if so.onUnreadableDir != nil {
+		so.onUnreadableDir(p, err)
+	}
+}
+
+// skipLongPath reports a local path longer than the filesystem accepts
+func (so *syncOptions) skipLongPath(p string, err error) {
+	if so.onLongPath != nil {
+		so.onLongPath(p, err)
+	}
+}
+
+func newSyncOptions(opts []SyncOption) *syncOptions {
+	so := &syncOptions{
+		hashFile: calcFileHash,
+	}
+	for _, opt := range opts {
+		opt(so)
+	}
+	return so
+}
+
+// WithDirHashCompare turn on/off comparing directories by their tree hash. Subtrees matching on both sides are skipped by the diff.
+func WithDirHashCompare(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.compareDirHashes = on
+	}
+}
+
+// WithHardlinkDetection turn on/off hardlink detection on the local walk. A file linked to an already visited one
+// is hashed once and emitted as a Link to the first path instead of another Upload. It is ignored where inodes are not available.
+func WithHardlinkDetection(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.detectHardlinks = on
+	}
+}
+
+// WithMerkleRootHash hash local files with the fixed merkle root the blobbers compute on chunks of chunkSize,
+// instead of the SHA-256 of the content, so they can be compared with remote states holding merkle roots.
+func WithMerkleRootHash(chunkSize int) SyncOption {
+	return func(so *syncOptions) {
+		so.hashFile = func(filePath string) (string, error) {
+			return calcFileMerkleRoot(filePath, chunkSize)
+		}
+	}
+}
+
+// WithRemoteModeSync turn on/off emitting a Chmod for files whose content matches but whose remote permission bits differ
+// from the local ones. Files listed without mode, by blobbers that don't store it, are never reported.
+func WithRemoteModeSync(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.syncRemoteMode = on
+	}
+}
+
+// WithDiffCheck turn on/off verifying the plan before returning it: every file must be planned exactly once
+// and applying the plan must leave both sides in sync. An inconsistent plan is returned as an error.
+func WithDiffCheck(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.checkDiff = on
+	}
+}
+
+// WithSmallFilePacking groups the uploads of files up to maxFileSize bytes in the same directory into a single Pack operation
+// when there are at least minFiles of them, so the plan stays short. The members are still uploaded as separate files,
+// ApplyDiff and SyncToRemote report each in its own DiffResult. 0 maxFileSize disables it.
+func WithSmallFilePacking(maxFileSize int64, minFiles int) SyncOption {
+	return func(so *syncOptions) {
+		so.packMaxFileSize = maxFileSize
+		so.packMinFiles = minFiles
+	}
+}
+
+// WithRemoteListCache list the remote tree through cache, the directories listed within its TTL are not listed again
+func WithRemoteListCache(cache *RemoteListCache) SyncOption {
+	return func(so *syncOptions) {
+		so.remoteCache = cache
+	}
+}
+
+// WithRemoteFlagExclude leave out of the sync the remote files having any of flags, e.g. RemoteShared to never overwrite shared files.
+// They are neither downloaded, overwritten nor deleted, each one is logged.
+func WithRemoteFlagExclude(flags RemoteFlags) SyncOption {
+	return func(so *syncOptions) {
+		so.excludeRemoteFlags = flags
+	}
+}
+
+// WithRemoteAuthoritative make the remote the only source of truth, for pull or restore workflows.
+// Every remote file missing locally or different from the local copy is downloaded over it: local changes are lost
+// and no Conflict is ever reported. With deleteLocalOnly, local files and directories missing remotely are deleted as well.
+// Nothing is uploaded or deleted remotely.
+func WithRemoteAuthoritative(deleteLocalOnly bool) SyncOption {
+	return func(so *syncOptions) {
+		so.remoteAuthoritative = true
+		so.deleteLocalOnly = deleteLocalOnly
+	}
+}
+
+// WithEncryptedRemote compare the remote files stored encrypted with the hash enc derives from their local copy,
+// instead of the hash of the plain content which never matches the ciphertext one.
+func WithEncryptedRemote(enc RemoteHashEncryptor) SyncOption {
+	return func(so *syncOptions) {
+		so.encryptor = enc
+	}
+}
+
+// WithHashPool hash the local files on pool instead of the goroutine walking the local tree. It replaces WithMerkleRootHash.
+func WithHashPool(pool *HashPool) SyncOption {
+	return func(so *syncOptions) {
+		so.hashFile = pool.Hash
+	}
+}
+
+// WithPathDedup normalize the local and remote paths before the diff and keep the first entry of a path listed twice,
+// e.g. a file reached again through a symlink, instead of the last one silently. Every duplicate is logged and reported to warn, which may be nil.
+func WithPathDedup(warn func(path string, remote bool)) SyncOption {
+	return func(so *syncOptions) {
+		so.dedupPaths = true
+		so.onDuplicate = warn
+	}
+}
+
+// WithSnapshotPublicKey accept only a last sync cache signed by the private key of publicKey, see RemoteSnapshotOptions.SigningKey
+func WithSnapshotPublicKey(publicKey ed25519.PublicKey) SyncOption {
+	return func(so *syncOptions) {
+		so.snapshotPublicKey = publicKey
+	}
+}
+
+// WithHashErrorHandler decide what to do with a local file which fails to hash, e.g. for lack of permission.
+// handler returns nil to skip the file and go on with the walk, or the error aborting the diff. By default files are skipped.
+// A skipped file is left out of the diff on both sides, its remote copy is neither deleted nor downloaded.
+func WithHashErrorHandler(handler func(path string, err error) error) SyncOption {
+	return func(so *syncOptions) {
+		so.onHashError = handler
+	}
+}
+
+// WithRenameDetection turn on/off replacing a file deleted on one side and a file with the same content transferred
+// from that side by a single Rename or LocalRename, so a moved file is not transferred again.
+func WithRenameDetection(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.detectRenames = on
+	}
+}
+
+// WithProgress report the progress of the remote listing and of the local walk to progress, e.g. to show a progress bar.
+// It is called from the goroutine running the diff.
+func WithProgress(progress func(SyncProgress)) SyncOption {
+	return func(so *syncOptions) {
+		so.progress = progress
+	}
+}
+
+// WithEmptyDirSync turn on/off planning a CreateDir or LocalCreateDir for every directory new on one side.
+// Directories are otherwise created only with the files transferred into them, so empty ones are not synced.
+func WithEmptyDirSync(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.syncEmptyDirs = on
+	}
+}
+
+// WithFollowSymlinks turn on/off following the symlinks of the local tree. A followed symlink is synced as the file or
+// directory it points to, at the path of the link. Otherwise, as by default, symlinks are left out of the sync and reported
+// to skipped, which may be nil. Broken symlinks, symlinked directories already walked, e.g. a loop back to a parent, and
+// symlinked directories where inodes are not available are always skipped.
+func WithFollowSymlinks(follow bool, skipped func(path string)) SyncOption {
+	return func(so *syncOptions) {
+		so.followSymlinks = follow
+		so.onSymlinkSkipped = skipped
+	}
+}
+
+// WithHashBufferSize hash the local files through a read buffer of size bytes, 64 KiB by default. The buffers are reused
+// across the files of the walk. It replaces WithMerkleRootHash and WithHashPool.
+func WithHashBufferSize(size int) SyncOption {
+	return func(so *syncOptions) {
+		so.hashFile = newFileHasher(size).hash
+	}
+}
+
+// WithConflictPolicy resolve the files changed on both sides since the last sync with policy, instead of planning them
+// as Conflict. The modification times PreferNewer compares are the local ones and the remote update times.
+func WithConflictPolicy(policy ConflictPolicy) SyncOption {
+	return func(so *syncOptions) {
+		so.conflictPolicy = policy
+	}
+}
+
+// WithRemoteVerify turn on/off fetching again the file meta of every file matching on both sides, so a stale or wrong hash
+// listed by the blobbers doesn't hide a change. It makes one request per matching file and is off by default.
+// Encrypted files never match their local copy before WithEncryptedRemote applies and are not verified.
+func WithRemoteVerify(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.verifyRemote = on
+	}
+}
+
+// WithLocalFilter include in the sync only the local files and directories include returns true for, e.g. by size or age.
+// It applies after the local filters and the remote excludes, to the remote path of the file, e.g. /dir/file.txt.
+// The directories left out are not walked.
+func WithLocalFilter(include func(path string, info os.FileInfo) bool) SyncOption {
+	return func(so *syncOptions) {
+		so.localFilter = include
+	}
+}
+
+// WithRemoteFilter include in the sync only the remote files and directories include returns true for, after the remote excludes.
+// info describes the listed entry, its modification time is the remote update time. The directories left out are not listed.
+func WithRemoteFilter(include func(path string, info os.FileInfo) bool) SyncOption {
+	return func(so *syncOptions) {
+		so.remoteFilter = include
+	}
+}
+
+// WithCaseInsensitive turn on/off matching local paths to the remote ones whatever their case, for local filesystems
+// ignoring it as on macOS and Windows. A local /readme.md is then the remote /Readme.md rather than a file to upload
+// next to one to download. The diff uses the remote spelling, which opens the same local file.
+func WithCaseInsensitive(on bool) SyncOption {
+	return func(so *syncOptions) {
+		so.caseInsensitive = on
+	}
+}
+
+// WithPrevSnapshot use snapshot, as returned by SnapshotRemote, as the previous sync state instead of the cache file,
+// so no file is read. The snapshot public key applies to it as well.
+func WithPrevSnapshot(snapshot []byte) SyncOption {
+	return func(so *syncOptions) {
+		so.prevSnapshot = snapshot
+	}
+}
+
+// WithUnreadableDirs report the local directories which couldn't be read to skipped, e.g. for lack of permission, as the walk
+// finds them. Whether the option is set or not, their subtrees are left out of the diff on both sides and the diff is returned
+// with LocalReadErrors listing them.
+func WithUnreadableDirs(skipped func(path string, err error)) SyncOption {
+	return func(so *syncOptions) {
+		so.onUnreadableDir = skipped
+	}
+}
+
+// WithLongPaths report the local paths longer than maxLocalPathLength to skipped, with an error matching ErrLocalPathTooLong.
+// They are left out of the diff on both sides like the unreadable directories, with their subtrees, and the walk goes on.
+func WithLongPaths(skipped func(path string, err error)) SyncOption {
+	return func(so *syncOptions) {
+		so.onLongPath = skipped
+	}
+}
+
+// WithHiddenFiles turn on/off including the local hidden files and directories, whose name starts with a dot, e.g. .git.
+// They are included by default. Left out, the hidden directories are not walked. Like the local filters, it doesn't apply to the remote files.
+func WithHiddenFiles(include bool) SyncOption {
+	return func(so *syncOptions) {
+		so.skipHidden = !include
+	}
+}
+
+// WithSoftDeadline stop the sync gracefully once deadline is passed: no new listing or operation is started, the running one
+// completes and ErrSoftDeadline is returned. ApplyDiff returns it with the results so far, so the next run resumes with
+// a new diff. GetAllocationDiff returns no partial plan, what isn't listed yet would be planned as deleted.
+func WithSoftDeadline(deadline time.Time) SyncOption {
+	return func(so *syncOptions) {
+		so.softDeadline = deadline
+	}
+}
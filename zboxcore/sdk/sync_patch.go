@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/sys"
+)
+
+// SyncPatchVersion version of the SyncPatch schema written by EncodeSyncPatch
+const SyncPatchVersion = 1
+
+// SyncPatch is a sync plan in a standalone format, so it can be planned by the SDK and applied by another process.
+//
+//	{
+//	  "version": 1,
+//	  "operations": [
+//	    {"operation": "Upload", "path": "/a.txt", "type": "f", "size": 3, "hash": "<sha256 hex>"},
+//	    {"operation": "Delete", "path": "/old", "type": "d"}
+//	  ]
+//	}
+//
+// Size and hash describe the local file to transfer and are only set for Upload, Update and Link.
+type SyncPatch struct {
+	Version    int           `json:"version"`
+	Operations []SyncPatchOp `json:"operations"`
+}
+
+// SyncPatchOp one operation of a SyncPatch
+type SyncPatchOp struct {
+	Op     string `json:"operation"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+	LinkTo string `json:"link_to,omitempty"`
+	// Members files grouped by a Pack
+	Members []string `json:"members,omitempty"`
+	// OldPath path a Rename or LocalRename moves the file from
+	OldPath string `json:"old_path,omitempty"`
+}
+
+// NewSyncPatch builds the patch of the plan, the files to transfer are read from localRootPath to fill their size and hash
+func NewSyncPatch(diffs []FileDiff, localRootPath string) (*SyncPatch, error) {
+	patch := &SyncPatch{Version: SyncPatchVersion, Operations: make([]SyncPatchOp, 0, len(diffs))}
+	for _, d := range diffs {
+		op := SyncPatchOp{Op: d.Op, Path: d.Path, Type: d.Type, LinkTo: d.LinkTo, Members: d.Members, OldPath: d.OldPath}
+		if d.Op == Upload || d.Op == Update || d.Op == Link {
+			lPath := filepath.Join(localRootPath, filepath.FromSlash(d.Path))
+			fInfo, err := sys.Files.Stat(lPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "error reading "+d.Path)
+			}
+			op.Size = fInfo.Size()
+			if op.Hash, err = calcFileHash(lPath); err != nil {
+				return nil, errors.Wrap(err, "error hashing "+d.Path)
+			}
+		}
+		patch.Operations = append(patch.Operations, op)
+	}
+	return patch, nil
+}
+
+// Diffs returns the plan of the patch
+func (p *SyncPatch) Diffs() []FileDiff {
+	diffs := make([]FileDiff, 0, len(p.Operations))
+	for _, op := range p.Operations {
+		diffs = append(diffs, FileDiff{Op: op.Op, Path: op.Path, Type: op.Type, LinkTo: op.LinkTo, Members: op.Members, OldPath: op.OldPath})
+	}
+	return diffs
+}
+
+// EncodeSyncPatch writes the patch as JSON to w
+func EncodeSyncPatch(w io.Writer, patch *SyncPatch) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(patch); err != nil {
+		return errors.Wrap(err, "failed to convert JSON.")
+	}
+	return nil
+}
+
+// ParseSyncPatch reads a patch written by EncodeSyncPatch, rejecting unknown versions and operations
+func ParseSyncPatch(r io.Reader) (*SyncPatch, error) {
+	var patch SyncPatch
+	if err := json.NewDecoder(r).Decode(&patch); err != nil {
+		return nil, errors.Wrap(err, "invalid patch content.")
+	}
+	if patch.Version != SyncPatchVersion {
+		return nil, errors.Newf("invalid_sync_patch", "unsupported patch version %v", patch.Version)
+	}
+	for _, op := range patch.Operations {
+		switch op.Op {
+		case Upload, Download, Update, Delete, Conflict, LocalDelete, Link, Chmod, Pack, CreateDir, LocalCreateDir:
+		case Rename, LocalRename:
+			if op.OldPath == "" {
+				return nil, errors.Newf("invalid_sync_patch", "missing old path for %v %v", op.Op, op.Path)
+			}
+		default:
+			return nil, errors.Newf("invalid_sync_patch", "unknown operation %v for %v", op.Op, op.Path)
+		}
+		if op.Path == "" {
+			return nil, errors.Newf("invalid_sync_patch", "missing path for %v", op.Op)
+		}
+	}
+	return &patch, nil
+}
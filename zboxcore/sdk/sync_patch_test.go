@@ -0,0 +1,48 @@
+package sdk
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncPatchRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "abc", "dir/b.txt": "b"})
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/dir/b.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/old", Type: fileref.DIRECTORY},
+		{Op: Download, Path: "/remote.txt", Type: fileref.FILE},
+	}
+
+	patch, err := NewSyncPatch(diffs, root)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), patch.Operations[0].Size)
+	require.Equal(t, mustFileHash(t, filepath.Join(root, "a.txt")), patch.Operations[0].Hash)
+	require.Empty(t, patch.Operations[2].Hash)
+
+	var buf bytes.Buffer
+	require.NoError(t, EncodeSyncPatch(&buf, patch))
+	parsed, err := ParseSyncPatch(&buf)
+	require.NoError(t, err)
+	require.Equal(t, patch, parsed)
+	require.Equal(t, diffs, parsed.Diffs())
+}
+
+func TestParseSyncPatchInvalid(t *testing.T) {
+	_, err := ParseSyncPatch(strings.NewReader(`{"version": 2, "operations": []}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported patch version")
+
+	_, err = ParseSyncPatch(strings.NewReader(`{"version": 1, "operations": [{"operation": "Move", "path": "/a"}]}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown operation")
+
+	_, err = ParseSyncPatch(strings.NewReader(`{"version": 1`))
+	require.Error(t, err)
+}
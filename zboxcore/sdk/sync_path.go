@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package sdk
+
+// maxLocalPathLength longest path the local filesystem calls accept
+const maxLocalPathLength = 4096
+
+// localLongPath returns the path to pass to the filesystem calls
+func localLongPath(p string) string {
+	return p
+}
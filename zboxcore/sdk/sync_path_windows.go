@@ -0,0 +1,20 @@
+package sdk
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxLocalPathLength longest path the local filesystem calls accept with the long path prefix
+const maxLocalPathLength = 32767
+
+// localLongPath returns the path to pass to the filesystem calls, absolute paths longer than MAX_PATH get the \\?\ prefix
+func localLongPath(p string) string {
+	if len(p) < 260 || strings.HasPrefix(p, `\\?\`) || !filepath.IsAbs(p) {
+		return p
+	}
+	if strings.HasPrefix(p, `\\`) {
+		return `\\?\UNC\` + p[2:]
+	}
+	return `\\?\` + filepath.Clean(p)
+}
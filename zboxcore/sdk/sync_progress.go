@@ -0,0 +1,44 @@
+package sdk
+
+// SyncProgressStage the walk a SyncProgress is about
+type SyncProgressStage int
+
+const (
+	// ProgressRemoteList the remote tree is being listed, one directory at a time
+	ProgressRemoteList SyncProgressStage = iota
+	// ProgressLocalWalk the local tree is being walked and its files hashed
+	ProgressLocalWalk
+)
+
+// SyncProgress progress of a remote listing or local walk. The total isn't known until the walk ends,
+// so only the count processed so far is reported: listed directories for the remote, visited files and directories locally.
+type SyncProgress struct {
+	Stage       SyncProgressStage
+	CurrentPath string
+	Processed   int
+}
+
+// progressLister reports every directory listed successfully to progress
+type progressLister struct {
+	lister   remoteLister
+	progress func(SyncProgress)
+	listed   int
+}
+
+func (pl *progressLister) ListDir(dir string) (*ListResult, error) {
+	ref, err := pl.lister.ListDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pl.listed++
+	pl.progress(SyncProgress{Stage: ProgressRemoteList, CurrentPath: dir, Processed: pl.listed})
+	return ref, nil
+}
+
+// withProgress wraps lister to report to progress, if set
+func withProgress(lister remoteLister, progress func(SyncProgress)) remoteLister {
+	if progress == nil {
+		return lister
+	}
+	return &progressLister{lister: lister, progress: progress}
+}
@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncProgress(t *testing.T) {
+	t.Run("remote listing", func(t *testing.T) {
+		lister := newFakeRemoteLister(map[string]string{"/a.txt": "a", "/dir/b.txt": "b", "/dir/sub/c.txt": "c"})
+		lister.fails["/dir/sub"] = -1
+		var reports []SyncProgress
+		_, err := saveRemoteSnapshot(lister, filepath.Join(t.TempDir(), "snapshot.json"), RemoteSnapshotOptions{
+			BestEffort: true,
+			Progress:   func(p SyncProgress) { reports = append(reports, p) },
+		})
+		require.NoError(t, err)
+		// the failed directory isn't reported
+		require.Equal(t, []SyncProgress{
+			{Stage: ProgressRemoteList, CurrentPath: "/", Processed: 1},
+			{Stage: ProgressRemoteList, CurrentPath: "/dir", Processed: 2},
+		}, reports)
+	})
+
+	t.Run("local walk", func(t *testing.T) {
+		root := t.TempDir()
+		writeSyncTestFiles(t, root, map[string]string{"a.txt": "a", "dir/b.txt": "b", "skip.tmp": "x"})
+		var reports []SyncProgress
+		lMap, err := getLocalFileMap(root, []string{"skip.tmp"}, nil, newSyncOptions([]SyncOption{
+			WithProgress(func(p SyncProgress) { reports = append(reports, p) }),
+		}))
+		require.NoError(t, err)
+		require.Len(t, lMap, 4)
+		// filtered entries aren't counted
+		require.Equal(t, []SyncProgress{
+			{Stage: ProgressLocalWalk, CurrentPath: "/.", Processed: 1},
+			{Stage: ProgressLocalWalk, CurrentPath: "/a.txt", Processed: 2},
+			{Stage: ProgressLocalWalk, CurrentPath: "/dir", Processed: 3},
+			{Stage: ProgressLocalWalk, CurrentPath: "/dir/b.txt", Processed: 4},
+		}, reports)
+	})
+}
+
+func TestRemoteSnapshotProgressOption(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a", "/dir/b.txt": "b"})
+	var reports []SyncProgress
+	opts := newRemoteSnapshotOptions([]string{"/dir"}, []SyncOption{
+		WithProgress(func(p SyncProgress) { reports = append(reports, p) }),
+	})
+	_, _, err := snapshotRemote(lister, opts)
+	require.NoError(t, err)
+	require.Equal(t, []SyncProgress{{Stage: ProgressRemoteList, CurrentPath: "/", Processed: 1}}, reports)
+
+	// without WithProgress nothing is reported
+	_, _, err = snapshotRemote(lister, newRemoteSnapshotOptions(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+}
@@ -0,0 +1,83 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/0chain/gosdk/core/sys"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// RefreshDiff - Checks again each operation of a plan against the current local and remote state, right before applying it.
+// The operations already satisfied, e.g. a Download of a file which now matches locally, are returned apart from the ones still to apply.
+// An operation whose state can't be read is kept.
+func (a *Allocation) RefreshDiff(diffs []FileDiff, localRootPath string, opts ...SyncOption) (pending []FileDiff, dropped []FileDiff, err error) {
+	return refreshDiff(a, diffs, localRootPath, newSyncOptions(opts))
+}
+
+func refreshDiff(lister remoteLister, diffs []FileDiff, localRootPath string, so *syncOptions) (pending []FileDiff, dropped []FileDiff, err error) {
+	listings := make(map[string]map[string]*ListResult)
+	remoteEntry := func(remotePath string) (*ListResult, error) {
+		dir := path.Dir(remotePath)
+		children, ok := listings[dir]
+		if !ok {
+			ref, err := lister.ListDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			children = make(map[string]*ListResult)
+			for _, child := range ref.Children {
+				children[normalizePath(child.Path)] = child
+			}
+			listings[dir] = children
+		}
+		return children[remotePath], nil
+	}
+
+	for _, d := range diffs {
+		satisfied, err := isDiffSatisfied(d, localRootPath, remoteEntry, so)
+		if err != nil {
+			l.Logger.Error("Refreshing operation failed, keeping it", d.Op, d.Path, err)
+		}
+		if satisfied {
+			dropped = append(dropped, d)
+		} else {
+			pending = append(pending, d)
+		}
+	}
+	return pending, dropped, nil
+}
+
+// isDiffSatisfied checks if the outcome of the operation is already there
+func isDiffSatisfied(d FileDiff, localRootPath string, remoteEntry func(string) (*ListResult, error), so *syncOptions) (bool, error) {
+	lAbsPath := filepath.Join(localRootPath, filepath.FromSlash(d.Path))
+	switch d.Op {
+	case Upload, Update, Link, Download:
+		remote, err := remoteEntry(d.Path)
+		if err != nil || remote == nil {
+			return false, err
+		}
+		localHash, err := so.hashFile(lAbsPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return localHash == remote.Hash, nil
+	case Delete:
+		remote, err := remoteEntry(d.Path)
+		if err != nil {
+			return false, err
+		}
+		return remote == nil, nil
+	case LocalDelete:
+		_, err := sys.Files.Stat(lAbsPath)
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
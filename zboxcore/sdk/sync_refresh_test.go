@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshDiff(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"down.txt":    "old local",
+		"up.txt":      "new local",
+		"pending.txt": "still different",
+		"gone.txt":    "to delete",
+	})
+	plan := []FileDiff{
+		{Op: Download, Path: "/down.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/up.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/pending.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/removed.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/present.txt", Type: fileref.FILE},
+		{Op: LocalDelete, Path: "/gone.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/missing/new.txt", Type: fileref.FILE},
+	}
+
+	// Between planning and applying, the local file got the remote content,
+	// the remote one got the local content and a file got deleted on both sides
+	writeSyncTestFiles(t, root, map[string]string{"down.txt": "remote content"})
+	require.NoError(t, os.Remove(filepath.Join(root, "gone.txt")))
+	lister := newFakeRemoteLister(map[string]string{
+		"/down.txt":    mustFileHash(t, filepath.Join(root, "down.txt")),
+		"/up.txt":      mustFileHash(t, filepath.Join(root, "up.txt")),
+		"/pending.txt": "remote hash",
+		"/present.txt": "present",
+	})
+
+	pending, dropped, err := refreshDiff(lister, plan, root, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{plan[2], plan[4], plan[6]}, pending)
+	require.Equal(t, []FileDiff{plan[0], plan[1], plan[3], plan[5]}, dropped)
+	require.Equal(t, 1, lister.calls["/"])
+}
@@ -0,0 +1,129 @@
+package sdk
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncToRemoteOptions options of SyncToRemote
+type SyncToRemoteOptions struct {
+	// LocalRoot local root path of the diff, the files to upload are read from it
+	LocalRoot string
+	// MaxConcurrent operations run at the same time, 1 if not set
+	MaxConcurrent int
+	// FailFast start no new operation once one failed, the ones running are waited for
+	FailFast bool
+	// Progress called after each operation, one call at a time, failed ones included
+	Progress func(DiffResult)
+	// SoftDeadline once passed, no new operation is started and the running ones are waited for.
+	// ErrSoftDeadline is then returned, unless operations failed.
+	SoftDeadline time.Time
+}
+
+// DiffError an operation of SyncToRemote which failed
+type DiffError struct {
+	Diff FileDiff
+	Err  error
+}
+
+// DiffErrors the operations of SyncToRemote which failed
+type DiffErrors []DiffError
+
+func (e DiffErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, de := range e {
+		msgs = append(msgs, de.Diff.Op+" "+de.Diff.Path+": "+de.Err.Error())
+	}
+	return "sync_to_remote_failed: " + strings.Join(msgs, "; ")
+}
+
+// SyncToRemote - Applies the sync plan to the allocation like ApplyDiff, with up to opts.MaxConcurrent operations at a time.
+// The deletes run once all the other operations are done, so a path is never deleted while another operation still uses it.
+// A failed operation doesn't stop the others unless opts.FailFast is set. The failures are returned together as DiffErrors.
+// Stopped at opts.SoftDeadline, the operations which ran are the ones reported to opts.Progress.
+func (a *Allocation) SyncToRemote(diffs []FileDiff, opts SyncToRemoteOptions) error {
+	return syncToRemote(diffs, opts, func(d FileDiff, action string) error {
+		return a.applyDiff(d, action, opts.LocalRoot)
+	})
+}
+
+// softDeadlinePassed tells if the soft deadline is set and passed, no new operation is then started
+func softDeadlinePassed(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+func syncToRemote(diffs []FileDiff, opts SyncToRemoteOptions, apply func(d FileDiff, action string) error) error {
+	var ops, deletes []DiffResult
+	for _, d := range expandPacks(diffs) {
+		action, err := diffAction(d)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case ActionSkip:
+		case ActionDelete, ActionLocalDelete:
+			deletes = append(deletes, newDiffResult(d, action, opts.LocalRoot))
+		default:
+			ops = append(ops, newDiffResult(d, action, opts.LocalRoot))
+		}
+	}
+
+	workers := opts.MaxConcurrent
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu       sync.Mutex
+		failed   DiffErrors
+		stopped  bool
+		deadline bool
+	)
+	run := func(results []DiffResult) {
+		sem := make(chan struct{}, workers)
+		wg := &sync.WaitGroup{}
+		for _, result := range results {
+			sem <- struct{}{}
+			mu.Lock()
+			if !stopped && softDeadlinePassed(opts.SoftDeadline) {
+				stopped, deadline = true, true
+			}
+			stop := stopped
+			mu.Unlock()
+			if stop {
+				<-sem
+				break
+			}
+			wg.Add(1)
+			go func(result DiffResult) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				err := apply(result.Diff, result.Action)
+				result.Applied = err == nil
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					failed = append(failed, DiffError{Diff: result.Diff, Err: err})
+					stopped = opts.FailFast
+				}
+				if opts.Progress != nil {
+					opts.Progress(result)
+				}
+			}(result)
+		}
+		wg.Wait()
+	}
+	run(ops)
+	run(deletes)
+
+	if len(failed) > 0 {
+		return failed
+	}
+	if deadline {
+		return ErrSoftDeadline
+	}
+	return nil
+}
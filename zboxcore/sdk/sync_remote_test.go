@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncToRemote(t *testing.T) {
+	diffs := []FileDiff{
+		{Op: Delete, Path: "/old.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/b.txt", Type: fileref.FILE},
+		{Op: Conflict, Path: "/both.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/dir", Type: fileref.DIRECTORY},
+		{Op: Upload, Path: "/d.txt", Type: fileref.FILE},
+	}
+
+	var running, maxRunning int32
+	var mu sync.Mutex
+	var order []string
+	apply := func(d FileDiff, action string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		order = append(order, action+" "+d.Path)
+		mu.Unlock()
+		if d.Path == "/b.txt" {
+			return errors.New("upload failed")
+		}
+		return nil
+	}
+
+	var progress []DiffResult
+	err := syncToRemote(diffs, SyncToRemoteOptions{MaxConcurrent: 2, Progress: func(r DiffResult) {
+		progress = append(progress, r)
+	}}, apply)
+	require.Error(t, err)
+	var failed DiffErrors
+	require.True(t, errors.As(err, &failed))
+	require.Len(t, failed, 1)
+	require.Equal(t, "/b.txt", failed[0].Diff.Path)
+
+	// the failed update doesn't stop its siblings, the deletes run last, the conflict is skipped
+	require.Len(t, order, 6)
+	require.ElementsMatch(t, []string{"delete /old.txt", "delete /dir"}, order[4:])
+	require.EqualValues(t, 2, maxRunning)
+	require.Len(t, progress, 6)
+	for _, r := range progress {
+		require.Equal(t, r.Diff.Path != "/b.txt", r.Applied, r.Diff.Path)
+	}
+
+	// fail fast starts nothing after the failure
+	order = nil
+	err = syncToRemote(diffs, SyncToRemoteOptions{FailFast: true}, apply)
+	require.Error(t, err)
+	require.Equal(t, []string{"upload /a.txt", "update /b.txt"}, order)
+
+	order = nil
+	require.NoError(t, syncToRemote(diffs[1:2], SyncToRemoteOptions{}, apply))
+	require.Equal(t, []string{"upload /a.txt"}, order)
+}
+
+func TestSyncToRemoteSoftDeadline(t *testing.T) {
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/b.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/old.txt", Type: fileref.FILE},
+	}
+	var applied []string
+	apply := func(d FileDiff, action string) error {
+		time.Sleep(50 * time.Millisecond)
+		applied = append(applied, d.Path)
+		return nil
+	}
+
+	// the deadline passes while /b.txt is uploaded, which completes
+	var progress []DiffResult
+	err := syncToRemote(diffs, SyncToRemoteOptions{
+		SoftDeadline: time.Now().Add(75 * time.Millisecond),
+		Progress:     func(r DiffResult) { progress = append(progress, r) },
+	}, apply)
+	require.Equal(t, ErrSoftDeadline, err)
+	require.Equal(t, []string{"/a.txt", "/b.txt"}, applied)
+	require.Len(t, progress, 2)
+	for _, r := range progress {
+		require.True(t, r.Applied)
+	}
+
+	applied = nil
+	require.NoError(t, syncToRemote(diffs, SyncToRemoteOptions{SoftDeadline: time.Now().Add(time.Minute)}, apply))
+	require.Len(t, applied, len(diffs))
+}
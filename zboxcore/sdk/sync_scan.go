@@ -0,0 +1,177 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/sys"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const defaultScanCheckpointInterval = 100
+
+// RemoteScanOptions configures RemoteScan
+type RemoteScanOptions struct {
+	// ExcludePath remote paths skipped with their subtrees
+	ExcludePath []string
+	// Retries number of extra ListDir attempts for a directory before the scan fails
+	Retries int
+	// CheckpointPath file keeping the pending directories and the entries found so far.
+	// If it exists when the scan starts, the scan is resumed from it. It is removed once the scan completes.
+	CheckpointPath string
+	// CheckpointInterval number of listed directories between checkpoints. The checkpoint is always written when the scan stops early.
+	CheckpointInterval int
+	// Progress is called after each listed directory
+	Progress func(status RemoteScanStatus)
+	// BreakerThreshold number of consecutive ListDir failures after which a blobber is not queried
+	// for the rest of the scan, the scan goes on as long as the other blobbers reach consensus. 0 disables it.
+	BreakerThreshold int
+	// SoftDeadline once reached, the scan stops after the directory being listed, saves the checkpoint
+	// and returns the partial result with DeadlineReached set instead of an error.
+	SoftDeadline time.Time
+}
+
+// RemoteScanStatus progress of a running RemoteScan
+type RemoteScanStatus struct {
+	CurrentPath string
+	ListedDirs  int
+	PendingDirs int
+	Entries     int
+}
+
+// ScanResult result of a RemoteScan
+type ScanResult struct {
+	Files      map[string]RemoteFileInfo
+	ListedDirs int
+	// Resumed is true if the scan continued from a checkpoint
+	Resumed bool
+	// DeadlineReached is true if the scan stopped at SoftDeadline, Files is then partial
+	// and PendingDirs are listed by the next call with the same CheckpointPath.
+	DeadlineReached bool
+	PendingDirs     int
+	// UnavailableBlobbers base urls of the blobbers skipped by the breaker
+	UnavailableBlobbers []string
+}
+
+type remoteScanState struct {
+	Frontier   []string            `json:"frontier"`
+	Files      map[string]fileInfo `json:"files"`
+	ListedDirs int                 `json:"listed_dirs"`
+}
+
+// RemoteScan walks the whole remote allocation breadth first with ListDir.
+// The frontier of directories still to list is a queue consumed one directory at a time,
+// so it can be checkpointed at any point and a scan interrupted by a failure or by ctx is resumed
+// by calling RemoteScan again with the same CheckpointPath.
+func (a *Allocation) RemoteScan(ctx context.Context, opts RemoteScanOptions) (*ScanResult, error) {
+	if opts.BreakerThreshold <= 0 {
+		return remoteScan(ctx, a, opts)
+	}
+	breaker := newBlobberBreaker(opts.BreakerThreshold)
+	result, err := remoteScan(ctx, &breakerLister{allocation: a, breaker: breaker}, opts)
+	if tripped := breaker.trippedBlobbers(); len(tripped) > 0 {
+		l.Logger.Error("Blobbers unavailable during remote scan", tripped)
+		if result != nil {
+			result.UnavailableBlobbers = tripped
+		}
+	}
+	return result, err
+}
+
+func remoteScan(ctx context.Context, lister remoteLister, opts RemoteScanOptions) (*ScanResult, error) {
+	state := &remoteScanState{Frontier: []string{"/"}, Files: make(map[string]fileInfo)}
+	result := &ScanResult{}
+	if opts.CheckpointPath != "" {
+		if _, err := sys.Files.Stat(opts.CheckpointPath); err == nil {
+			if err := readSnapshotFile(opts.CheckpointPath, state); err != nil {
+				return nil, errors.Wrap(err, "invalid scan checkpoint.")
+			}
+			result.Resumed = true
+		}
+	}
+	interval := opts.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultScanCheckpointInterval
+	}
+
+	saveCheckpoint := func() {
+		if opts.CheckpointPath == "" {
+			return
+		}
+		if err := writeSnapshotFile(opts.CheckpointPath, state); err != nil {
+			l.Logger.Error("Saving remote scan checkpoint failed", err)
+		}
+	}
+
+	matcher := remoteMatcher(getRemoteExcludeMap(opts.ExcludePath))
+	for len(state.Frontier) > 0 {
+		if err := ctx.Err(); err != nil {
+			saveCheckpoint()
+			return nil, err
+		}
+		if !opts.SoftDeadline.IsZero() && time.Now().After(opts.SoftDeadline) {
+			saveCheckpoint()
+			result.Files = remoteFileInfoMap(state.Files)
+			result.ListedDirs = state.ListedDirs
+			result.PendingDirs = len(state.Frontier)
+			result.DeadlineReached = true
+			return result, nil
+		}
+
+		dir := state.Frontier[0]
+		ref, err := listDirWithRetry(lister, dir, opts.Retries)
+		if err != nil {
+			saveCheckpoint()
+			return nil, errors.Wrap(err, "error listing "+dir)
+		}
+		for _, child := range ref.Children {
+			childPath := normalizePath(child.Path)
+			if skip, _ := matcher.Matches(childPath, listResultInfo{child}); skip {
+				continue
+			}
+			state.Files[childPath] = newRemoteFileInfo(child)
+			if child.Type == fileref.DIRECTORY {
+				state.Frontier = append(state.Frontier, childPath)
+			}
+		}
+		state.Frontier = state.Frontier[1:]
+		state.ListedDirs++
+
+		if state.ListedDirs%interval == 0 {
+			saveCheckpoint()
+		}
+		if opts.Progress != nil {
+			opts.Progress(RemoteScanStatus{
+				CurrentPath: dir,
+				ListedDirs:  state.ListedDirs,
+				PendingDirs: len(state.Frontier),
+				Entries:     len(state.Files),
+			})
+		}
+	}
+
+	if opts.CheckpointPath != "" {
+		if err := os.Remove(opts.CheckpointPath); err != nil && !os.IsNotExist(err) {
+			l.Logger.Error("Removing remote scan checkpoint failed", err)
+		}
+	}
+	result.Files = remoteFileInfoMap(state.Files)
+	result.ListedDirs = state.ListedDirs
+	return result, nil
+}
+
+func listDirWithRetry(lister remoteLister, dir string, retries int) (*ListResult, error) {
+	var err error
+	for i := 0; i <= retries; i++ {
+		var ref *ListResult
+		ref, err = lister.ListDir(dir)
+		if err == nil {
+			return ref, nil
+		}
+		l.Logger.Error("Listing remote dir failed", dir, "attempt", i+1, err)
+	}
+	return nil, err
+}
@@ -0,0 +1,105 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var scanTestFiles = map[string]string{
+	"/a.txt":       "a",
+	"/docs/b.txt":  "b",
+	"/docs/x/c.md": "c",
+	"/img/d.png":   "d",
+}
+
+func TestRemoteScanProgress(t *testing.T) {
+	lister := newFakeRemoteLister(scanTestFiles)
+
+	var statuses []RemoteScanStatus
+	result, err := remoteScan(context.Background(), lister, RemoteScanOptions{
+		Progress: func(status RemoteScanStatus) { statuses = append(statuses, status) },
+	})
+	require.NoError(t, err)
+	require.False(t, result.Resumed)
+	require.Equal(t, 4, result.ListedDirs)
+	require.Len(t, result.Files, 7)
+
+	require.Len(t, statuses, 4)
+	require.Equal(t, "/", statuses[0].CurrentPath)
+	require.Equal(t, 2, statuses[0].PendingDirs)
+	last := statuses[len(statuses)-1]
+	require.Equal(t, 4, last.ListedDirs)
+	require.Equal(t, 0, last.PendingDirs)
+	require.Equal(t, 7, last.Entries)
+}
+
+func TestRemoteScanResumeAfterFailure(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "scan.json")
+	lister := newFakeRemoteLister(scanTestFiles)
+	lister.fails["/img"] = 2
+
+	_, err := remoteScan(context.Background(), lister, RemoteScanOptions{
+		CheckpointPath: checkpoint,
+		Retries:        1,
+	})
+	require.Error(t, err)
+	require.Equal(t, 2, lister.calls["/img"])
+	require.FileExists(t, checkpoint)
+
+	result, err := remoteScan(context.Background(), lister, RemoteScanOptions{CheckpointPath: checkpoint})
+	require.NoError(t, err)
+	require.True(t, result.Resumed)
+	require.Len(t, result.Files, 7)
+	// Directories listed before the failure are not listed again
+	require.Equal(t, 1, lister.calls["/"])
+	require.Equal(t, 1, lister.calls["/docs"])
+	_, err = os.Stat(checkpoint)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRemoteScanCancelled(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "scan.json")
+	lister := newFakeRemoteLister(scanTestFiles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := remoteScan(ctx, lister, RemoteScanOptions{
+		CheckpointPath: checkpoint,
+		Progress:       func(status RemoteScanStatus) { cancel() },
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	result, err := remoteScan(context.Background(), lister, RemoteScanOptions{CheckpointPath: checkpoint})
+	require.NoError(t, err)
+	require.True(t, result.Resumed)
+	require.Len(t, result.Files, 7)
+	require.Equal(t, 1, lister.calls["/"])
+}
+
+func TestRemoteScanSoftDeadline(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "scan.json")
+	lister := newFakeRemoteLister(scanTestFiles)
+
+	result, err := remoteScan(context.Background(), lister, RemoteScanOptions{
+		CheckpointPath: checkpoint,
+		SoftDeadline:   time.Now().Add(10 * time.Millisecond),
+		// the first directory is still in flight when the deadline passes
+		Progress: func(status RemoteScanStatus) { time.Sleep(20 * time.Millisecond) },
+	})
+	require.NoError(t, err)
+	require.True(t, result.DeadlineReached)
+	require.Equal(t, 1, result.ListedDirs)
+	require.Equal(t, 2, result.PendingDirs)
+	require.Len(t, result.Files, 3)
+
+	result, err = remoteScan(context.Background(), lister, RemoteScanOptions{CheckpointPath: checkpoint})
+	require.NoError(t, err)
+	require.True(t, result.Resumed)
+	require.False(t, result.DeadlineReached)
+	require.Len(t, result.Files, 7)
+	require.Equal(t, 1, lister.calls["/"])
+}
@@ -0,0 +1,546 @@
+package sdk
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/sys"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// SnapshotDelta is an incremental change on top of a remote snapshot.
+// Updated holds the entries added or modified since the previous state and Removed the paths that are gone.
+type SnapshotDelta struct {
+	Updated map[string]SnapshotEntry `json:"updated"`
+	Removed []string                 `json:"removed"`
+}
+
+// SnapshotEntry a file or directory of a remote snapshot, encoded as SaveRemoteSnapshot saves it
+type SnapshotEntry struct {
+	Size         int64     `json:"size"`
+	ActualSize   int64     `json:"actual_size"`
+	Hash         string    `json:"hash"`
+	Type         string    `json:"type"`
+	EncryptedKey string    `json:"encrypted_key"`
+	LookupHash   string    `json:"lookup_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	LinkTo       string    `json:"link_to,omitempty"`
+	// Mode permission bits, 0 when unknown
+	Mode os.FileMode `json:"mode,omitempty"`
+	// Shared the remote file has collaborators
+	Shared bool `json:"shared,omitempty"`
+}
+
+func newSnapshotEntry(info fileInfo) SnapshotEntry {
+	return SnapshotEntry{
+		Size:         info.Size,
+		ActualSize:   info.ActualSize,
+		Hash:         info.Hash,
+		Type:         info.Type,
+		EncryptedKey: info.EncryptedKey,
+		LookupHash:   info.LookupHash,
+		CreatedAt:    info.CreatedAt,
+		UpdatedAt:    info.UpdatedAt,
+		LinkTo:       info.LinkTo,
+		Mode:         info.Mode,
+		Shared:       info.Shared,
+	}
+}
+
+func (e SnapshotEntry) fileInfo() fileInfo {
+	return fileInfo{
+		Size:         e.Size,
+		ActualSize:   e.ActualSize,
+		Hash:         e.Hash,
+		Type:         e.Type,
+		EncryptedKey: e.EncryptedKey,
+		LookupHash:   e.LookupHash,
+		CreatedAt:    e.CreatedAt,
+		UpdatedAt:    e.UpdatedAt,
+		LinkTo:       e.LinkTo,
+		Mode:         e.Mode,
+		Shared:       e.Shared,
+	}
+}
+
+// sameSnapshotEntry the entries are equal, their times compared as instants
+func sameSnapshotEntry(a, b SnapshotEntry) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) || !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return false
+	}
+	a.CreatedAt, a.UpdatedAt = b.CreatedAt, b.UpdatedAt
+	return a == b
+}
+
+func readSnapshotFile(snapshotPath string, v interface{}) error {
+	content, err := ioutil.ReadFile(snapshotPath)
+	if err != nil {
+		return errors.Wrap(err, ErrReadCache)
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return errors.Wrap(err, ErrInvalidCacheFile)
+	}
+	return nil
+}
+
+func writeSnapshotFile(pathToSave string, v interface{}) error {
+	by, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert JSON.")
+	}
+	return writeFileAtomic(pathToSave, by)
+}
+
+// writeSnapshotData writes the content of a snapshot file, replaced by tests to fail the write
+var writeSnapshotData = func(w io.Writer, data []byte) error {
+	_, err := w.Write(data)
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of pathToSave and renames it over pathToSave,
+// so the previous file is left intact if the write fails or the process crashes before the rename.
+func writeFileAtomic(pathToSave string, data []byte) error {
+	fp, err := ioutil.TempFile(filepath.Dir(pathToSave), filepath.Base(pathToSave)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error saving file.")
+	}
+	tmpPath := fp.Name()
+	err = writeSnapshotData(fp, data)
+	if err == nil {
+		err = fp.Sync()
+	}
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, pathToSave)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "error saving file.")
+	}
+	return nil
+}
+
+// applySnapshotDelta applies delta on snapshot in place, rejecting changes that don't fit the current state.
+func applySnapshotDelta(snapshot map[string]fileInfo, delta SnapshotDelta) error {
+	for _, p := range delta.Removed {
+		if _, ok := snapshot[p]; !ok {
+			return errors.Newf("invalid_snapshot_delta", "removed path %v is not in the snapshot", p)
+		}
+		delete(snapshot, p)
+	}
+	for p, info := range delta.Updated {
+		parent := path.Dir(p)
+		if parent != "/" {
+			parentInfo, ok := snapshot[parent]
+			if !ok {
+				var parentEntry SnapshotEntry
+				parentEntry, ok = delta.Updated[parent]
+				parentInfo = parentEntry.fileInfo()
+			}
+			if !ok || parentInfo.Type != fileref.DIRECTORY {
+				return errors.Newf("invalid_snapshot_delta", "parent directory of %v is not in the snapshot", p)
+			}
+		}
+		snapshot[p] = info.fileInfo()
+	}
+	return nil
+}
+
+// CompactSnapshot merges the base snapshot and the deltas, in the given order, into a single snapshot saved to pathToSave.
+// Every delta is validated against the state built so far, so an inconsistent delta log fails instead of producing a corrupted snapshot.
+func CompactSnapshot(basePath string, deltaPaths []string, pathToSave string) error {
+	snapshot := make(map[string]fileInfo)
+	if err := readSnapshotFile(basePath, &snapshot); err != nil {
+		return err
+	}
+	for _, deltaPath := range deltaPaths {
+		var delta SnapshotDelta
+		if err := readSnapshotFile(deltaPath, &delta); err != nil {
+			return err
+		}
+		if err := applySnapshotDelta(snapshot, delta); err != nil {
+			return errors.Wrap(err, "error applying "+deltaPath)
+		}
+	}
+	return writeSnapshotFile(pathToSave, snapshot)
+}
+
+// ComputeSnapshotDelta - Computes the delta which brings the snapshot at oldSnapshotPath to the one at newSnapshotPath,
+// both saved by SaveRemoteSnapshot, so CompactSnapshot of the old snapshot and the delta gives the new one.
+// Signatures are not verified.
+func ComputeSnapshotDelta(oldSnapshotPath, newSnapshotPath string) (SnapshotDelta, error) {
+	oldMap, err := loadRemoteSnapshot(oldSnapshotPath, nil)
+	if err != nil {
+		return SnapshotDelta{}, err
+	}
+	newMap, err := loadRemoteSnapshot(newSnapshotPath, nil)
+	if err != nil {
+		return SnapshotDelta{}, err
+	}
+
+	delta := SnapshotDelta{Updated: make(map[string]SnapshotEntry)}
+	for p := range oldMap {
+		if _, ok := newMap[p]; !ok {
+			delta.Removed = append(delta.Removed, p)
+		}
+	}
+	sort.Strings(delta.Removed)
+	for p, info := range newMap {
+		entry := newSnapshotEntry(info)
+		if oldInfo, ok := oldMap[p]; !ok || !sameSnapshotEntry(newSnapshotEntry(oldInfo), entry) {
+			delta.Updated[p] = entry
+		}
+	}
+	return delta, nil
+}
+
+// RemoteSnapshotOptions configures SaveRemoteSnapshotWithOptions
+type RemoteSnapshotOptions struct {
+	// ExcludePath remote paths left out with their subtrees
+	ExcludePath []string
+	// Retries number of extra ListDir attempts for a directory before it is considered failed, as in RemoteScanOptions
+	Retries int
+	// BestEffort save the directories that did list when some keep failing, instead of failing the whole snapshot.
+	// The snapshot is then marked partial in its metadata.
+	BestEffort bool
+	// SigningKey sign the snapshot with it, so it can be verified by LoadRemoteSnapshot or WithSnapshotPublicKey
+	SigningKey ed25519.PrivateKey
+	// Progress is called after each listed directory
+	Progress func(SyncProgress)
+}
+
+// RemoteSnapshotMeta metadata saved next to a remote snapshot
+type RemoteSnapshotMeta struct {
+	// Partial is true if some directories couldn't be listed
+	Partial bool `json:"partial"`
+	// FailedDirs remote directories which couldn't be listed, their subtrees are missing from the snapshot
+	FailedDirs []string `json:"failed_dirs,omitempty"`
+}
+
+func snapshotMetaPath(snapshotPath string) string {
+	return snapshotPath + ".meta"
+}
+
+// ReadRemoteSnapshotMeta reads the metadata of the snapshot saved to snapshotPath. A snapshot without metadata is complete.
+func ReadRemoteSnapshotMeta(snapshotPath string) (*RemoteSnapshotMeta, error) {
+	meta := &RemoteSnapshotMeta{}
+	if _, err := sys.Files.Stat(snapshotMetaPath(snapshotPath)); err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	if err := readSnapshotFile(snapshotMetaPath(snapshotPath), meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SaveRemoteSnapshotWithOptions - Saves the remote current information to the given file like SaveRemoteSnapshot,
+// retrying the directories which fail to list. With BestEffort, the directories still failing are left out and
+// recorded with the partial flag in the metadata file saved next to the snapshot, which is returned.
+func (a *Allocation) SaveRemoteSnapshotWithOptions(pathToSave string, opts RemoteSnapshotOptions) (*RemoteSnapshotMeta, error) {
+	return saveRemoteSnapshot(a, pathToSave, opts)
+}
+
+func saveRemoteSnapshot(lister remoteLister, pathToSave string, opts RemoteSnapshotOptions) (*RemoteSnapshotMeta, error) {
+	// Validate path
+	fileInfo, err := sys.Files.Stat(pathToSave)
+	if err == nil && fileInfo.IsDir() {
+		return nil, errors.New("", "invalid file path to save.")
+	}
+
+	by, meta, err := snapshotRemote(lister, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(pathToSave, by); err != nil {
+		return nil, err
+	}
+	if meta.Partial {
+		if err = writeSnapshotFile(snapshotMetaPath(pathToSave), meta); err != nil {
+			return nil, err
+		}
+	} else if err = os.Remove(snapshotMetaPath(pathToSave)); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error deleting previous snapshot metadata.")
+	}
+	return meta, nil
+}
+
+// SnapshotRemote - Gets the remote current information SaveRemoteSnapshot saves, without writing any file.
+// It can be passed to GetAllocationDiff with WithPrevSnapshot, e.g. where no disk is writable.
+// Of the sync options, only WithProgress applies like for SaveRemoteSnapshot.
+func (a *Allocation) SnapshotRemote(remoteExcludePath []string, opts ...SyncOption) ([]byte, error) {
+	by, _, err := snapshotRemote(a, newRemoteSnapshotOptions(remoteExcludePath, opts))
+	return by, err
+}
+
+// newRemoteSnapshotOptions keeps the sync options a remote snapshot uses
+func newRemoteSnapshotOptions(remoteExcludePath []string, opts []SyncOption) RemoteSnapshotOptions {
+	so := newSyncOptions(opts)
+	return RemoteSnapshotOptions{ExcludePath: remoteExcludePath, Progress: so.progress}
+}
+
+// snapshotRemote lists the remote tree and encodes it, the metadata tells if the listing is partial
+func snapshotRemote(lister remoteLister, opts RemoteSnapshotOptions) ([]byte, *RemoteSnapshotMeta, error) {
+	// Get flat file list from remote
+	exclMap := getRemoteExcludeMap(opts.ExcludePath)
+	remoteFileList, failedDirs, err := getRemoteFileMapWithRetry(withProgress(lister, opts.Progress), exclMap, opts.Retries, opts.BestEffort)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, ErrRemoteList)
+	}
+
+	meta := &RemoteSnapshotMeta{Partial: len(failedDirs) > 0, FailedDirs: failedDirs}
+	if meta.Partial {
+		l.Logger.Error("Remote snapshot is partial, directories failed to list", failedDirs)
+	}
+	by, err := encodeRemoteSnapshot(remoteFileList, opts.SigningKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return by, meta, nil
+}
+
+// UpdateRemoteSnapshot - Updates the snapshot saved to prevPath with the remote paths changed since, e.g. the paths of the plan
+// applied after it was saved, instead of listing the whole allocation again. Only the directories holding the changed paths
+// are listed, and the subtrees of the changed directories. Without previous snapshot, the whole allocation is listed.
+// The snapshot is saved back unsigned and without excludes, see UpdateRemoteSnapshotWithOptions otherwise.
+func (a *Allocation) UpdateRemoteSnapshot(prevPath string, changedPaths []string) error {
+	return updateRemoteSnapshot(a, prevPath, changedPaths, RemoteSnapshotOptions{})
+}
+
+// UpdateRemoteSnapshotWithOptions - Updates the snapshot like UpdateRemoteSnapshot, with the options it was saved with by
+// SaveRemoteSnapshotWithOptions: the ExcludePath paths stay out of it, and with SigningKey the previous snapshot must be signed
+// by it and the updated one is signed again. Retries and BestEffort only apply when the whole allocation is listed.
+func (a *Allocation) UpdateRemoteSnapshotWithOptions(prevPath string, changedPaths []string, opts RemoteSnapshotOptions) error {
+	return updateRemoteSnapshot(a, prevPath, changedPaths, opts)
+}
+
+func updateRemoteSnapshot(lister remoteLister, prevPath string, changedPaths []string, opts RemoteSnapshotOptions) error {
+	if _, err := sys.Files.Stat(prevPath); os.IsNotExist(err) {
+		_, err = saveRemoteSnapshot(lister, prevPath, opts)
+		return err
+	}
+	var publicKey ed25519.PublicKey
+	if opts.SigningKey != nil {
+		publicKey = opts.SigningKey.Public().(ed25519.PublicKey)
+	}
+	snapshot, err := loadRemoteSnapshot(prevPath, publicKey)
+	if err != nil {
+		return err
+	}
+	lister = withProgress(lister, opts.Progress)
+	exclMap := getRemoteExcludeMap(opts.ExcludePath)
+	matcher := remoteMatcher(exclMap)
+
+	dirSet := make(map[string]bool)
+	changed := make([]string, 0, len(changedPaths))
+	for _, p := range changedPaths {
+		p = path.Clean("/" + p)
+		if p == "/" {
+			_, err = saveRemoteSnapshot(lister, prevPath, opts)
+			return err
+		}
+		changed = append(changed, p)
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			dirSet[dir] = true
+			if dir == "/" {
+				break
+			}
+		}
+	}
+	dirs := make([]string, 0, len(dirSet))
+	for dir := range dirSet {
+		dirs = append(dirs, dir)
+	}
+	// a parent is a prefix of its children so it is listed first
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if dir != "/" && snapshot[dir].Type != fileref.DIRECTORY {
+			// gone with its parent
+			continue
+		}
+		ref, err := lister.ListDir(dir)
+		if err != nil {
+			return errors.Wrap(err, ErrRemoteList)
+		}
+		children := make(map[string]fileInfo, len(ref.Children))
+		for _, child := range ref.Children {
+			childPath := normalizePath(child.Path)
+			if skip, _ := matcher.Matches(childPath, listResultInfo{child}); skip {
+				continue
+			}
+			children[childPath] = newRemoteFileInfo(child)
+		}
+		for p := range snapshot {
+			if _, ok := children[p]; !ok && path.Dir(p) == dir {
+				removeSnapshotTree(snapshot, p)
+			}
+		}
+		for p, info := range children {
+			snapshot[p] = info
+		}
+	}
+
+	for _, p := range changed {
+		removeSnapshotSubtree(snapshot, p)
+		if snapshot[p].Type != fileref.DIRECTORY {
+			continue
+		}
+		for subDirs := []string{p}; len(subDirs) > 0; {
+			if subDirs, err = getRemoteFilesAndDirs(lister, subDirs, snapshot, exclMap); err != nil {
+				return errors.Wrap(err, ErrRemoteList)
+			}
+		}
+	}
+	by, err := encodeRemoteSnapshot(snapshot, opts.SigningKey)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(prevPath, by)
+}
+
+// removeSnapshotTree removes the entry of p and of its subtree from snapshot
+func removeSnapshotTree(snapshot map[string]fileInfo, p string) {
+	delete(snapshot, p)
+	removeSnapshotSubtree(snapshot, p)
+}
+
+// removeSnapshotSubtree removes the entries under the directory p from snapshot
+func removeSnapshotSubtree(snapshot map[string]fileInfo, p string) {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for sp := range snapshot {
+		if strings.HasPrefix(sp, prefix) {
+			delete(snapshot, sp)
+		}
+	}
+}
+
+// getRemoteFileMapWithRetry walks the remote tree like getRemoteFileMap, listing each directory up to retries more times.
+// With bestEffort, a directory still failing is skipped with its subtree and returned, other than the root which can't be skipped.
+func getRemoteFileMapWithRetry(lister remoteLister, exclMap map[string]int, retries int, bestEffort bool) (map[string]fileInfo, []string, error) {
+	remoteList := make(map[string]fileInfo)
+	var failedDirs []string
+	matcher := remoteMatcher(exclMap)
+	dirs := []string{"/"}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		ref, err := listDirWithRetry(lister, dir, retries)
+		if err != nil {
+			if !bestEffort || dir == "/" {
+				return nil, nil, err
+			}
+			failedDirs = append(failedDirs, dir)
+			continue
+		}
+		for _, child := range ref.Children {
+			childPath := normalizePath(child.Path)
+			if skip, _ := matcher.Matches(childPath, listResultInfo{child}); skip {
+				continue
+			}
+			remoteList[childPath] = newRemoteFileInfo(child)
+			if child.Type == fileref.DIRECTORY {
+				dirs = append(dirs, childPath)
+			}
+		}
+	}
+	sort.Strings(failedDirs)
+	return remoteList, failedDirs, nil
+}
+
+var (
+	// ErrSnapshotUnsigned a snapshot without signature is loaded with a public key to verify
+	ErrSnapshotUnsigned = errors.New("snapshot_unsigned", "snapshot is not signed")
+	// ErrSnapshotSignature the signature of a snapshot doesn't match its content
+	ErrSnapshotSignature = errors.New("invalid_snapshot_signature", "snapshot signature verification failed")
+)
+
+// signedSnapshot the content of a signed snapshot file, the signature is over the exact bytes of Files
+type signedSnapshot struct {
+	Files     json.RawMessage `json:"files"`
+	Signature string          `json:"signature"`
+}
+
+// encodeRemoteSnapshot serializes the snapshot, signed with signingKey if it is set
+func encodeRemoteSnapshot(fMap map[string]fileInfo, signingKey ed25519.PrivateKey) ([]byte, error) {
+	by, err := json.Marshal(fMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert JSON.")
+	}
+	if signingKey == nil {
+		return by, nil
+	}
+	by, err = json.Marshal(signedSnapshot{Files: by, Signature: hex.EncodeToString(ed25519.Sign(signingKey, by))})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert JSON.")
+	}
+	return by, nil
+}
+
+// decodeRemoteSnapshot reads a snapshot, signed or not. With publicKey, only a snapshot signed by its private key is accepted.
+// A signed snapshot is told apart by its keys, which are not remote paths starting with "/".
+func decodeRemoteSnapshot(content []byte, publicKey ed25519.PublicKey) (map[string]fileInfo, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(content, &top); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidCacheFile)
+	}
+	files := content
+	if _, ok := top["signature"]; ok {
+		var signed signedSnapshot
+		if err := json.Unmarshal(content, &signed); err != nil {
+			return nil, errors.Wrap(err, ErrInvalidCacheFile)
+		}
+		if publicKey != nil {
+			sig, err := hex.DecodeString(signed.Signature)
+			if err != nil || !ed25519.Verify(publicKey, signed.Files, sig) {
+				return nil, ErrSnapshotSignature
+			}
+		}
+		files = signed.Files
+	} else if publicKey != nil {
+		return nil, ErrSnapshotUnsigned
+	}
+
+	fMap := make(map[string]fileInfo)
+	if err := json.Unmarshal(files, &fMap); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidCacheFile)
+	}
+	return fMap, nil
+}
+
+// LoadRemoteSnapshot reads the snapshot saved to snapshotPath. With publicKey, the snapshot must be signed
+// by its private key: an unsigned snapshot fails with ErrSnapshotUnsigned and an altered one with ErrSnapshotSignature.
+func LoadRemoteSnapshot(snapshotPath string, publicKey ed25519.PublicKey) (map[string]RemoteFileInfo, error) {
+	fMap, err := loadRemoteSnapshot(snapshotPath, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return remoteFileInfoMap(fMap), nil
+}
+
+func loadRemoteSnapshot(snapshotPath string, publicKey ed25519.PublicKey) (map[string]fileInfo, error) {
+	content, err := ioutil.ReadFile(snapshotPath)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrReadCache)
+	}
+	return decodeRemoteSnapshot(content, publicKey)
+}
@@ -0,0 +1,200 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+const (
+	// SnapshotAdded the path is only in the new snapshot
+	SnapshotAdded = "added"
+	// SnapshotRemoved the path is only in the old snapshot
+	SnapshotRemoved = "removed"
+	// SnapshotModified the path is in both snapshots with another type or content
+	SnapshotModified = "modified"
+)
+
+// SnapshotChange a path which differs between two remote snapshots
+type SnapshotChange struct {
+	Kind string
+	Path string
+	Old  RemoteFileInfo
+	New  RemoteFileInfo
+}
+
+func snapshotEntryModified(oldInfo, newInfo RemoteFileInfo) bool {
+	return oldInfo.Type != newInfo.Type || oldInfo.Hash != newInfo.Hash
+}
+
+// diffSnapshotMaps compares two snapshots held in memory, the changes are sorted by path
+func diffSnapshotMaps(oldMap, newMap map[string]fileInfo) []SnapshotChange {
+	var changes []SnapshotChange
+	for p, oldFile := range oldMap {
+		oldInfo := newRemoteFileInfoEntry(p, oldFile)
+		newFile, ok := newMap[p]
+		newInfo := newRemoteFileInfoEntry(p, newFile)
+		if !ok {
+			changes = append(changes, SnapshotChange{Kind: SnapshotRemoved, Path: p, Old: oldInfo})
+		} else if snapshotEntryModified(oldInfo, newInfo) {
+			changes = append(changes, SnapshotChange{Kind: SnapshotModified, Path: p, Old: oldInfo, New: newInfo})
+		}
+	}
+	for p, newFile := range newMap {
+		if _, ok := oldMap[p]; !ok {
+			changes = append(changes, SnapshotChange{Kind: SnapshotAdded, Path: p, New: newRemoteFileInfoEntry(p, newFile)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// DiffSnapshots - Compares two snapshots saved by SaveRemoteSnapshot, e.g. of yesterday and today, offline.
+// The plan brings a copy of the old remote tree up to the new one: a file added since is a Download, a file or
+// directory removed a Delete and a file changed an Update. A path changing type is a Delete of the old entry followed by
+// the Download of the new file. Directories are created with the files downloaded into them. Signatures are not verified.
+// The operations are returned in path order.
+func DiffSnapshots(oldSnapshotPath, newSnapshotPath string) ([]FileDiff, error) {
+	oldMap, err := loadRemoteSnapshot(oldSnapshotPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	newMap, err := loadRemoteSnapshot(newSnapshotPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FileDiff
+	for _, c := range diffSnapshotMaps(oldMap, newMap) {
+		switch {
+		case c.Kind == SnapshotModified && c.Old.Type == c.New.Type:
+			if c.New.Type == fileref.FILE {
+				diffs = append(diffs, FileDiff{Op: Update, Path: c.Path, Type: fileref.FILE})
+			}
+			continue
+		case c.Kind == SnapshotRemoved || c.Kind == SnapshotModified:
+			diffs = append(diffs, FileDiff{Op: Delete, Path: c.Path, Type: c.Old.Type})
+		}
+		if c.Kind != SnapshotRemoved && c.New.Type == fileref.FILE {
+			diffs = append(diffs, FileDiff{Op: Download, Path: c.Path, Type: fileref.FILE})
+		}
+	}
+	return diffs, nil
+}
+
+// MergeDiffSnapshots compares two snapshots streamed in path order, e.g. by StreamSnapshotFile, holding a single entry of each
+// at a time. emit gets the changes in path order. A stream out of order fails the comparison, the streams should then be cancelled.
+func MergeDiffSnapshots(oldEntries, newEntries <-chan RemoteFileEntry, emit func(SnapshotChange)) error {
+	next := func(entries <-chan RemoteFileEntry, prev *RemoteFileEntry) (*RemoteFileEntry, error) {
+		entry, ok := <-entries
+		if !ok {
+			return nil, nil
+		}
+		if prev != nil && entry.Path <= prev.Path {
+			return nil, errors.Newf("unsorted_snapshot", "snapshot entry %v comes after %v", entry.Path, prev.Path)
+		}
+		return &entry, nil
+	}
+
+	oldEntry, err := next(oldEntries, nil)
+	if err != nil {
+		return err
+	}
+	newEntry, err := next(newEntries, nil)
+	if err != nil {
+		return err
+	}
+	for oldEntry != nil || newEntry != nil {
+		switch {
+		case newEntry == nil || (oldEntry != nil && oldEntry.Path < newEntry.Path):
+			emit(SnapshotChange{Kind: SnapshotRemoved, Path: oldEntry.Path, Old: oldEntry.Info})
+			if oldEntry, err = next(oldEntries, oldEntry); err != nil {
+				return err
+			}
+		case oldEntry == nil || newEntry.Path < oldEntry.Path:
+			emit(SnapshotChange{Kind: SnapshotAdded, Path: newEntry.Path, New: newEntry.Info})
+			if newEntry, err = next(newEntries, newEntry); err != nil {
+				return err
+			}
+		default:
+			if snapshotEntryModified(oldEntry.Info, newEntry.Info) {
+				emit(SnapshotChange{Kind: SnapshotModified, Path: oldEntry.Path, Old: oldEntry.Info, New: newEntry.Info})
+			}
+			if oldEntry, err = next(oldEntries, oldEntry); err != nil {
+				return err
+			}
+			if newEntry, err = next(newEntries, newEntry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StreamSnapshotFile decodes the snapshot saved by SaveRemoteSnapshot one entry at a time. Its entries are saved sorted by path,
+// so they are sent in path order. The signature of a signed snapshot is not verified. The entries channel is closed at the end
+// of the file, the error channel then gets the error that stopped the decoding, if any, and is closed.
+func StreamSnapshotFile(ctx context.Context, snapshotPath string) (<-chan RemoteFileEntry, <-chan error) {
+	entries := make(chan RemoteFileEntry)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(entries)
+		fp, err := os.Open(snapshotPath)
+		if err != nil {
+			errCh <- errors.Wrap(err, ErrReadCache)
+			return
+		}
+		defer fp.Close()
+
+		if err = streamSnapshotObject(ctx, json.NewDecoder(fp), entries); err != nil {
+			errCh <- err
+		}
+	}()
+	return entries, errCh
+}
+
+// streamSnapshotObject sends the entries of the snapshot object starting at the next token of dec.
+// The entries of a signed snapshot are the ones of its files object.
+func streamSnapshotObject(ctx context.Context, dec *json.Decoder, entries chan<- RemoteFileEntry) error {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return ErrInvalidCacheFile
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return errors.Wrap(err, ErrInvalidCacheFile)
+		}
+		key, _ := tok.(string)
+		if !strings.HasPrefix(key, "/") {
+			if key == "files" {
+				if err = streamSnapshotObject(ctx, dec, entries); err != nil {
+					return err
+				}
+			} else if err = dec.Decode(new(json.RawMessage)); err != nil {
+				return errors.Wrap(err, ErrInvalidCacheFile)
+			}
+			continue
+		}
+		var info fileInfo
+		if err = dec.Decode(&info); err != nil {
+			return errors.Wrap(err, ErrInvalidCacheFile)
+		}
+		entry := RemoteFileEntry{Path: key, Info: newRemoteFileInfoEntry(key, info)}
+		select {
+		case entries <- entry:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	// closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return errors.Wrap(err, ErrInvalidCacheFile)
+	}
+	return nil
+}
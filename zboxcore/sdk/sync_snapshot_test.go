@@ -0,0 +1,496 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSnapshotTestFile(t *testing.T, dir, name string, v interface{}) string {
+	p := filepath.Join(dir, name)
+	require.NoError(t, writeSnapshotFile(p, v))
+	return p
+}
+
+func TestCompactSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	base := writeSnapshotTestFile(t, dir, "base.json", map[string]fileInfo{
+		"/docs":       {Type: fileref.DIRECTORY},
+		"/docs/a.txt": {Type: fileref.FILE, Hash: "a1", Size: 1},
+		"/b.txt":      {Type: fileref.FILE, Hash: "b1", Size: 2},
+	})
+	deltas := []string{
+		writeSnapshotTestFile(t, dir, "delta1.json", SnapshotDelta{
+			Updated: map[string]SnapshotEntry{"/docs/a.txt": {Type: fileref.FILE, Hash: "a2", Size: 3}},
+		}),
+		writeSnapshotTestFile(t, dir, "delta2.json", SnapshotDelta{
+			Updated: map[string]SnapshotEntry{
+				"/img":       {Type: fileref.DIRECTORY},
+				"/img/c.png": {Type: fileref.FILE, Hash: "c1", Size: 4},
+			},
+			Removed: []string{"/b.txt"},
+		}),
+	}
+
+	compacted := filepath.Join(dir, "compacted.json")
+	require.NoError(t, CompactSnapshot(base, deltas, compacted))
+
+	full := map[string]fileInfo{
+		"/docs":       {Type: fileref.DIRECTORY},
+		"/docs/a.txt": {Type: fileref.FILE, Hash: "a2", Size: 3},
+		"/img":        {Type: fileref.DIRECTORY},
+		"/img/c.png":  {Type: fileref.FILE, Hash: "c1", Size: 4},
+	}
+	want, err := json.Marshal(full)
+	require.NoError(t, err)
+	got, err := os.ReadFile(compacted)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(got))
+}
+
+func TestCompactSnapshotInconsistentDelta(t *testing.T) {
+	dir := t.TempDir()
+
+	base := writeSnapshotTestFile(t, dir, "base.json", map[string]fileInfo{
+		"/b.txt": {Type: fileref.FILE, Hash: "b1"},
+	})
+	removeMissing := writeSnapshotTestFile(t, dir, "remove.json", SnapshotDelta{Removed: []string{"/missing.txt"}})
+	orphan := writeSnapshotTestFile(t, dir, "orphan.json", SnapshotDelta{
+		Updated: map[string]SnapshotEntry{"/nodir/c.txt": {Type: fileref.FILE, Hash: "c1"}},
+	})
+
+	require.Error(t, CompactSnapshot(base, []string{removeMissing}, filepath.Join(dir, "out1.json")))
+	require.Error(t, CompactSnapshot(base, []string{orphan}, filepath.Join(dir, "out2.json")))
+}
+
+func TestComputeSnapshotDelta(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	snapshots := []map[string]fileInfo{
+		{
+			"/docs":       {Type: fileref.DIRECTORY},
+			"/docs/a.txt": {Type: fileref.FILE, Hash: "a1", Size: 1, CreatedAt: created},
+			"/b.txt":      {Type: fileref.FILE, Hash: "b1", Size: 2},
+			"/x":          {Type: fileref.DIRECTORY},
+			"/x/y.txt":    {Type: fileref.FILE, Hash: "y1"},
+		},
+		{
+			// a2 content, b.txt only shared, the x directory replaced by a file
+			"/docs":       {Type: fileref.DIRECTORY},
+			"/docs/a.txt": {Type: fileref.FILE, Hash: "a2", Size: 3, CreatedAt: created},
+			"/b.txt":      {Type: fileref.FILE, Hash: "b1", Size: 2, Shared: true},
+			"/x":          {Type: fileref.FILE, Hash: "x1"},
+		},
+		{
+			"/docs/a.txt": {Type: fileref.FILE, Hash: "a2", Size: 3, CreatedAt: created},
+			"/docs":       {Type: fileref.DIRECTORY},
+			"/img":        {Type: fileref.DIRECTORY},
+			"/img/c.png":  {Type: fileref.FILE, Hash: "c1", Size: 4},
+		},
+	}
+	var paths []string
+	for i, snapshot := range snapshots {
+		paths = append(paths, writeSnapshotTestFile(t, dir, fmt.Sprintf("snapshot%v.json", i), snapshot))
+	}
+
+	delta, err := ComputeSnapshotDelta(paths[0], paths[1])
+	require.NoError(t, err)
+	require.Equal(t, []string{"/x/y.txt"}, delta.Removed)
+	require.Len(t, delta.Updated, 3)
+	require.Equal(t, "a2", delta.Updated["/docs/a.txt"].Hash)
+	require.True(t, delta.Updated["/b.txt"].Shared)
+	require.Equal(t, fileref.FILE, delta.Updated["/x"].Type)
+
+	// compacting the first snapshot with the deltas gives the last one
+	var deltaPaths []string
+	for i := 1; i < len(paths); i++ {
+		delta, err := ComputeSnapshotDelta(paths[i-1], paths[i])
+		require.NoError(t, err)
+		deltaPaths = append(deltaPaths, writeSnapshotTestFile(t, dir, fmt.Sprintf("delta%v.json", i), delta))
+	}
+	compacted := filepath.Join(dir, "compacted.json")
+	require.NoError(t, CompactSnapshot(paths[0], deltaPaths, compacted))
+	want, err := os.ReadFile(paths[len(paths)-1])
+	require.NoError(t, err)
+	got, err := os.ReadFile(compacted)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(got))
+
+	delta, err = ComputeSnapshotDelta(paths[2], paths[2])
+	require.NoError(t, err)
+	require.Empty(t, delta.Removed)
+	require.Empty(t, delta.Updated)
+
+	_, err = ComputeSnapshotDelta(filepath.Join(dir, "missing.json"), paths[0])
+	require.Error(t, err)
+}
+
+func TestSaveRemoteSnapshotPartial(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	lister := newFakeRemoteLister(map[string]string{
+		"/a.txt":         "a",
+		"/good/b.txt":    "b",
+		"/bad/c.txt":     "c",
+		"/bad/sub/d.txt": "d",
+		"/flaky/e.txt":   "e",
+	})
+	lister.fails["/bad"] = -1
+	lister.fails["/flaky"] = 1
+
+	_, err := saveRemoteSnapshot(lister, snapshotPath, RemoteSnapshotOptions{Retries: 1})
+	require.Error(t, err)
+
+	meta, err := saveRemoteSnapshot(lister, snapshotPath, RemoteSnapshotOptions{Retries: 1, BestEffort: true})
+	require.NoError(t, err)
+	require.Equal(t, &RemoteSnapshotMeta{Partial: true, FailedDirs: []string{"/bad"}}, meta)
+
+	snapshot := make(map[string]fileInfo)
+	require.NoError(t, readSnapshotFile(snapshotPath, &snapshot))
+	require.Contains(t, snapshot, "/good/b.txt")
+	require.Contains(t, snapshot, "/flaky/e.txt")
+	require.Contains(t, snapshot, "/bad")
+	require.NotContains(t, snapshot, "/bad/c.txt")
+	require.NotContains(t, snapshot, "/bad/sub/d.txt")
+
+	saved, err := ReadRemoteSnapshotMeta(snapshotPath)
+	require.NoError(t, err)
+	require.Equal(t, meta, saved)
+
+	// a complete snapshot drops the stale metadata
+	lister.fails["/bad"] = 0
+	meta, err = saveRemoteSnapshot(lister, snapshotPath, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+	require.False(t, meta.Partial)
+	saved, err = ReadRemoteSnapshotMeta(snapshotPath)
+	require.NoError(t, err)
+	require.False(t, saved.Partial)
+}
+
+func TestSaveRemoteSnapshotAtomic(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a"})
+	_, err := saveRemoteSnapshot(lister, snapshotPath, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+	original, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+
+	defer func(write func(io.Writer, []byte) error) { writeSnapshotData = write }(writeSnapshotData)
+	writeSnapshotData = func(w io.Writer, data []byte) error {
+		// the write fails halfway
+		if _, err := w.Write(data[:len(data)/2]); err != nil {
+			return err
+		}
+		return errors.New("disk full")
+	}
+	lister = newFakeRemoteLister(map[string]string{"/a.txt": "a", "/b.txt": "b"})
+	_, err = saveRemoteSnapshot(lister, snapshotPath, RemoteSnapshotOptions{})
+	require.Error(t, err)
+
+	content, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	require.Equal(t, original, content)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "the temporary file is removed")
+}
+
+func TestUpdateRemoteSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	files := map[string]string{
+		"/a.txt":           "a",
+		"/docs/b.txt":      "b",
+		"/docs/old/c.txt":  "c",
+		"/other/d.txt":     "d",
+		"/other/sub/e.txt": "e",
+	}
+	// without previous snapshot, the whole allocation is listed
+	require.NoError(t, updateRemoteSnapshot(newFakeRemoteLister(files), snapshotPath, []string{"/a.txt"}, RemoteSnapshotOptions{}))
+
+	delete(files, "/docs/old/c.txt")
+	files["/docs/b.txt"] = "b changed"
+	files["/docs/new/f.txt"] = "f"
+	files["/docs/new/deep/g.txt"] = "g"
+	lister := newFakeRemoteLister(files)
+	require.NoError(t, updateRemoteSnapshot(lister, snapshotPath, []string{"/docs/b.txt", "/docs/old/c.txt", "/docs/new"}, RemoteSnapshotOptions{}))
+	require.Equal(t, map[string]int{"/": 1, "/docs": 1, "/docs/new": 1, "/docs/new/deep": 1}, lister.calls)
+
+	updated, err := LoadRemoteSnapshot(snapshotPath, nil)
+	require.NoError(t, err)
+	fullPath := filepath.Join(dir, "full.json")
+	_, err = saveRemoteSnapshot(newFakeRemoteLister(files), fullPath, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+	expected, err := LoadRemoteSnapshot(fullPath, nil)
+	require.NoError(t, err)
+	require.Equal(t, expected, updated)
+
+	lister.fails["/docs"] = -1
+	require.Error(t, updateRemoteSnapshot(lister, snapshotPath, []string{"/docs/b.txt"}, RemoteSnapshotOptions{}))
+}
+
+func TestUpdateRemoteSnapshotOptions(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	opts := RemoteSnapshotOptions{ExcludePath: []string{"/docs/private", "*.tmp"}, SigningKey: privateKey}
+	files := map[string]string{
+		"/a.txt":                "a",
+		"/docs/b.txt":           "b",
+		"/docs/private/key.txt": "key",
+		"/docs/c.tmp":           "c",
+	}
+	_, err = saveRemoteSnapshot(newFakeRemoteLister(files), snapshotPath, opts)
+	require.NoError(t, err)
+
+	files["/docs/b.txt"] = "b changed"
+	files["/docs/private/new.txt"] = "new"
+	files["/docs/d.tmp"] = "d"
+	files["/docs/e.txt"] = "e"
+	require.NoError(t, updateRemoteSnapshot(newFakeRemoteLister(files), snapshotPath,
+		[]string{"/docs/b.txt", "/docs/private/new.txt", "/docs/d.tmp", "/docs/e.txt"}, opts))
+
+	// the updated snapshot is still signed and keeps the excluded paths out, like a full one
+	updated, err := LoadRemoteSnapshot(snapshotPath, publicKey)
+	require.NoError(t, err)
+	fullPath := filepath.Join(dir, "full.json")
+	_, err = saveRemoteSnapshot(newFakeRemoteLister(files), fullPath, opts)
+	require.NoError(t, err)
+	expected, err := LoadRemoteSnapshot(fullPath, publicKey)
+	require.NoError(t, err)
+	require.Equal(t, expected, updated)
+	require.NotContains(t, updated, "/docs/private")
+	require.NotContains(t, updated, "/docs/d.tmp")
+
+	// a snapshot signed by another key is not updated
+	_, otherKey, err := ed25519.GenerateKey(rand.New(rand.NewSource(2)))
+	require.NoError(t, err)
+	err = updateRemoteSnapshot(newFakeRemoteLister(files), snapshotPath, []string{"/a.txt"}, RemoteSnapshotOptions{SigningKey: otherKey})
+	require.Equal(t, ErrSnapshotSignature, err)
+}
+
+func TestSnapshotNormalizedPaths(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	files := map[string]string{"/docs//a.txt": "a", "/docs/./b.txt": "b"}
+	live, err := getRemoteFileMap(newFakeRemoteLister(files), nil)
+	require.NoError(t, err)
+	require.Contains(t, live, "/docs/a.txt")
+	hashes := func(fMap map[string]RemoteFileInfo) map[string]string {
+		h := make(map[string]string, len(fMap))
+		for p, info := range fMap {
+			h[p] = info.Hash
+		}
+		return h
+	}
+
+	// the saved, updated and scanned listings key the paths like the live one
+	_, err = saveRemoteSnapshot(newFakeRemoteLister(files), snapshotPath, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+	saved, err := LoadRemoteSnapshot(snapshotPath, nil)
+	require.NoError(t, err)
+	require.Equal(t, hashes(remoteFileInfoMap(live)), hashes(saved))
+
+	require.NoError(t, updateRemoteSnapshot(newFakeRemoteLister(files), snapshotPath, []string{"/docs/a.txt"}, RemoteSnapshotOptions{}))
+	updated, err := LoadRemoteSnapshot(snapshotPath, nil)
+	require.NoError(t, err)
+	require.Equal(t, hashes(remoteFileInfoMap(live)), hashes(updated))
+
+	result, err := remoteScan(context.Background(), newFakeRemoteLister(files), RemoteScanOptions{})
+	require.NoError(t, err)
+	require.Equal(t, hashes(remoteFileInfoMap(live)), hashes(result.Files))
+
+	// nothing reads as deleted and added against the previous state
+	lMap := map[string]fileInfo{
+		"/docs":       {Type: fileref.DIRECTORY},
+		"/docs/a.txt": {Type: fileref.FILE, Hash: "a"},
+		"/docs/b.txt": {Type: fileref.FILE, Hash: "b"},
+	}
+	prevMap, err := loadRemoteSnapshot(snapshotPath, nil)
+	require.NoError(t, err)
+	require.Empty(t, findDelta(live, lMap, prevMap, ""))
+}
+
+func TestMergeDiffSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	oldMap := make(map[string]fileInfo)
+	newMap := make(map[string]fileInfo)
+	for i := 0; i < 20000; i++ {
+		p := fmt.Sprintf("/dir%d/file%d.txt", i%37, i)
+		info := fileInfo{Type: fileref.FILE, Hash: strconv.Itoa(i)}
+		switch rnd.Intn(10) {
+		case 0:
+			oldMap[p] = info
+		case 1:
+			newMap[p] = info
+		case 2:
+			oldMap[p] = info
+			newMap[p] = fileInfo{Type: fileref.FILE, Hash: "changed"}
+		default:
+			oldMap[p] = info
+			newMap[p] = info
+		}
+	}
+	oldPath := writeSnapshotTestFile(t, dir, "old.json", oldMap)
+	newPath := writeSnapshotTestFile(t, dir, "new.json", newMap)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	oldEntries, oldErrs := StreamSnapshotFile(ctx, oldPath)
+	newEntries, newErrs := StreamSnapshotFile(ctx, newPath)
+	var changes []SnapshotChange
+	require.NoError(t, MergeDiffSnapshots(oldEntries, newEntries, func(c SnapshotChange) {
+		changes = append(changes, c)
+	}))
+	require.NoError(t, <-oldErrs)
+	require.NoError(t, <-newErrs)
+
+	expected := diffSnapshotMaps(oldMap, newMap)
+	require.NotEmpty(t, expected)
+	require.Equal(t, expected, changes)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeSnapshotTestFile(t, dir, "old.json", map[string]fileInfo{
+		"/":            {Type: fileref.DIRECTORY, Hash: "root"},
+		"/same.txt":    {Type: fileref.FILE, Hash: "same"},
+		"/changed.txt": {Type: fileref.FILE, Hash: "old"},
+		"/gone":        {Type: fileref.DIRECTORY, Hash: "gone"},
+		"/gone/a.txt":  {Type: fileref.FILE, Hash: "a"},
+		"/typed":       {Type: fileref.DIRECTORY, Hash: "typed"},
+	})
+	newPath := writeSnapshotTestFile(t, dir, "new.json", map[string]fileInfo{
+		"/":            {Type: fileref.DIRECTORY, Hash: "root changed"},
+		"/same.txt":    {Type: fileref.FILE, Hash: "same"},
+		"/changed.txt": {Type: fileref.FILE, Hash: "new"},
+		"/new":         {Type: fileref.DIRECTORY, Hash: "new"},
+		"/new/b.txt":   {Type: fileref.FILE, Hash: "b"},
+		"/typed":       {Type: fileref.FILE, Hash: "typed"},
+	})
+
+	diffs, err := DiffSnapshots(oldPath, newPath)
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{
+		{Op: Update, Path: "/changed.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/gone", Type: fileref.DIRECTORY},
+		{Op: Delete, Path: "/gone/a.txt", Type: fileref.FILE},
+		{Op: Download, Path: "/new/b.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/typed", Type: fileref.DIRECTORY},
+		{Op: Download, Path: "/typed", Type: fileref.FILE},
+	}, diffs)
+
+	_, err = DiffSnapshots(oldPath, filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}
+
+func TestMergeDiffSnapshotsUnsorted(t *testing.T) {
+	stream := func(paths ...string) <-chan RemoteFileEntry {
+		entries := make(chan RemoteFileEntry, len(paths))
+		for _, p := range paths {
+			entries <- RemoteFileEntry{Path: p, Info: RemoteFileInfo{Path: p, Type: fileref.FILE}}
+		}
+		close(entries)
+		return entries
+	}
+	err := MergeDiffSnapshots(stream("/a", "/c"), stream("/b", "/a"), func(SnapshotChange) {})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsorted_snapshot")
+}
+
+func TestSignedRemoteSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	otherKey, _, err := ed25519.GenerateKey(rand.New(rand.NewSource(2)))
+	require.NoError(t, err)
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a", "/dir/b.txt": "b"})
+
+	signedPath := filepath.Join(dir, "signed.json")
+	_, err = saveRemoteSnapshot(lister, signedPath, RemoteSnapshotOptions{SigningKey: privateKey})
+	require.NoError(t, err)
+	unsignedPath := filepath.Join(dir, "unsigned.json")
+	_, err = saveRemoteSnapshot(lister, unsignedPath, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+
+	signed, err := LoadRemoteSnapshot(signedPath, publicKey)
+	require.NoError(t, err)
+	require.Equal(t, "b", signed["/dir/b.txt"].Hash)
+	unsigned, err := LoadRemoteSnapshot(unsignedPath, nil)
+	require.NoError(t, err)
+	require.Equal(t, unsigned, signed)
+	_, err = LoadRemoteSnapshot(signedPath, nil)
+	require.NoError(t, err)
+
+	_, err = LoadRemoteSnapshot(unsignedPath, publicKey)
+	require.ErrorIs(t, err, ErrSnapshotUnsigned)
+	_, err = LoadRemoteSnapshot(signedPath, otherKey)
+	require.ErrorIs(t, err, ErrSnapshotSignature)
+
+	content, err := os.ReadFile(signedPath)
+	require.NoError(t, err)
+	tampered := bytes.Replace(content, []byte(`"hash":"b"`), []byte(`"hash":"x"`), 1)
+	require.NotEqual(t, content, tampered)
+	require.NoError(t, os.WriteFile(signedPath, tampered, 0644))
+	_, err = LoadRemoteSnapshot(signedPath, publicKey)
+	require.ErrorIs(t, err, ErrSnapshotSignature)
+
+	// a signed snapshot streams the same entries
+	require.NoError(t, os.WriteFile(signedPath, content, 0644))
+	entries, errs := StreamSnapshotFile(context.Background(), signedPath)
+	streamed := make(map[string]RemoteFileInfo)
+	for entry := range entries {
+		streamed[entry.Path] = entry.Info
+	}
+	require.NoError(t, <-errs)
+	require.Equal(t, unsigned, streamed)
+}
+
+func TestInMemorySnapshot(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a", "/dir/b.txt": "b"})
+	snapshot, meta, err := snapshotRemote(lister, RemoteSnapshotOptions{})
+	require.NoError(t, err)
+	require.False(t, meta.Partial)
+
+	// /dir/b.txt is deleted remotely and /c.txt added since the snapshot
+	lister = newFakeRemoteLister(map[string]string{"/a.txt": "a", "/c.txt": "c"})
+	rMap, err := getRemoteFileMap(lister, nil)
+	require.NoError(t, err)
+
+	// the cache file path is ignored
+	prevMap, err := loadPrevSnapshot("/nonexistent/cache.json", newSyncOptions([]SyncOption{WithPrevSnapshot(snapshot)}))
+	require.NoError(t, err)
+	require.Equal(t, "b", prevMap["/dir/b.txt"].Hash)
+
+	lMap := map[string]fileInfo{
+		"/.":         {Type: fileref.DIRECTORY},
+		"/a.txt":     {Type: fileref.FILE, Hash: "a"},
+		"/dir":       {Type: fileref.DIRECTORY},
+		"/dir/b.txt": {Type: fileref.FILE, Hash: "b"},
+	}
+	diffs, err := findCheckedDelta(rMap, lMap, prevMap, "", newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/c.txt": Download, "/dir": LocalDelete}, diffOps(diffs))
+
+	_, err = loadPrevSnapshot("", newSyncOptions([]SyncOption{WithPrevSnapshot([]byte("not json"))}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrInvalidCacheFile.Error())
+}
@@ -0,0 +1,42 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// skipSymlink reports a local symlink left out of the sync
+func (so *syncOptions) skipSymlink(p string, reason string) {
+	l.Logger.Info("Skipping local symlink", p, reason)
+	if so.onSymlinkSkipped != nil {
+		so.onSymlinkSkipped(p)
+	}
+}
+
+// walkSymlinkDir walks the directory a symlink points to with walk, as if it was at the path of the link.
+// A directory already walked is skipped, which stops the walk of a symlink looping back to a parent.
+func walkSymlinkDir(linkPath, lPath string, target os.FileInfo, walkedDirs map[inodeKey]bool, so *syncOptions, walk filepath.WalkFunc) error {
+	key, ok := getInodeKey(target)
+	if !ok {
+		so.skipSymlink(lPath, "inodes not available")
+		return nil
+	}
+	if walkedDirs[key] {
+		so.skipSymlink(lPath, "directory already walked")
+		return nil
+	}
+	resolved, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		so.skipSymlink(lPath, err.Error())
+		return nil
+	}
+	return filepath.Walk(resolved, func(p string, info os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(resolved, p)
+		if relErr != nil {
+			return relErr
+		}
+		return walk(filepath.Join(linkPath, rel), info, err)
+	})
+}
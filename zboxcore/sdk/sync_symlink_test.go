@@ -0,0 +1,44 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"real/a.txt": "a", "b.txt": "b"})
+	require.NoError(t, os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "alias")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "b.txt"), filepath.Join(root, "c.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken")))
+	// a symlink to its own parent directory would be walked forever
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "real", "loop")))
+
+	var skipped []string
+	fMap, err := getLocalFileMap(root, nil, nil, newSyncOptions([]SyncOption{WithFollowSymlinks(false, func(path string) {
+		skipped = append(skipped, path)
+	})}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"/alias", "/broken", "/c.txt", "/real/loop"}, skipped)
+	require.NotContains(t, fMap, "/alias")
+	require.NotContains(t, fMap, "/c.txt")
+
+	skipped = nil
+	fMap, err = getLocalFileMap(root, nil, nil, newSyncOptions([]SyncOption{WithFollowSymlinks(true, func(path string) {
+		skipped = append(skipped, path)
+	})}))
+	require.NoError(t, err)
+	// alias is walked before real, each one reaches the loop
+	require.ElementsMatch(t, []string{"/alias/loop", "/broken", "/real/loop"}, skipped)
+	require.Equal(t, fMap["/b.txt"].Hash, fMap["/c.txt"].Hash)
+	require.Contains(t, fMap, "/alias")
+	require.Equal(t, fMap["/real/a.txt"].Hash, fMap["/alias/a.txt"].Hash)
+	require.NotContains(t, fMap, "/alias/loop")
+}
@@ -0,0 +1,1116 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/util"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemoteLister serves ListDir from an in-memory tree of remote files
+type fakeRemoteLister struct {
+	dirs  map[string][]*ListResult
+	fails map[string]int
+	calls map[string]int
+}
+
+// newFakeRemoteLister builds the remote tree from file paths mapped to their hashes, parent directories are implied
+func newFakeRemoteLister(files map[string]string) *fakeRemoteLister {
+	f := &fakeRemoteLister{
+		dirs:  map[string][]*ListResult{"/": nil},
+		fails: make(map[string]int),
+		calls: make(map[string]int),
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		f.addDir(path.Dir(p))
+		f.dirs[path.Dir(p)] = append(f.dirs[path.Dir(p)], &ListResult{
+			Name: path.Base(p), Path: p, Type: fileref.FILE, Hash: files[p], Size: int64(len(files[p])),
+		})
+	}
+	return f
+}
+
+func (f *fakeRemoteLister) addDir(dir string) {
+	if _, ok := f.dirs[dir]; ok {
+		return
+	}
+	f.addDir(path.Dir(dir))
+	f.dirs[dir] = nil
+	f.dirs[path.Dir(dir)] = append(f.dirs[path.Dir(dir)], &ListResult{Name: path.Base(dir), Path: dir, Type: fileref.DIRECTORY})
+}
+
+func (f *fakeRemoteLister) ListDir(p string) (*ListResult, error) {
+	f.calls[p]++
+	if f.fails[p] != 0 {
+		if f.fails[p] > 0 {
+			f.fails[p]--
+		}
+		return nil, errors.New("list_request_failed", "simulated failure for "+p)
+	}
+	children, ok := f.dirs[p]
+	if !ok {
+		// a file is listed as itself, like blobbers do
+		for _, child := range f.dirs[path.Dir(p)] {
+			if child.Path == p && p != "/" {
+				return child, nil
+			}
+		}
+		return nil, errors.New("invalid_path", "not found "+p)
+	}
+	return &ListResult{Path: p, Type: fileref.DIRECTORY, Children: children}, nil
+}
+
+func (f *fakeRemoteLister) totalCalls() int {
+	total := 0
+	for _, c := range f.calls {
+		total += c
+	}
+	return total
+}
+
+func writeSyncTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func mustFileHash(t *testing.T, path string) string {
+	hash, err := calcFileHash(path)
+	require.NoError(t, err)
+	return hash
+}
+
+func diffOps(diffs []FileDiff) map[string]string {
+	ops := make(map[string]string)
+	for _, d := range diffs {
+		ops[d.Path] = d.Op
+	}
+	return ops
+}
+
+func TestGetManifestDiff(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"same.txt":    "same",
+		"changed.txt": "local",
+		"dir/new.txt": "new",
+	})
+
+	manifest := map[string]string{
+		"/same.txt":    mustFileHash(t, filepath.Join(root, "same.txt")),
+		"/changed.txt": "stale-hash",
+		"/missing.txt": "remote-only",
+	}
+
+	diffs, err := GetManifestDiff(manifest, root, nil, nil, WithDiffCheck(true))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"/changed.txt": Update,
+		"/missing.txt": Download,
+		"/dir/new.txt": Upload,
+	}, diffOps(diffs))
+}
+
+func TestAddLocalFileListSkipsVanishedFile(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"gone.txt": "gone"})
+
+	path := filepath.Join(root, "gone.txt")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(path))
+
+	fMap := make(map[string]fileInfo)
+	var dirList []string
+	walkFn := addLocalFileList(context.Background(), root, fMap, &dirList, nil, nil, newSyncOptions(nil))
+	require.NoError(t, walkFn(path, info, nil))
+	require.Empty(t, fMap)
+}
+
+func TestComputeTreeHashesOrderIndependent(t *testing.T) {
+	fMap := map[string]fileInfo{
+		"/d":       {Type: fileref.DIRECTORY},
+		"/d/a.txt": {Type: fileref.FILE, Hash: "a", Size: 1},
+		"/d/b.txt": {Type: fileref.FILE, Hash: "b", Size: 2},
+	}
+	hashes := computeTreeHashes(fMap)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, hashes, computeTreeHashes(fMap))
+	}
+
+	renamed := map[string]fileInfo{
+		"/d":       {Type: fileref.DIRECTORY},
+		"/d/a.txt": {Type: fileref.FILE, Hash: "a", Size: 1},
+		"/d/c.txt": {Type: fileref.FILE, Hash: "b", Size: 2},
+	}
+	resized := map[string]fileInfo{
+		"/d":       {Type: fileref.DIRECTORY},
+		"/d/a.txt": {Type: fileref.FILE, Hash: "a", Size: 1},
+		"/d/b.txt": {Type: fileref.FILE, Hash: "b", Size: 3},
+	}
+	require.NotEqual(t, hashes["/d"], computeTreeHashes(renamed)["/d"])
+	require.NotEqual(t, hashes["/d"], computeTreeHashes(resized)["/d"])
+}
+
+func TestPruneMatchingSubtrees(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"lib/a.go":     "a",
+		"lib/sub/b.go": "b",
+		"app/main.go":  "main",
+	})
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+
+	rMap := make(map[string]fileInfo)
+	for p, info := range lMap {
+		if p != "/." {
+			rMap[p] = info
+		}
+	}
+	rMap["/app/main.go"] = fileInfo{Type: fileref.FILE, Hash: "remote", Size: 6}
+
+	pruned := pruneMatchingSubtrees(rMap, lMap)
+	require.Equal(t, []string{"/lib"}, pruned)
+	for p := range rMap {
+		require.False(t, isParentFolderPruned(pruned, p), p)
+	}
+	for p := range lMap {
+		require.False(t, isParentFolderPruned(pruned, p), p)
+	}
+
+	diffs := findDelta(rMap, lMap, make(map[string]fileInfo), root)
+	require.Equal(t, map[string]string{"/app/main.go": Update}, diffOps(diffs))
+}
+
+func TestHardlinkDetection(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "shared content"})
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")); err != nil {
+		t.Skip("hardlinks are not supported:", err)
+	}
+	info, err := os.Stat(filepath.Join(root, "a.txt"))
+	require.NoError(t, err)
+	if _, ok := getFileInodeKey(info); !ok {
+		t.Skip("inode information is not available")
+	}
+
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions([]SyncOption{WithHardlinkDetection(true)}))
+	require.NoError(t, err)
+	require.Equal(t, "/a.txt", lMap["/b.txt"].LinkTo)
+	require.Equal(t, lMap["/a.txt"].Hash, lMap["/b.txt"].Hash)
+
+	diffs := findDelta(make(map[string]fileInfo), lMap, make(map[string]fileInfo), root)
+	require.Equal(t, map[string]string{"/a.txt": Upload, "/b.txt": Link}, diffOps(diffs))
+	for _, d := range diffs {
+		if d.Op == Link {
+			require.Equal(t, "/a.txt", d.LinkTo)
+		}
+	}
+
+	lMap, err = getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Empty(t, lMap["/b.txt"].LinkTo)
+}
+
+func TestPlanReupload(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"a.txt":         "a",
+		"b.txt":         "b",
+		"docs/c.txt":    "c",
+		"docs/sub/d.md": "d",
+	})
+
+	diffs, err := PlanReupload(root, []string{"/a.txt", "docs"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"/a.txt":         Upload,
+		"/docs/c.txt":    Upload,
+		"/docs/sub/d.md": Upload,
+	}, diffOps(diffs))
+
+	diffs, err = PlanReupload(root, []string{"/b.txt", "/gone.txt"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/gone.txt")
+	require.Equal(t, map[string]string{"/b.txt": Upload}, diffOps(diffs))
+}
+
+func TestMerkleRootHash(t *testing.T) {
+	const chunkSize = 64 * 1024
+	data := make([]byte, 2*chunkSize+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.bin"), data, 0644))
+
+	// root computed chunk by chunk as on upload
+	mt := util.NewFixedMerkleTree(chunkSize)
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		require.NoError(t, mt.Write(data[i*chunkSize:end], i))
+	}
+	blobberRoot := mt.GetMerkleRoot()
+
+	localRoot, err := calcFileMerkleRoot(filepath.Join(root, "data.bin"), chunkSize)
+	require.NoError(t, err)
+	require.Equal(t, blobberRoot, localRoot)
+
+	manifest := map[string]string{"/data.bin": blobberRoot}
+	diffs, err := GetManifestDiff(manifest, root, nil, nil, WithMerkleRootHash(chunkSize))
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	diffs, err = GetManifestDiff(manifest, root, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/data.bin": Update}, diffOps(diffs))
+}
+
+func TestLimitDiff(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"a.txt": "0123456789",
+		"b.txt": "0123456789",
+		"c.txt": "0123456789",
+		"d.txt": "0123456789",
+	})
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE},
+		{Op: Delete, Path: "/old.txt", Type: fileref.FILE},
+		{Op: Update, Path: "/b.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/c.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/d.txt", Type: fileref.FILE},
+	}
+
+	batch, remaining := LimitDiff(diffs, root, DiffLimits{MaxBytes: 25})
+	require.Equal(t, diffs[:3], batch)
+	require.Equal(t, diffs[3:], remaining)
+
+	batch, remaining = LimitDiff(diffs, root, DiffLimits{MaxCount: 2})
+	require.Equal(t, diffs[:2], batch)
+	require.Equal(t, diffs[2:], remaining)
+
+	batch, remaining = LimitDiff(diffs, root, DiffLimits{MaxBytes: 5})
+	require.Equal(t, diffs[:1], batch, "an oversized first operation is still applied")
+	require.Equal(t, diffs[1:], remaining)
+
+	batch, remaining = LimitDiff(diffs, root, DiffLimits{})
+	require.Equal(t, diffs, batch)
+	require.Empty(t, remaining)
+}
+
+func TestValidateLocalRoot(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"file.txt": "file"})
+
+	require.NoError(t, validateLocalRoot(root))
+
+	_, err := GetManifestDiff(nil, filepath.Join(root, "missing"), nil, nil)
+	require.True(t, errors.Is(err, ErrLocalRootNotFound), err)
+
+	err = validateLocalRoot(filepath.Join(root, "file.txt"))
+	require.True(t, errors.Is(err, ErrLocalRootNotDir), err)
+
+	// checked before the allocation is listed
+	_, err = (&Allocation{}).GetAllocationDiff("", filepath.Join(root, "missing"), nil, nil)
+	require.True(t, errors.Is(err, ErrLocalRootNotFound), err)
+	err = (&Allocation{}).ValidateSyncRoots(filepath.Join(root, "missing"), "/docs")
+	require.True(t, errors.Is(err, ErrLocalRootNotFound), err)
+
+	remote := newFakeRemoteLister(map[string]string{"/docs/a.txt": "a"})
+	require.NoError(t, validateRemoteRoot(remote, "/docs"))
+	require.NoError(t, validateRemoteRoot(remote, "/docs/"))
+	for _, remoteRoot := range []string{"docs", "/docs/../..", ""} {
+		err = validateRemoteRoot(remote, remoteRoot)
+		require.True(t, errors.Is(err, ErrInvalidRemoteRoot), remoteRoot)
+	}
+	err = validateRemoteRoot(remote, "/missing")
+	require.True(t, errors.Is(err, ErrRemoteList), err)
+	err = validateRemoteRoot(remote, "/docs/a.txt")
+	require.True(t, errors.Is(err, ErrRemoteRootNotDir), err)
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	locked := filepath.Join(root, "locked")
+	require.NoError(t, os.Mkdir(locked, 0))
+	defer os.Chmod(locked, 0755)
+	_, err = GetManifestDiff(nil, locked, nil, nil)
+	require.True(t, errors.Is(err, ErrLocalRootUnreadable), err)
+}
+
+func TestFindModeDelta(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.sh": "run", "b.txt": "b", "c.txt": "c"})
+	require.NoError(t, os.Chmod(filepath.Join(root, "a.sh"), 0755))
+	require.NoError(t, os.Chmod(filepath.Join(root, "b.txt"), 0644))
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+
+	remote := newFakeRemoteLister(map[string]string{
+		"/a.sh":  lMap["/a.sh"].Hash,
+		"/b.txt": lMap["/b.txt"].Hash,
+		"/c.txt": lMap["/c.txt"].Hash,
+	})
+	remote.dirs["/"][0].Mode = 0644 // a.sh lost its exec bit remotely
+	remote.dirs["/"][1].Mode = 0644
+	ref, err := remote.ListDir("/")
+	require.NoError(t, err)
+	rMap := make(map[string]fileInfo)
+	for _, child := range ref.Children {
+		rMap[child.Path] = newRemoteFileInfo(child)
+	}
+
+	require.Equal(t, []FileDiff{{Op: Chmod, Path: "/a.sh", Type: fileref.FILE}}, findModeDelta(rMap, lMap))
+
+	// content differs, the Update covers it
+	rMap["/a.sh"] = fileInfo{Type: fileref.FILE, Hash: "other", Mode: 0644}
+	require.Empty(t, findModeDelta(rMap, lMap))
+
+	// a blobber listing without mode is skipped, one with mode is compared
+	for listing, want := range map[string]int{
+		`{"path":"/b.txt","type":"f"}`:            0,
+		`{"path":"/b.txt","type":"f","mode":420}`: 0,
+		`{"path":"/b.txt","type":"f","mode":256}`: 1,
+	} {
+		var child ListResult
+		require.NoError(t, json.Unmarshal([]byte(listing), &child))
+		info := newRemoteFileInfo(&child)
+		info.Hash = lMap["/b.txt"].Hash
+		require.Len(t, findModeDelta(map[string]fileInfo{"/b.txt": info}, lMap), want, listing)
+	}
+}
+
+func TestGetVanishedRemoteFiles(t *testing.T) {
+	remote := newFakeRemoteLister(map[string]string{
+		"/a.txt":       "a",
+		"/docs/b.txt":  "b",
+		"/skip/c.txt":  "c",
+		"/skip/d.txt":  "d",
+		"/other/e.txt": "e",
+	})
+	snapshot, err := getRemoteFileMap(remote, nil)
+	require.NoError(t, err)
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, writeSnapshotFile(cachePath, snapshot))
+
+	vanished, err := getVanishedRemoteFiles(remote, cachePath, nil)
+	require.NoError(t, err)
+	require.Empty(t, vanished)
+
+	delete(remote.dirs, "/other")
+	var rootChildren []*ListResult
+	for _, child := range remote.dirs["/"] {
+		if child.Path != "/other" {
+			rootChildren = append(rootChildren, child)
+		}
+	}
+	remote.dirs["/"] = rootChildren
+	remote.dirs["/docs"] = nil
+
+	vanished, err = getVanishedRemoteFiles(remote, cachePath, []string{"/skip"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/docs/b.txt", "/other", "/other/e.txt"}, vanished)
+}
+
+func TestLocalLongPaths(t *testing.T) {
+	root := t.TempDir()
+	// a deep tree just under the limit
+	var parts []string
+	for l := len(root); l+2*201 < maxLocalPathLength && len(parts) < 19; l += 201 {
+		parts = append(parts, strings.Repeat("d", 200))
+	}
+	deep := path.Join(append(parts, "f.txt")...)
+	writeSyncTestFiles(t, root, map[string]string{deep: "deep"})
+
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Contains(t, lMap, "/"+deep)
+
+	info, err := os.Stat(root)
+	require.NoError(t, err)
+	// a longer path is reported and skipped, the walk goes on
+	var skipped []string
+	so := newSyncOptions([]SyncOption{WithLongPaths(func(p string, err error) {
+		require.True(t, errors.Is(err, ErrLocalPathTooLong), err)
+		skipped = append(skipped, p)
+	})})
+	fMap := make(map[string]fileInfo)
+	walkFn := addLocalFileList(context.Background(), root, fMap, new([]string), nil, nil, so)
+	tooLong := strings.Repeat("x", maxLocalPathLength)
+	require.Equal(t, filepath.SkipDir, walkFn(filepath.Join(root, tooLong), info, nil))
+	require.Equal(t, []string{"/" + tooLong}, skipped)
+	require.True(t, fMap["/"+tooLong].Unreadable)
+
+	// its remote counterpart is not downloaded nor deleted
+	rMap := map[string]fileInfo{"/" + tooLong: {Type: fileref.DIRECTORY}, "/" + tooLong + "/f.txt": {Type: fileref.FILE, Hash: "f"}}
+	diffs, err := findCheckedDelta(rMap, fMap, map[string]fileInfo{}, root, so)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestSmallFilePacking(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"docs/a.txt":   "a",
+		"docs/b.txt":   "b",
+		"docs/c.txt":   "c",
+		"docs/big.bin": strings.Repeat("x", 100),
+		"lone/d.txt":   "d",
+		"e.txt":        "e",
+	})
+
+	diffs, err := GetManifestDiff(map[string]string{"/remote.txt": "r"}, root, nil, nil, WithSmallFilePacking(10, 2))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"/docs":         Pack,
+		"/docs/big.bin": Upload,
+		"/lone/d.txt":   Upload,
+		"/e.txt":        Upload,
+		"/remote.txt":   Download,
+	}, diffOps(diffs))
+	for _, d := range diffs {
+		if d.Op == Pack {
+			require.Equal(t, []string{"/docs/a.txt", "/docs/b.txt", "/docs/c.txt"}, d.Members)
+			require.Equal(t, int64(3), diffTransferSize(d, root))
+		}
+	}
+}
+
+func TestSummarizeDiff(t *testing.T) {
+	require.Equal(t, DiffSummary{}, SummarizeDiff(nil))
+
+	require.Equal(t, DiffSummary{
+		UploadCount:   3,
+		DownloadCount: 2,
+		DeleteCount:   3,
+		ConflictCount: 1,
+		UploadBytes:   10 + 20 + 5,
+		DownloadBytes: 7 + 8,
+	}, SummarizeDiff([]FileDiff{
+		{Op: Upload, Path: "/a.txt", Type: fileref.FILE, Size: 10},
+		{Op: Update, Path: "/b.txt", Type: fileref.FILE, Size: 20},
+		{Op: Link, Path: "/c.txt", Type: fileref.FILE, Size: 5, LinkTo: "/a.txt"},
+		{Op: Download, Path: "/d.txt", Type: fileref.FILE, Size: 7},
+		{Op: Download, Path: "/e.txt", Type: fileref.FILE, Size: 8},
+		{Op: Delete, Path: "/f.txt", Type: fileref.FILE, Size: 100},
+		{Op: Delete, Path: "/dir", Type: fileref.DIRECTORY},
+		{Op: LocalDelete, Path: "/g.txt", Type: fileref.FILE, Size: 3},
+		{Op: Conflict, Path: "/h.txt", Type: fileref.FILE, Size: 4},
+		{Op: Rename, Path: "/i.txt", OldPath: "/j.txt", Type: fileref.FILE, Size: 6},
+		{Op: Chmod, Path: "/k.txt", Type: fileref.FILE},
+	}))
+
+	// the sizes are set by the diff, a pack counts its members
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"docs/a.txt":   "a",
+		"docs/b.txt":   "b",
+		"docs/big.bin": strings.Repeat("x", 100),
+		"e.txt":        "eee",
+	})
+	diffs, err := GetManifestDiff(map[string]string{"/remote.txt": "r"}, root, nil, nil, WithSmallFilePacking(10, 2))
+	require.NoError(t, err)
+	require.Equal(t, DiffSummary{UploadCount: 4, DownloadCount: 1, UploadBytes: 1 + 1 + 100 + 3}, SummarizeDiff(diffs))
+}
+
+func TestStreamRemoteFiles(t *testing.T) {
+	remote := newFakeRemoteLister(map[string]string{
+		"/a.txt":        "a",
+		"/docs/b.txt":   "b",
+		"/docs/s/c.txt": "c",
+		"/skip/d.txt":   "d",
+	})
+	exclMap := getRemoteExcludeMap([]string{"/skip"})
+	expected, err := getRemoteFileMap(remote, exclMap)
+	require.NoError(t, err)
+
+	entries, errCh := streamRemoteFiles(context.Background(), remote, exclMap)
+	streamed := make(map[string]RemoteFileInfo)
+	for e := range entries {
+		streamed[e.Path] = e.Info
+	}
+	require.NoError(t, <-errCh)
+	require.Equal(t, remoteFileInfoMap(expected), streamed)
+
+	remote.fails["/docs/s"] = 1
+	entries, errCh = streamRemoteFiles(context.Background(), remote, exclMap)
+	streamed = make(map[string]RemoteFileInfo)
+	for e := range entries {
+		streamed[e.Path] = e.Info
+	}
+	require.Error(t, <-errCh)
+	require.Contains(t, streamed, "/docs/b.txt")
+	require.NotContains(t, streamed, "/docs/s/c.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, errCh = streamRemoteFiles(ctx, remote, exclMap)
+	for range entries {
+		t.Fatal("no entry is sent once ctx is done")
+	}
+	require.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestSingleFileLocalRoot(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"file.txt": "local", "other.txt": "other"})
+	filePath := filepath.Join(root, "file.txt")
+
+	manifest := map[string]string{
+		"/file.txt":     "stale-hash",
+		"/remote.txt":   "remote-only",
+		"/dir/file.txt": "nested",
+		"/other.txt":    "other-remote",
+	}
+	diffs, err := GetManifestDiff(manifest, filePath, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{{Op: Update, Path: "/file.txt", Type: fileref.FILE}}, withoutFileAttrs(diffs))
+
+	manifest["/file.txt"] = mustFileHash(t, filePath)
+	diffs, err = GetManifestDiff(manifest, filePath, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	diffs, err = GetManifestDiff(map[string]string{}, filePath, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{{Op: Upload, Path: "/file.txt", Type: fileref.FILE}}, withoutFileAttrs(diffs))
+}
+
+func TestRequiredRemoteDirs(t *testing.T) {
+	diffs := []FileDiff{
+		{Op: Upload, Path: "/top.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/a/b/c/deep.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/a/b/other.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/a b/x.txt", Type: fileref.FILE},
+		{Op: Link, Path: "/l/link.txt", Type: fileref.FILE, LinkTo: "/top.txt"},
+		{Op: Pack, Path: "/p/q", Type: fileref.DIRECTORY, Members: []string{"/p/q/1.txt", "/p/q/2.txt"}},
+		{Op: Update, Path: "/e/f/g.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/e/f/new.txt", Type: fileref.FILE},
+		{Op: LocalDelete, Path: "/gone/x.txt", Type: fileref.FILE},
+	}
+	require.Equal(t, []string{"/a", "/a b", "/a/b", "/a/b/c", "/l", "/p", "/p/q"}, RequiredRemoteDirs(diffs))
+	require.Empty(t, RequiredRemoteDirs(nil))
+}
+
+func TestRemoteAuthoritative(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"same.txt":         "same",
+		"modified.txt":     "local edit",
+		"local.txt":        "local only",
+		"extra/a.txt":      "a",
+		"extra/sub/b.txt":  "b",
+		"kept/remote1.txt": "r1",
+	})
+	manifest := map[string]string{
+		"/same.txt":         mustFileHash(t, filepath.Join(root, "same.txt")),
+		"/modified.txt":     "remote version",
+		"/remote.txt":       "remote only",
+		"/kept/remote1.txt": "remote r1",
+	}
+
+	diffs, err := GetManifestDiff(manifest, root, nil, nil, WithRemoteAuthoritative(false))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"/modified.txt":     Download,
+		"/remote.txt":       Download,
+		"/kept/remote1.txt": Download,
+	}, diffOps(diffs))
+
+	diffs, err = GetManifestDiff(manifest, root, nil, nil, WithRemoteAuthoritative(true))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"/modified.txt":     Download,
+		"/remote.txt":       Download,
+		"/kept/remote1.txt": Download,
+		"/local.txt":        LocalDelete,
+		"/extra":            LocalDelete,
+	}, diffOps(diffs))
+}
+
+func TestCalcFileHashMatchesUploadHash(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{"a.txt": "a", "dir/b.bin": strings.Repeat("0123456789", 100000)}
+	writeSyncTestFiles(t, root, files)
+
+	// remote state as listed after uploading the files, with the hash computed by the uploader
+	rMap := map[string]fileInfo{"/dir": {Type: fileref.DIRECTORY}}
+	for name, content := range files {
+		hasher := CreateHasher(64 * 1024)
+		require.NoError(t, hasher.WriteToFile([]byte(content), 0))
+		uploadHash, err := hasher.GetFileHash()
+		require.NoError(t, err)
+		require.Equal(t, uploadHash, mustFileHash(t, filepath.Join(root, filepath.FromSlash(name))))
+		rMap["/"+name] = fileInfo{Type: fileref.FILE, Hash: uploadHash}
+	}
+
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Empty(t, findDelta(rMap, lMap, make(map[string]fileInfo), root))
+}
+
+func TestHashErrorsSkipFile(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "unreadable", "b.txt": "b"})
+	errDenied := errors.New("permission_denied", "simulated read failure")
+	failingHash := func(so *syncOptions) {
+		so.hashFile = func(filePath string) (string, error) {
+			if filepath.Base(filePath) == "a.txt" {
+				return "", errDenied
+			}
+			return calcFileHash(filePath)
+		}
+	}
+	manifest := map[string]string{"/a.txt": "remote a", "/b.txt": "stale", "/c.txt": "remote only"}
+
+	diffs, err := GetManifestDiff(manifest, root, nil, nil, failingHash)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/b.txt": Update, "/c.txt": Download}, diffOps(diffs))
+
+	var failed []string
+	_, err = GetManifestDiff(manifest, root, nil, nil, failingHash, WithHashErrorHandler(func(path string, err error) error {
+		failed = append(failed, path)
+		return err
+	}))
+	require.True(t, errors.Is(err, errDenied), err)
+	require.Equal(t, []string{filepath.Join(root, "a.txt")}, failed)
+}
+
+// cancellingLister cancels the diff once it listed a directory
+type cancellingLister struct {
+	*fakeRemoteLister
+	cancel context.CancelFunc
+}
+
+func (cl *cancellingLister) ListDir(p string) (*ListResult, error) {
+	defer cl.cancel()
+	return cl.fakeRemoteLister.ListDir(p)
+}
+
+func TestDiffCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lister := newFakeRemoteLister(map[string]string{"/a/1.txt": "1", "/b/2.txt": "2", "/c/3.txt": "3"})
+	_, err := getRemoteFileMap(&contextLister{ctx: ctx, lister: &cancellingLister{lister, cancel}}, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, lister.totalCalls())
+
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a/1.txt": "1", "b/2.txt": "2", "c/3.txt": "3"})
+	ctx, cancel = context.WithCancel(context.Background())
+	var hashed []string
+	so := newSyncOptions([]SyncOption{func(so *syncOptions) {
+		so.hashFile = func(filePath string) (string, error) {
+			hashed = append(hashed, filePath)
+			cancel()
+			return calcFileHash(filePath)
+		}
+	}})
+	_, err = walkLocalFileMap(ctx, root, root, nil, nil, so)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, hashed, 1)
+}
+
+func TestRemoteListErrors(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{
+		"/a.txt":          "a",
+		"/bad/b.txt":      "b",
+		"/good/c.txt":     "c",
+		"/good/sub/d.txt": "d",
+		"/worse/e.txt":    "e",
+	})
+	lister.fails["/bad"] = -1
+	lister.fails["/worse"] = -1
+
+	rMap, err := getRemoteFileMap(lister, nil)
+	var listErrs RemoteListErrors
+	require.ErrorAs(t, err, &listErrs)
+	require.Equal(t, []string{"/bad", "/worse"}, listErrs.Dirs())
+	require.False(t, listErrs.hasRoot())
+	require.Contains(t, rMap, "/good/sub/d.txt")
+	require.Contains(t, rMap, "/bad")
+	require.NotContains(t, rMap, "/bad/b.txt")
+
+	lMap := map[string]fileInfo{"/bad/b.txt": {}, "/bad/new.txt": {}, "/badge.txt": {}, "/good/c.txt": {}}
+	prevMap := map[string]fileInfo{"/worse/e.txt": {}, "/good/c.txt": {}}
+	excludeSubtrees(listErrs.Dirs(), lMap, prevMap)
+	require.Equal(t, map[string]fileInfo{"/badge.txt": {}, "/good/c.txt": {}}, lMap)
+	require.Equal(t, map[string]fileInfo{"/good/c.txt": {}}, prevMap)
+
+	lister.fails["/"] = -1
+	_, err = getRemoteFileMap(lister, nil)
+	require.ErrorAs(t, err, &listErrs)
+	require.True(t, listErrs.hasRoot())
+}
+
+// withoutFileAttrs copies diffs without the size, hash and modification time of their files, to compare the operations only
+func withoutFileAttrs(diffs []FileDiff) []FileDiff {
+	stripped := make([]FileDiff, 0, len(diffs))
+	for _, d := range diffs {
+		d.Size, d.Hash, d.ModTime = 0, "", 0
+		stripped = append(stripped, d)
+	}
+	return stripped
+}
+
+func TestDiffFileAttrs(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"up.txt": "12345", "changed.txt": "123"})
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	updated := time.Unix(1700000000, 0)
+	rMap := map[string]fileInfo{
+		"/down.txt":    {Type: fileref.FILE, Hash: "down", Size: 100, ActualSize: 70, ModTime: updated},
+		"/changed.txt": {Type: fileref.FILE, Hash: "remote", Size: 9},
+		"/dir":         {Type: fileref.DIRECTORY, Hash: "dir"},
+	}
+	prevMap := map[string]fileInfo{"/changed.txt": rMap["/changed.txt"]}
+
+	diffs, err := findCheckedDelta(rMap, lMap, prevMap, root, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{
+		{Op: Update, Path: "/changed.txt", Type: fileref.FILE, Size: 3, Hash: lMap["/changed.txt"].Hash, ModTime: lMap["/changed.txt"].ModTime.Unix()},
+		{Op: Download, Path: "/down.txt", Type: fileref.FILE, Size: 70, Hash: "down", ModTime: updated.Unix()},
+		{Op: Upload, Path: "/up.txt", Type: fileref.FILE, Size: 5, Hash: lMap["/up.txt"].Hash, ModTime: lMap["/up.txt"].ModTime.Unix()},
+	}, diffs)
+
+	// the fields are left out of the JSON of the diffs without them
+	by, err := json.Marshal(FileDiff{Op: Delete, Path: "/dir", Type: fileref.DIRECTORY})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"operation":"Delete","path":"/dir","type":"d"}`, string(by))
+}
+
+func TestConflictPolicy(t *testing.T) {
+	now := time.Now()
+	maps := func() (rMap, lMap, prevMap map[string]fileInfo) {
+		rMap = map[string]fileInfo{
+			"/local_newer.txt":  {Type: fileref.FILE, Hash: "remote", ModTime: now.Add(-time.Hour)},
+			"/remote_newer.txt": {Type: fileref.FILE, Hash: "remote", ModTime: now},
+			"/same_time.txt":    {Type: fileref.FILE, Hash: "remote", ModTime: now},
+		}
+		lMap = map[string]fileInfo{
+			"/local_newer.txt":  {Type: fileref.FILE, Hash: "local", ModTime: now},
+			"/remote_newer.txt": {Type: fileref.FILE, Hash: "local", ModTime: now.Add(-time.Hour)},
+			"/same_time.txt":    {Type: fileref.FILE, Hash: "local", ModTime: now},
+		}
+		prevMap = map[string]fileInfo{
+			"/local_newer.txt":  {Type: fileref.FILE, Hash: "previous"},
+			"/remote_newer.txt": {Type: fileref.FILE, Hash: "previous"},
+			"/same_time.txt":    {Type: fileref.FILE, Hash: "previous"},
+		}
+		return
+	}
+
+	for policy, ops := range map[ConflictPolicy][]string{
+		Manual:       {Conflict, Conflict, Conflict},
+		PreferLocal:  {Update, Update, Update},
+		PreferRemote: {Download, Download, Download},
+		PreferNewer:  {Update, Download, Conflict},
+	} {
+		rMap, lMap, prevMap := maps()
+		diffs, err := findCheckedDelta(rMap, lMap, prevMap, t.TempDir(), newSyncOptions([]SyncOption{WithConflictPolicy(policy)}))
+		require.NoError(t, err)
+		require.Equal(t, []FileDiff{
+			{Op: ops[0], Path: "/local_newer.txt", Type: fileref.FILE},
+			{Op: ops[1], Path: "/remote_newer.txt", Type: fileref.FILE},
+			{Op: ops[2], Path: "/same_time.txt", Type: fileref.FILE},
+		}, withoutFileAttrs(diffs), "policy %v", policy)
+	}
+}
+
+func TestRenameDetection(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"dir/moved.txt": "moved locally",
+		"c.txt":         "moved remotely",
+		"copy2.txt":     "same content",
+		"new.txt":       "new",
+	})
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	hashOf := func(name string) string { return mustFileHash(t, filepath.Join(root, filepath.FromSlash(name))) }
+	rMap := map[string]fileInfo{
+		"/a.txt":     {Type: fileref.FILE, Hash: hashOf("dir/moved.txt")},
+		"/d.txt":     {Type: fileref.FILE, Hash: hashOf("c.txt")},
+		"/copy0.txt": {Type: fileref.FILE, Hash: hashOf("copy2.txt")},
+		"/copy1.txt": {Type: fileref.FILE, Hash: hashOf("copy2.txt")},
+	}
+	prevMap := map[string]fileInfo{
+		"/a.txt":     rMap["/a.txt"],
+		"/c.txt":     {Type: fileref.FILE, Hash: hashOf("c.txt")},
+		"/copy0.txt": rMap["/copy0.txt"],
+		"/copy1.txt": rMap["/copy1.txt"],
+	}
+
+	diffs, err := findCheckedDelta(rMap, lMap, prevMap, root, newSyncOptions([]SyncOption{WithRenameDetection(true), WithDiffCheck(true)}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []FileDiff{
+		{Op: Rename, Path: "/dir/moved.txt", Type: fileref.FILE, OldPath: "/a.txt"},
+		{Op: LocalRename, Path: "/d.txt", Type: fileref.FILE, OldPath: "/c.txt"},
+		{Op: Rename, Path: "/copy2.txt", Type: fileref.FILE, OldPath: "/copy0.txt"},
+		{Op: Delete, Path: "/copy1.txt", Type: fileref.FILE},
+		{Op: Upload, Path: "/new.txt", Type: fileref.FILE},
+	}, withoutFileAttrs(diffs))
+	require.Equal(t, []string{"/dir"}, RequiredRemoteDirs(diffs))
+
+	// the patch keeps the old paths
+	patch, err := NewSyncPatch(diffs, root)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, EncodeSyncPatch(&buf, patch))
+	parsed, err := ParseSyncPatch(&buf)
+	require.NoError(t, err)
+	require.Equal(t, withoutFileAttrs(diffs), parsed.Diffs())
+}
+
+func TestEmptyDirSync(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"new/a.txt": "a", "kept/b.txt": "b"})
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "empty"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "deleted_remotely"), 0755))
+	rMap := map[string]fileInfo{
+		"/kept":         {Type: fileref.DIRECTORY},
+		"/kept/b.txt":   {Type: fileref.FILE, Hash: mustFileHash(t, filepath.Join(root, "kept", "b.txt"))},
+		"/remote_empty": {Type: fileref.DIRECTORY},
+	}
+	prevMap := map[string]fileInfo{"/deleted_remotely": {Type: fileref.DIRECTORY}}
+
+	newLocalMap := func() map[string]fileInfo {
+		lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+		require.NoError(t, err)
+		return lMap
+	}
+
+	diffs, err := findCheckedDelta(rMap, newLocalMap(), prevMap, root, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/new/a.txt": Upload, "/deleted_remotely": LocalDelete}, diffOps(diffs))
+
+	diffs, err = findCheckedDelta(rMap, newLocalMap(), prevMap, root, newSyncOptions([]SyncOption{WithEmptyDirSync(true)}))
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{
+		{Op: LocalDelete, Path: "/deleted_remotely", Type: fileref.DIRECTORY},
+		{Op: CreateDir, Path: "/empty", Type: fileref.DIRECTORY},
+		{Op: CreateDir, Path: "/new", Type: fileref.DIRECTORY},
+		{Op: Upload, Path: "/new/a.txt", Type: fileref.FILE},
+		{Op: LocalCreateDir, Path: "/remote_empty", Type: fileref.DIRECTORY},
+	}, withoutFileAttrs(diffs))
+
+	// nothing is created remotely when the remote is authoritative
+	diffs, err = findCheckedDelta(rMap, newLocalMap(), prevMap, root, newSyncOptions([]SyncOption{WithEmptyDirSync(true), WithRemoteAuthoritative(false)}))
+	require.NoError(t, err)
+	require.Equal(t, []FileDiff{{Op: LocalCreateDir, Path: "/remote_empty", Type: fileref.DIRECTORY}}, diffs)
+}
+
+func TestFindDeltaDeterministic(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("dir%d/file%d.txt", i%4, i)] = fmt.Sprint(i)
+	}
+	writeSyncTestFiles(t, root, files)
+	rMap := make(map[string]fileInfo)
+	prevMap := make(map[string]fileInfo)
+	for i := 0; i < 10; i++ {
+		p := fmt.Sprintf("/remote%d/file%d.txt", i%3, i)
+		rMap[p] = fileInfo{Type: fileref.FILE, Hash: p, Mode: 0600}
+		if i%2 == 0 {
+			prevMap[p] = rMap[p]
+		}
+	}
+	// the same content with other permission bits, planned as Chmod
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("dir%d/file%d.txt", i%4, i)
+		rMap["/"+name] = fileInfo{Type: fileref.FILE, Hash: mustFileHash(t, filepath.Join(root, filepath.FromSlash(name))), Mode: 0600}
+	}
+
+	diff := func() []FileDiff {
+		lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+		require.NoError(t, err)
+		rCopy := make(map[string]fileInfo)
+		for p, info := range rMap {
+			rCopy[p] = info
+		}
+		modeDiff := findModeDelta(rCopy, lMap)
+		return append(findDelta(rCopy, lMap, prevMap, root), modeDiff...)
+	}
+	first := diff()
+	require.NotEmpty(t, first)
+	for i := 0; i < 20; i++ {
+		require.Equal(t, first, diff())
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	for p, expected := range map[string]string{
+		"/docs/a.txt":      "/docs/a.txt",
+		"/docs//a.txt":     "/docs/a.txt",
+		"//docs///a.txt":   "/docs/a.txt",
+		"/docs/./a.txt":    "/docs/a.txt",
+		"/docs/x/../a.txt": "/docs/a.txt",
+		"/docs/":           "/docs",
+		"/docs/a.txt/.":    "/docs/a.txt",
+		"docs/a.txt":       "/docs/a.txt",
+		"/../a.txt":        "/a.txt",
+		"/":                "/",
+		"":                 "/",
+	} {
+		require.Equal(t, expected, normalizePath(p), p)
+	}
+
+	lister := newFakeRemoteLister(map[string]string{"/docs//a.txt": "a", "/docs/./b.txt": "b", "/c.txt": "c"})
+	rMap, err := getRemoteFileMap(lister, getRemoteExcludeMap([]string{"/c.txt//", "/docs/x/../b.txt"}))
+	require.NoError(t, err)
+	paths := make([]string, 0, len(rMap))
+	for p := range rMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	require.Equal(t, []string{"/docs", "/docs/a.txt"}, paths)
+
+	// the same file on both sides is unchanged
+	lMap := map[string]fileInfo{"/docs": {Type: fileref.DIRECTORY}, "/docs/a.txt": {Type: fileref.FILE, Hash: "a"}}
+	require.Empty(t, findDelta(rMap, lMap, map[string]fileInfo{}, ""))
+}
+
+func TestSyncSentinelErrors(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"file.txt": "file", "bad.json": "not json"})
+
+	_, err := LoadRemoteSnapshot(filepath.Join(root, "missing.json"), nil)
+	require.True(t, errors.Is(err, ErrReadCache), err)
+	_, err = LoadRemoteSnapshot(filepath.Join(root, "bad.json"), nil)
+	require.True(t, errors.Is(err, ErrInvalidCacheFile), err)
+
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a"})
+	lister.fails["/"] = -1
+	_, err = saveRemoteSnapshot(lister, filepath.Join(root, "snapshot.json"), RemoteSnapshotOptions{})
+	require.True(t, errors.Is(err, ErrRemoteList), err)
+	// the cause is kept
+	require.Contains(t, err.Error(), "simulated failure for /")
+
+	hashErr := errors.New("hash_failed", "disk error")
+	failHash := func(so *syncOptions) {
+		so.hashFile = func(string) (string, error) { return "", hashErr }
+	}
+	_, err = GetManifestDiff(nil, root, nil, nil, failHash, WithHashErrorHandler(func(path string, err error) error { return err }))
+	require.True(t, errors.Is(err, ErrLocalList), err)
+	require.True(t, errors.Is(err, hashErr), err)
+	require.False(t, errors.Is(err, ErrRemoteList), err)
+}
+
+func TestUnreadableLocalDir(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "a", "locked/b.txt": "b"})
+	info, err := os.Stat(filepath.Join(root, "locked"))
+	require.NoError(t, err)
+
+	var skipped []string
+	so := newSyncOptions([]SyncOption{WithUnreadableDirs(func(path string, err error) {
+		skipped = append(skipped, path)
+	})})
+	lMap := make(map[string]fileInfo)
+	walkFn := addLocalFileList(context.Background(), root, lMap, new([]string), nil, nil, so)
+	// the walk lists the directory, then fails to read its entries
+	require.NoError(t, walkFn(filepath.Join(root, "locked"), info, nil))
+	require.NoError(t, walkFn(filepath.Join(root, "locked"), info, os.ErrPermission))
+	require.Equal(t, []string{"/locked"}, skipped)
+	require.Equal(t, []string{"/locked"}, so.unreadableDirs.Dirs())
+	require.True(t, errors.Is(so.unreadableDirs[0].Err, os.ErrPermission))
+	require.Contains(t, so.unreadableDirs.Error(), "/locked: ")
+	require.True(t, lMap["/locked"].Unreadable)
+
+	// the remote files under it are neither deleted nor downloaded
+	lMap["/a.txt"] = fileInfo{Type: fileref.FILE, Hash: mustFileHash(t, filepath.Join(root, "a.txt"))}
+	rMap := map[string]fileInfo{
+		"/a.txt":        lMap["/a.txt"],
+		"/locked":       {Type: fileref.DIRECTORY},
+		"/locked/b.txt": {Type: fileref.FILE, Hash: "b"},
+		"/locked/c.txt": {Type: fileref.FILE, Hash: "c"},
+	}
+	prevMap := map[string]fileInfo{"/locked/b.txt": {Type: fileref.FILE, Hash: "b"}}
+	diffs, err := findCheckedDelta(rMap, lMap, prevMap, root, newSyncOptions(nil))
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	require.NoError(t, os.Chmod(filepath.Join(root, "locked"), 0))
+	defer os.Chmod(filepath.Join(root, "locked"), 0755)
+	skipped = nil
+	lMap, err = getLocalFileMap(root, nil, nil, newSyncOptions([]SyncOption{WithUnreadableDirs(func(path string, err error) {
+		skipped = append(skipped, path)
+	})}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/locked"}, skipped)
+	require.True(t, lMap["/locked"].Unreadable)
+
+	// the diff comes with the directories, without the callback
+	diffs, err = GetManifestDiff(map[string]string{"/locked/b.txt": "b"}, root, nil, nil)
+	var readErrs LocalReadErrors
+	require.True(t, errors.As(err, &readErrs), err)
+	require.Equal(t, []string{"/locked"}, readErrs.Dirs())
+	require.Equal(t, map[string]string{"/a.txt": Upload}, diffOps(diffs))
+}
+
+func TestCacheFileNotSynced(t *testing.T) {
+	root := t.TempDir()
+	writeSyncTestFiles(t, root, map[string]string{
+		"a.txt":                 "a",
+		".sync/state.json":      "{}",
+		".sync/state.json.meta": "{}",
+		"other/state.json":      "same name elsewhere",
+	})
+	cachePath := filepath.Join(root, ".sync", "state.json")
+	require.Equal(t, map[string]bool{"/.sync/state.json": true, "/.sync/state.json.meta": true}, cacheFilePaths(cachePath, root))
+	require.Nil(t, cacheFilePaths(filepath.Join(t.TempDir(), "state.json"), root))
+	require.Nil(t, cacheFilePaths("", root))
+
+	so := newSyncOptions(nil)
+	so.skipLocalPaths = cacheFilePaths(cachePath, root)
+	lMap, err := getLocalFileMap(root, nil, map[string]int{}, so)
+	require.NoError(t, err)
+	diffs, err := findCheckedDelta(map[string]fileInfo{}, lMap, map[string]fileInfo{}, root, so)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"/a.txt": Upload, "/other/state.json": Upload}, diffOps(diffs))
+}
+
+func TestSoftDeadlineErr(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := context.WithDeadline(parent, time.Now().Add(-time.Second))
+	defer cancel()
+	require.Equal(t, ErrSoftDeadline, softDeadlineErr(parent, ctx))
+
+	// a cancellation of the caller is not the soft deadline
+	cancelParent()
+	require.Equal(t, context.Canceled, softDeadlineErr(parent, ctx))
+
+	// the listing stops at the deadline
+	lister := newFakeRemoteLister(map[string]string{"/a.txt": "a", "/dir/b.txt": "b"})
+	_, err := getRemoteFileMap(&contextLister{ctx: ctx, lister: lister}, nil)
+	require.Error(t, err)
+	require.Empty(t, lister.calls)
+}
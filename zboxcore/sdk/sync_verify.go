@@ -0,0 +1,43 @@
+package sdk
+
+import (
+	"context"
+	"sort"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// remoteFileMetaGetter gets the consensus file meta of a remote file, it is implemented by Allocation
+type remoteFileMetaGetter interface {
+	GetFileMeta(path string) (*ConsolidatedFileMeta, error)
+}
+
+// verifyRemoteHashes fetches again the hash of the remote files whose listed hash matches the local one, a file whose
+// fetched hash differs takes it in rMap so the diff plans it as changed
+func verifyRemoteHashes(ctx context.Context, getter remoteFileMetaGetter, rMap, lMap map[string]fileInfo) error {
+	paths := make([]string, 0, len(rMap))
+	for p, rInfo := range rMap {
+		lInfo, ok := lMap[p]
+		if ok && rInfo.Type == fileref.FILE && lInfo.Type == fileref.FILE && rInfo.Hash == lInfo.Hash {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		meta, err := getter.GetFileMeta(p)
+		if err != nil {
+			return errors.Wrap(err, "error verifying remote hash of "+p)
+		}
+		if rInfo := rMap[p]; meta.Hash != rInfo.Hash {
+			l.Logger.Error("Listed remote hash differs from the file meta", p, rInfo.Hash, meta.Hash)
+			rInfo.Hash = meta.Hash
+			rMap[p] = rInfo
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFileMetaGetter struct {
+	hashes  map[string]string
+	fetched []string
+}
+
+func (g *fakeFileMetaGetter) GetFileMeta(path string) (*ConsolidatedFileMeta, error) {
+	g.fetched = append(g.fetched, path)
+	hash, ok := g.hashes[path]
+	if !ok {
+		return nil, errors.New("no consensus")
+	}
+	return &ConsolidatedFileMeta{Path: path, Hash: hash}, nil
+}
+
+func TestVerifyRemoteHashes(t *testing.T) {
+	rMap := map[string]fileInfo{
+		"/a.txt":   {Type: fileref.FILE, Hash: "a"},
+		"/b.txt":   {Type: fileref.FILE, Hash: "b"},
+		"/c.txt":   {Type: fileref.FILE, Hash: "c"},
+		"/d":       {Type: fileref.DIRECTORY},
+		"/d/e.txt": {Type: fileref.FILE, Hash: "e"},
+	}
+	lMap := map[string]fileInfo{
+		"/a.txt":   {Type: fileref.FILE, Hash: "a"},
+		"/b.txt":   {Type: fileref.FILE, Hash: "b"},
+		"/c.txt":   {Type: fileref.FILE, Hash: "changed"},
+		"/d":       {Type: fileref.DIRECTORY},
+		"/d/e.txt": {Type: fileref.FILE, Hash: "e"},
+	}
+	getter := &fakeFileMetaGetter{hashes: map[string]string{"/a.txt": "a", "/b.txt": "stale", "/d/e.txt": "e"}}
+	require.NoError(t, verifyRemoteHashes(context.Background(), getter, rMap, lMap))
+	// only the files matching on both sides are fetched
+	require.Equal(t, []string{"/a.txt", "/b.txt", "/d/e.txt"}, getter.fetched)
+	require.Equal(t, "a", rMap["/a.txt"].Hash)
+	require.Equal(t, "stale", rMap["/b.txt"].Hash)
+	require.Equal(t, "c", rMap["/c.txt"].Hash)
+
+	// the file is planned as changed instead of being skipped
+	diffs, err := findCheckedDelta(rMap, lMap, map[string]fileInfo{}, "", newSyncOptions(nil))
+	require.NoError(t, err)
+	var planned []string
+	for _, d := range diffs {
+		planned = append(planned, d.Path)
+	}
+	require.Contains(t, planned, "/b.txt")
+	require.NotContains(t, planned, "/a.txt")
+
+	delete(getter.hashes, "/d/e.txt")
+	require.Error(t, verifyRemoteHashes(context.Background(), getter, rMap, lMap))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, verifyRemoteHashes(ctx, getter, rMap, lMap), context.Canceled)
+}
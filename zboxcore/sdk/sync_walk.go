@@ -0,0 +1,49 @@
+package sdk
+
+import (
+	"context"
+	"sort"
+
+	"github.com/0chain/errors"
+)
+
+// ErrStopWalk returned by the function of WalkFiles to stop the walk, WalkFiles then returns nil
+var ErrStopWalk = errors.New("stop_walk", "walk stopped")
+
+// WalkFiles - Walks the remote allocation breadth first and calls fn on every file and directory as soon as its parent
+// is listed, in path order within a directory, so the allocation is never held in memory as a whole.
+// fn stops the walk by returning an error, which WalkFiles returns, other than ErrStopWalk for which it returns nil.
+// A directory failing to list stops the walk as well.
+func (a *Allocation) WalkFiles(ctx context.Context, fn func(f RemoteFileInfo) error) error {
+	return walkRemoteFiles(ctx, a, fn)
+}
+
+func walkRemoteFiles(ctx context.Context, lister remoteLister, fn func(f RemoteFileInfo) error) error {
+	lister = &contextLister{ctx: ctx, lister: lister}
+	for dirs := []string{"/"}; len(dirs) > 0; dirs = dirs[1:] {
+		fMap := make(map[string]fileInfo)
+		childDirs, err := getRemoteFilesAndDirs(lister, dirs[:1], fMap, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		dirs = append(dirs, childDirs...)
+
+		paths := make([]string, 0, len(fMap))
+		for p := range fMap {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if err := fn(newRemoteFileInfoEntry(p, fMap[p])); err != nil {
+				if errors.Is(err, ErrStopWalk) {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
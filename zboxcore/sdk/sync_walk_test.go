@@ -0,0 +1,55 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkRemoteFiles(t *testing.T) {
+	lister := newFakeRemoteLister(map[string]string{
+		"/b.txt":       "b",
+		"/a/1.txt":     "1",
+		"/a/2.txt":     "2",
+		"/a/sub/3.txt": "3",
+		"/c/4.txt":     "4",
+	})
+
+	var visited []string
+	require.NoError(t, walkRemoteFiles(context.Background(), lister, func(f RemoteFileInfo) error {
+		visited = append(visited, f.Path)
+		if f.Path == "/b.txt" {
+			require.Equal(t, fileref.FILE, f.Type)
+			require.Equal(t, "b", f.Hash)
+		}
+		return nil
+	}))
+	require.Equal(t, []string{"/a", "/b.txt", "/c", "/a/1.txt", "/a/2.txt", "/a/sub", "/c/4.txt", "/a/sub/3.txt"}, visited)
+
+	// the walk stops without listing the rest
+	lister.calls = make(map[string]int)
+	visited = nil
+	require.NoError(t, walkRemoteFiles(context.Background(), lister, func(f RemoteFileInfo) error {
+		visited = append(visited, f.Path)
+		if f.Path == "/a/1.txt" {
+			return ErrStopWalk
+		}
+		return nil
+	}))
+	require.Equal(t, []string{"/a", "/b.txt", "/c", "/a/1.txt"}, visited)
+	require.Equal(t, map[string]int{"/": 1, "/a": 1}, lister.calls)
+
+	failure := errors.New("index full")
+	err := walkRemoteFiles(context.Background(), lister, func(f RemoteFileInfo) error { return failure })
+	require.Equal(t, failure, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, walkRemoteFiles(ctx, lister, func(f RemoteFileInfo) error { return nil }), context.Canceled)
+
+	lister.fails["/c"] = -1
+	require.Error(t, walkRemoteFiles(context.Background(), lister, func(f RemoteFileInfo) error { return nil }))
+}
@@ -0,0 +1,118 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const defaultWatchDebounce = 500 * time.Millisecond
+
+// syncWatcher computes the diffs of changed local paths against the remote state it keeps.
+// The state starts from a full remote listing and is then updated as if every returned diff was applied.
+type syncWatcher struct {
+	root   string
+	remote map[string]fileInfo
+	so     *syncOptions
+}
+
+// diffPaths returns the operations for the changed remote paths and their subtrees only
+func (w *syncWatcher) diffPaths(paths []string) ([]FileDiff, error) {
+	sort.Strings(paths)
+	var roots []string
+	for _, p := range paths {
+		if len(roots) > 0 && (p == roots[len(roots)-1] || strings.HasPrefix(p, roots[len(roots)-1]+"/")) {
+			continue
+		}
+		roots = append(roots, p)
+	}
+
+	rSub := make(map[string]fileInfo)
+	lSub := make(map[string]fileInfo)
+	for _, p := range roots {
+		for rPath, info := range w.remote {
+			if rPath == p || strings.HasPrefix(rPath, p+"/") {
+				rSub[rPath] = info
+			}
+		}
+		lAbsPath := filepath.Join(w.root, filepath.FromSlash(p))
+		if _, err := os.Lstat(lAbsPath); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var dirList []string
+		if err := filepath.Walk(lAbsPath, addLocalFileList(context.Background(), w.root, lSub, &dirList, nil, nil, w.so)); err != nil {
+			return nil, err
+		}
+		for _, d := range dirList {
+			lSub[d] = fileInfo{Type: fileref.DIRECTORY}
+		}
+	}
+
+	prevSub := make(map[string]fileInfo, len(rSub))
+	lCopy := make(map[string]fileInfo, len(lSub))
+	for p, info := range rSub {
+		prevSub[p] = info
+	}
+	for p, info := range lSub {
+		lCopy[p] = info
+	}
+	lFdiff := findDelta(rSub, lCopy, prevSub, w.root)
+
+	// the remote subtrees now hold the local state
+	for p := range rSub {
+		delete(w.remote, p)
+	}
+	for p, info := range lSub {
+		w.remote[p] = info
+	}
+	return lFdiff, nil
+}
+
+// watchLoop collects the changed remote paths from events and, once no event came for debounce,
+// calls onDiff with their diff. It returns when ctx is done or events is closed.
+func watchLoop(ctx context.Context, events <-chan string, errs <-chan error, debounce time.Duration, w *syncWatcher, onDiff func([]FileDiff)) error {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-errs:
+			if ok {
+				l.Logger.Error("Watching local files failed", err)
+			}
+		case p, ok := <-events:
+			if !ok {
+				return nil
+			}
+			pending[p] = true
+			timer.Reset(debounce)
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			pending = make(map[string]bool)
+			lFdiff, err := w.diffPaths(paths)
+			if err != nil {
+				l.Logger.Error("Diff of changed local files failed", paths, err)
+				continue
+			}
+			if len(lFdiff) > 0 {
+				onDiff(lFdiff)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !js
+// +build !js
+
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/0chain/errors"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch watches localRoot and calls onDiff with the operations bringing the allocation up to date with each batch of local changes,
+// until ctx is done. The remote tree is listed once when it starts, later diffs assume onDiff applies the operations it gets.
+func (a *Allocation) Watch(ctx context.Context, localRoot string, onDiff func([]FileDiff), opts ...SyncOption) error {
+	so := newSyncOptions(opts)
+	localRoot = strings.TrimRight(localRoot, "/")
+	if err := validateLocalRoot(localRoot); err != nil {
+		return err
+	}
+	remote, err := a.GetRemoteFileMap(nil)
+	if err != nil {
+		return errors.Wrap(err, ErrRemoteList)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "error watching local files.")
+	}
+	defer watcher.Close()
+	if err := watchLocalTree(watcher, localRoot); err != nil {
+		return errors.Wrap(err, "error watching local files.")
+	}
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		for event := range watcher.Events {
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+					// new directories are not covered by the parent watch
+					_ = watchLocalTree(watcher, event.Name)
+				}
+			}
+			rel, err := filepath.Rel(localRoot, event.Name)
+			if err != nil {
+				continue
+			}
+			select {
+			case events <- "/" + filepath.ToSlash(rel):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	w := &syncWatcher{root: localRoot, remote: remote, so: so}
+	return watchLoop(ctx, events, watcher.Errors, defaultWatchDebounce, w, onDiff)
+}
+
+func watchLocalTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		return watcher.Add(p)
+	})
+}
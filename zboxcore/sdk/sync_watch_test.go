@@ -0,0 +1,79 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchLoopTargetedDiffs(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"old/c.txt": "c",
+		"old/d.txt": "d",
+		"keep.txt":  "keep",
+	}
+	writeSyncTestFiles(t, root, files)
+	lMap, err := getLocalFileMap(root, nil, nil, newSyncOptions(nil))
+	require.NoError(t, err)
+	hashes := make(map[string]string)
+	for name := range files {
+		hashes["/"+name] = lMap["/"+name].Hash
+	}
+	remote, err := getRemoteFileMap(newFakeRemoteLister(hashes), nil)
+	require.NoError(t, err)
+
+	w := &syncWatcher{root: root, remote: remote, so: newSyncOptions(nil)}
+	events := make(chan string)
+	diffs := make(chan []FileDiff, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(ctx, events, nil, 20*time.Millisecond, w, func(d []FileDiff) { diffs <- d })
+	}()
+
+	nextDiff := func() map[string]string {
+		select {
+		case d := <-diffs:
+			return diffOps(d)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no diff")
+			return nil
+		}
+	}
+
+	// modify, create a directory, delete and rename in one debounced batch
+	writeSyncTestFiles(t, root, map[string]string{"a.txt": "changed", "new/e.txt": "e"})
+	require.NoError(t, os.Remove(filepath.Join(root, "b.txt")))
+	require.NoError(t, os.Rename(filepath.Join(root, "old"), filepath.Join(root, "moved")))
+	for _, p := range []string{"/a.txt", "/new", "/new/e.txt", "/b.txt", "/old", "/moved", "/a.txt"} {
+		events <- p
+	}
+	require.Equal(t, map[string]string{
+		"/a.txt":       Update,
+		"/new/e.txt":   Upload,
+		"/b.txt":       Delete,
+		"/old":         Delete,
+		"/moved/c.txt": Upload,
+		"/moved/d.txt": Upload,
+	}, nextDiff())
+
+	// the state assumes the diff was applied, only the new change is reported
+	writeSyncTestFiles(t, root, map[string]string{"new/e.txt": "e2"})
+	events <- "/new/e.txt"
+	require.Equal(t, map[string]string{"/new/e.txt": Update}, nextDiff())
+
+	// an event without a change produces no diff
+	events <- "/keep.txt"
+	time.Sleep(100 * time.Millisecond)
+	close(events)
+	require.NoError(t, <-done)
+	require.Empty(t, diffs)
+}
@@ -113,8 +113,21 @@ type UploadRequest struct {
 	Consensus
 }
 
+// MaxUploadBlobbers the most blobbers an upload can use, the upload mask has one bit per blobber.
+// It follows the width of the zboxutil.Uint128 mask, so it is not configurable: a deployment with more
+// blobbers needs a wider mask type, which raises it along.
+const MaxUploadBlobbers = zboxutil.Uint128Bits
+
+// newUploadMask gets the mask of the first numBlobbers blobbers, all of them from MaxUploadBlobbers on
+func newUploadMask(numBlobbers int) zboxutil.Uint128 {
+	if numBlobbers >= MaxUploadBlobbers {
+		return zboxutil.NewUint128(0).Not()
+	}
+	return zboxutil.NewUint128(1).Lsh(uint64(numBlobbers)).Sub64(1)
+}
+
 func (req *UploadRequest) setUploadMask(numBlobbers int) {
-	req.uploadMask = zboxutil.NewUint128(1).Lsh(uint64(numBlobbers)).Sub64(1)
+	req.uploadMask = newUploadMask(numBlobbers)
 }
 
 func (req *UploadRequest) prepareUpload(
@@ -637,12 +650,33 @@ func (req *UploadRequest) processUpload(ctx context.Context, a *Allocation) {
 
 }
 
+// IsFullConsensusSupported checks if the blobbers of the upload mask are enough to reach fullconsensus, see IsMaskConsensusSupported
 func (req *UploadRequest) IsFullConsensusSupported() bool {
-	var maxBlobbers = req.GetMaxBlobbersSupported()
-
-	return maxBlobbers >= int(req.fullconsensus)
+	return IsMaskConsensusSupported(req.uploadMask, req.fullconsensus)
 }
 
 func (req *UploadRequest) GetMaxBlobbersSupported() int {
 	return req.uploadMask.CountOnes()
 }
+
+// ComputeMask builds the upload mask for the blobbers that responded, given by their index in the allocation.
+func ComputeMask(responsive []int) (zboxutil.Uint128, error) {
+	mask := zboxutil.NewUint128(0)
+	for _, idx := range responsive {
+		if idx < 0 || idx >= MaxUploadBlobbers {
+			return zboxutil.Uint128{}, errors.New("invalid_blobber_index", fmt.Sprintf("blobber index %v is out of the supported range [0, %v)", idx, MaxUploadBlobbers))
+		}
+		mask = mask.Or(zboxutil.NewUint128(1).Lsh(uint64(idx)))
+	}
+	return mask, nil
+}
+
+// IsMaskConsensusSupported checks if the blobbers in mask are enough to reach fullconsensus.
+// A consensus needs at least one blobber: it is never supported with a fullconsensus of 0 or less, or an empty mask,
+// nor above MaxUploadBlobbers.
+func IsMaskConsensusSupported(mask zboxutil.Uint128, fullconsensus int) bool {
+	if fullconsensus <= 0 || fullconsensus > MaxUploadBlobbers {
+		return false
+	}
+	return mask.CountOnes() >= fullconsensus
+}
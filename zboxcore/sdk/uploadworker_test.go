@@ -2,6 +2,8 @@ package sdk
 
 import (
 	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
 )
 
 func TestMaxBlobbersRequiredGreaterThanImplicitLimit128(t *testing.T) {
@@ -59,7 +61,146 @@ func TestNumBlobbersRequiredZero(t *testing.T) {
 	req.setUploadMask(maxNumOfBlobbers)
 	req.fullconsensus = 0
 
+	// there is no consensus to reach without any blobber required
+	if req.IsFullConsensusSupported() {
+		t.Errorf("IsFullConsensusSupported() = %v, want %v", true, false)
+	}
+}
+
+func TestNumBlobbersZeroMask(t *testing.T) {
+	for _, fullconsensus := range []int{0, 1} {
+		var req = &UploadRequest{}
+		req.setUploadMask(0)
+		req.fullconsensus = fullconsensus
+
+		if req.IsFullConsensusSupported() {
+			t.Errorf("IsFullConsensusSupported() with %v required = %v, want %v", fullconsensus, true, false)
+		}
+	}
+}
+
+func TestMaxUploadBlobbers(t *testing.T) {
+	for _, numBlobbers := range []int{MaxUploadBlobbers - 1, MaxUploadBlobbers, MaxUploadBlobbers + 10} {
+		want := numBlobbers
+		if want > MaxUploadBlobbers {
+			want = MaxUploadBlobbers
+		}
+		if got := newUploadMask(numBlobbers).CountOnes(); got != want {
+			t.Errorf("newUploadMask(%v).CountOnes() = %v, want %v", numBlobbers, got, want)
+		}
+	}
+
+	// every bit of the mask is a blobber
+	if got := zboxutil.NewUint128(0).Not().CountOnes(); got != MaxUploadBlobbers {
+		t.Errorf("MaxUploadBlobbers = %v, want the mask width %v", MaxUploadBlobbers, got)
+	}
+
+	var req = &UploadRequest{}
+	req.setUploadMask(MaxUploadBlobbers)
+	req.fullconsensus = MaxUploadBlobbers
 	if !req.IsFullConsensusSupported() {
 		t.Errorf("IsFullConsensusSupported() = %v, want %v", false, true)
 	}
+	req.fullconsensus = MaxUploadBlobbers + 1
+	if req.IsFullConsensusSupported() {
+		t.Errorf("IsFullConsensusSupported() = %v, want %v", true, false)
+	}
+
+	if _, err := ComputeMask([]int{MaxUploadBlobbers - 1}); err != nil {
+		t.Errorf("ComputeMask() error = %v", err)
+	}
+	if _, err := ComputeMask([]int{MaxUploadBlobbers}); err == nil {
+		t.Errorf("ComputeMask() error = nil, want error")
+	}
+}
+
+// blobberIndexes gets the blobber indexes from, from+1, ..., to-1
+func blobberIndexes(from, to int) []int {
+	var s []int
+	for i := from; i < to; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func TestUploadMaskAbove64Blobbers(t *testing.T) {
+	for _, numBlobbers := range []int{65, 100, 128} {
+		var req = &UploadRequest{}
+		req.setUploadMask(numBlobbers)
+		if got := req.GetMaxBlobbersSupported(); got != numBlobbers {
+			t.Errorf("GetMaxBlobbersSupported() with %v blobbers = %v, want %v", numBlobbers, got, numBlobbers)
+		}
+		req.fullconsensus = numBlobbers
+		if !req.IsFullConsensusSupported() {
+			t.Errorf("IsFullConsensusSupported() with %v blobbers = %v, want %v", numBlobbers, false, true)
+		}
+		req.fullconsensus = numBlobbers + 1
+		if req.IsFullConsensusSupported() {
+			t.Errorf("IsFullConsensusSupported() with %v blobbers = %v, want %v", numBlobbers, true, false)
+		}
+
+		// the mask of all the blobbers responding is the upload mask, the last blobber is in the upper 64 bits
+		mask, err := ComputeMask(blobberIndexes(0, numBlobbers))
+		if err != nil {
+			t.Fatalf("ComputeMask() error = %v", err)
+		}
+		if !mask.Equals(req.uploadMask) {
+			t.Errorf("ComputeMask() of %v blobbers = %v, want %v", numBlobbers, mask, req.uploadMask)
+		}
+		if !IsMaskConsensusSupported(mask, numBlobbers) {
+			t.Errorf("IsMaskConsensusSupported() with %v blobbers = %v, want %v", numBlobbers, false, true)
+		}
+
+		// without the last blobber the full consensus is lost
+		mask, err = ComputeMask(blobberIndexes(0, numBlobbers-1))
+		if err != nil {
+			t.Fatalf("ComputeMask() error = %v", err)
+		}
+		if mask.Equals(req.uploadMask) || !mask.Or(req.uploadMask).Equals(req.uploadMask) {
+			t.Errorf("ComputeMask() of %v blobbers = %v, want a subset of %v", numBlobbers-1, mask, req.uploadMask)
+		}
+		if IsMaskConsensusSupported(mask, numBlobbers) {
+			t.Errorf("IsMaskConsensusSupported() without blobber %v = %v, want %v", numBlobbers-1, true, false)
+		}
+	}
+}
+
+func TestComputeMask(t *testing.T) {
+	tests := []struct {
+		name          string
+		responsive    []int
+		fullconsensus int
+		wantOnes      int
+		wantConsensus bool
+		wantErr       bool
+	}{
+		{name: "all of 32 responded", responsive: blobberIndexes(0, 32), fullconsensus: 32, wantOnes: 32, wantConsensus: true},
+		{name: "31 of 32 responded", responsive: blobberIndexes(1, 32), fullconsensus: 32, wantOnes: 31, wantConsensus: false},
+		{name: "all of 128 responded", responsive: blobberIndexes(0, 128), fullconsensus: 128, wantOnes: 128, wantConsensus: true},
+		{name: "upper half of 128 responded", responsive: blobberIndexes(64, 128), fullconsensus: 64, wantOnes: 64, wantConsensus: true},
+		{name: "duplicate indexes", responsive: []int{0, 0, 1}, fullconsensus: 3, wantOnes: 2, wantConsensus: false},
+		{name: "index beyond 128", responsive: []int{0, 128}, wantErr: true},
+		{name: "negative index", responsive: []int{-1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, err := ComputeMask(tt.responsive)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ComputeMask() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ComputeMask() error = %v", err)
+			}
+			if got := mask.CountOnes(); got != tt.wantOnes {
+				t.Errorf("CountOnes() = %v, want %v", got, tt.wantOnes)
+			}
+			if got := IsMaskConsensusSupported(mask, tt.fullconsensus); got != tt.wantConsensus {
+				t.Errorf("IsMaskConsensusSupported() = %v, want %v", got, tt.wantConsensus)
+			}
+		})
+	}
 }
@@ -2,6 +2,9 @@ package zboxutil
 
 import "math/bits"
 
+// Uint128Bits width of Uint128, e.g. the most blobbers a mask can hold
+const Uint128Bits = 128
+
 type Uint128 struct {
 	high uint64
 	low  uint64